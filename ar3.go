@@ -13,14 +13,18 @@ This Golang library takes over for the local robotic control software by
 implementing the functions needed to communicate with the arduino on the AR3 or
 AR2 robot.
 
-We do not yet support encoders in the AR3, nor any other commands. All other
-rountines can be reproduced in code and not directly on the robot.
+Encoder positions can be read back with ReadEncoders, and checked after every
+move with EnableStepLossCheck. We do not yet support any other commands. All
+other rountines can be reproduced in code and not directly on the robot.
 
 Testing
 
 Testing can be done with the AR3simulate struct, which satisfies all of the
 interfaces of AR3. For real connection to a robot, use connect to the robot
-using `Connect` instead of `ConnectMock`.
+using `Connect` instead of `ConnectMock`. To exercise the real command path
+without a robot, pass a MemoryTransport (or any other Transport) to
+`ConnectTransport`, or `Connect` to the pseudo-terminal of an emulator from the
+emulator package, which speaks the arduino's serial protocol.
 
 Compatibility
 
@@ -29,19 +33,18 @@ to the AR3 robotic arm. It uses a couple of serial port configuration variables
 specific to linux systems. We use as few packages as possible, with the only
 non-standard package being golang.org/x/sys/unix, which carries unix file
 variables that help us open the serial port.
-
 */
 package ar3
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"os"
+	"sync"
 	"time"
-	"unsafe"
 
+	"github.com/trilobio/ar3/protocol"
 	"github.com/trilobio/kinematics"
-	"golang.org/x/sys/unix"
 )
 
 // Converts degrees to radians
@@ -68,71 +71,100 @@ type Arm interface {
 	CurrentJointRadians() [7]float64
 	CurrentPose() kinematics.Pose
 	CurrentStepperPosition() [7]int
+	Profile() RobotProfile
+	SetTool(tool Tool) error
+	CurrentTool() Tool
+	CurrentPoseInFrame(frame Frame) kinematics.Pose
+	CanReach(pose kinematics.Pose, tool Tool) bool
+	SetSingularityPolicy(policy SingularityPolicy) error
+	CurrentSingularityPolicy() SingularityPolicy
+	SetCollisionModel(model CollisionModel) error
+	CurrentCollisionModel() CollisionModel
+	SetSoftLimits(limits SoftLimits) error
+	CurrentSoftLimits() SoftLimits
 
 	MoveSteppers(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error
 	MoveJointRadians(speed, accdur, accspd, dccdur, dccspd int, j1, j2, j3, j4, j5, j6, tr float64) error
 	Move(speed, accdur, accspd, dccdur, dccspd int, pose kinematics.Pose) error
 
+	MoveSteppersWithParams(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) error
+	MoveJointRadiansWithParams(params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) error
+	MoveWithParams(params MoveParams, pose kinematics.Pose) error
+	MoveWithHint(params MoveParams, pose kinematics.Pose, hint ConfigurationHint) error
+	MoveInFrame(params MoveParams, frame Frame, pose kinematics.Pose) error
+	MoveLinear(params MoveParams, pose kinematics.Pose, stepMM, stepDeg float64) error
+	MoveCircular(params MoveParams, via, pose kinematics.Pose, stepMM, stepDeg float64) error
+	MoveSpline(params MoveParams, points []kinematics.Pose, stepMM, stepDeg float64) error
+	PlanJointMove(params MoveParams, joints [7]float64) (MoveTiming, error)
+
+	CurrentTrackPose() TrackPose
+	MoveTrackPose(params MoveParams, pose TrackPose) error
+
+	ReadEncoders() ([6]int, error)
+	EnableStepLossCheck(tolerance [6]int)
+	DisableStepLossCheck()
+
+	MoveSteppersAsync(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) *Motion
+	MoveJointRadiansAsync(params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) *Motion
+	MoveAsync(params MoveParams, pose kinematics.Pose) *Motion
+	QueuedMotions() []*Motion
+	FlushQueue() int
+	Pause()
+	Resume()
+	Stop() error
+	IsCalibrated() bool
+	CalibratedJoints() [7]bool
+	MarkCalibrated(calibrated [7]bool)
+	AllowUncalibratedMotion(allow bool)
+	SetLimitSwitchSteps(steps [7]int) error
+	LimitSwitchSteps() [7]int
+
 	Wait(int) error
+	Close() error
 }
 
-// The following StepLims are hard-coded in the ARbot.cal file for the stepper
-// motors. These should not change.
-const j1stepLim int = 15200
-const j2stepLim int = 14600
-const j3stepLim int = 7850
-const j4stepLim int = 15200
-const j5stepLim int = 4575
-const j6stepLim int = 14936
-
-// The following RadSteps (radians per step) are calculated from the AR3 stepper
-// motors and gearing to be exact values for converting steps to joint angles
-const j1RadStep float64 = 0.0225 * degreesToRadians
-const j2RadStep float64 = 0.009 * degreesToRadians
-const j3RadStep float64 = 0.018 * degreesToRadians
-const j4RadStep float64 = 0.01092214664 * degreesToRadians
-const j5RadStep float64 = 0.04723477289 * degreesToRadians
-const j6RadStep float64 = 0.02343358396 * degreesToRadians
-const trMmStep float64 = 0.0 // This is for a linear rail (mm/step)
-
-var calibDirs = [7]bool{false, true, false, false, true, true, false}
-var limitSwitchSteps [7]int = anglesToSteps([7]float64{-170, 42.5, -60, -85, 90, 170, 0}, true)
-
-// AR3exec struct represents an AR3 robotic arm connected to a serial port.
+// AR3exec struct represents an AR3 robotic arm connected over a Transport
+// (usually a serial port). It is safe for concurrent use: commands are sent to
+// the AR3 one at a time by a single command loop, and state is read and
+// written under a lock.
 type AR3exec struct {
-	serial *os.File
-
-	jointVals        [7]int
-	jointDirs        [7]bool
-	limitSwitchSteps [7]int
-}
-
-// readBuffer values off serial into a buffer
-func (ar3 *AR3exec) readBuffer() error {
-	// Read output of echo
-	buf := make([]byte, 128)
-	_, err := ar3.serial.Read(buf)
-	if err != nil {
-		return err
-	}
-	return nil
+	serial   Transport
+	requests chan request
+	quit     chan struct{}
+	queue    motionQueue
+
+	closeOnce sync.Once
+	// writeMu serializes writes to serial from the command loop and Stop.
+	writeMu sync.Mutex
+
+	mu sync.Mutex // guards the fields below
+	// profile and limitSwitchSteps only change with SetLimitSwitchSteps.
+	profile            RobotProfile
+	limitSwitchSteps   [7]int
+	jointVals          [7]int
+	jointDirs          [7]bool
+	timeout            time.Duration
+	stepLossCheck      bool
+	stepLossTolerance  [6]int
+	tool               Tool
+	singularityPolicy  SingularityPolicy
+	collisionModel     CollisionModel
+	softLimits         SoftLimits
+	calibrated         [7]bool
+	uncalibratedMotion bool
+	stops              int
+	// abort is closed by Stop to interrupt a read waiting on the arm.
+	abort chan struct{}
+	// stale is set when a response may still arrive for a command that was
+	// given up on, or Stop was sent. The command loop flushes serial before
+	// its next command.
+	stale bool
 }
 
 // clearBuffer Discards data written to the port but not transmitted, or data
 // received but not read.
 func (ar3 *AR3exec) clearBuffer() error {
-	const TCFLSH = 0x540B
-	_, _, errno := unix.Syscall(
-		unix.SYS_IOCTL,
-		uintptr(ar3.serial.Fd()),
-		uintptr(TCFLSH),
-		uintptr(unix.TCIOFLUSH),
-	)
-
-	if errno == 0 {
-		return nil
-	}
-	return errno
+	return ar3.serial.Flush()
 }
 
 // Connect connects to the AR3 over serial.
@@ -140,92 +172,81 @@ func (ar3 *AR3exec) clearBuffer() error {
 // jointDirs is a boolean array describing which direction (positive or
 // negative) a positive step number should move each joint.
 //
-// limitSwitchSteps is an array of integers representing the number of steps
-// the limit switch is offset from zero. Each value should be directional, i.e.
-// the value should be the directional number of steps to move the joint from
-// the limit switch to the 0 position. If you do not know this number, set
-// limitSwitchSteps all to 0 and immediately calibrate.
-func Connect(serialConnectionStr string, jointDirs [7]bool) (Arm, error) {
-	// Set up connection to the serial port
-	f, err := os.OpenFile(serialConnectionStr, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0666)
-	if err != nil {
+// profile describes the gearing, limits and geometry of the arm, for example
+// AR3Profile.
+//
+// The limit switch of each joint is taken to be offset from zero by the
+// profile's LimitSwitchDegrees. Arms whose switches sit elsewhere should set
+// their own offsets with SetLimitSwitchSteps.
+//
+// Moves are refused with ErrNotCalibrated until every joint is calibrated
+// (see IsCalibrated and AllowUncalibratedMotion).
+func Connect(serialConnectionStr string, jointDirs [7]bool, profile RobotProfile) (Arm, error) {
+	if err := profile.Validate(); err != nil {
 		return &AR3exec{}, err
 	}
-	rate := uint32(unix.B115200) // 115200 is the default Baud rate of the AR3 arm
-	cflagToUse := unix.CREAD | unix.CLOCAL | rate
-	// We use rational defaults from https://github.com/tarm/serial/blob/master/serial_linux.go
-	cflagToUse |= unix.CS8
-	// Get Unix file descriptor
-	fd := f.Fd()
-	t := unix.Termios{
-		Iflag:  unix.IGNPAR,
-		Cflag:  cflagToUse,
-		Ispeed: rate,
-		Ospeed: rate,
-	}
-	t.Cc[unix.VMIN] = uint8(1)
-	t.Cc[unix.VTIME] = uint8(10) // Default timeout is 1s
-
-	_, _, errno := unix.Syscall6(
-		unix.SYS_IOCTL,
-		uintptr(fd),
-		uintptr(unix.TCSETS),
-		uintptr(unsafe.Pointer(&t)),
-		0,
-		0,
-		0,
-	)
-	if errno != 0 {
+	t, err := OpenSerial(serialConnectionStr)
+	if err != nil {
 		return &AR3exec{}, err
 	}
 	time.Sleep(time.Millisecond * 1000)
+	return ConnectTransport(t, jointDirs, profile)
+}
 
-	// Instantiate a new AR3 object that holds our serial port. Additionally,
-	// set default stepLims, which are hard-coded in the AR3 software
-	newAR3 := AR3exec{serial: f, jointDirs: jointDirs, limitSwitchSteps: limitSwitchSteps}
+// ConnectTransport connects to an AR3 over an already opened Transport. See
+// Connect for a description of jointDirs and profile.
+func ConnectTransport(t Transport, jointDirs [7]bool, profile RobotProfile) (Arm, error) {
+	if err := profile.Validate(); err != nil {
+		return &AR3exec{serial: t}, err
+	}
+	// Instantiate a new AR3 object that holds our transport. Additionally,
+	// set the limit switch offsets of the profile.
+	newAR3 := &AR3exec{serial: t, profile: profile, jointDirs: jointDirs,
+		limitSwitchSteps: profile.limitSwitchSteps()}
 
-	err = newAR3.clearBuffer()
+	err := newAR3.clearBuffer()
 	if err != nil {
-		return &newAR3, err
+		return newAR3, err
 	}
+	newAR3.startLoop()
 
 	// Test to see if we can connect to the newAR3
 	err = newAR3.Echo()
 	if err != nil {
-		return &newAR3, err
+		return newAR3, err
 	}
 
 	// If we can echo, return newAR3 object
-	return &newAR3, nil
+	return newAR3, nil
 }
 
 // Echo tests an echo command on the AR3. Useful for testing connectivity to
 // the AR3.
 func (ar3 *AR3exec) Echo() error {
-	// Send echo to the device
-	str := "Test"
-	stringToSend := fmt.Sprintf("TM%s\n", str)
-	_, err := ar3.serial.Write([]byte(stringToSend))
-	if err != nil {
-		return err
-	}
+	return ar3.EchoContext(context.Background())
+}
 
-	// Read output of echo
-	buf := make([]byte, 128)
-	n, err := ar3.serial.Read(buf)
+// EchoContext is Echo, giving up when ctx is done.
+func (ar3 *AR3exec) EchoContext(ctx context.Context) error {
+	return ar3.do(ctx, func() error { return ar3.echo(ctx) })
+}
+
+// echo is Echo, run on the command loop.
+func (ar3 *AR3exec) echo(ctx context.Context) error {
+	// Send echo to the device and read its output. The transport strips the
+	// line endings that the AR3 appends to the echoed string.
+	str := "Test"
+	stringOutput, err := ar3.exchange(ctx, protocol.EchoCommand{Text: str}.Encode())
 	if err != nil {
 		return err
 	}
 
-	// Double check to make sure the length is > 1
-	if n < 2 {
+	// Double check to make sure the response is not empty
+	if stringOutput == "" {
 		return fmt.Errorf("return from echo is empty")
 	}
 
 	// See if we had the same bytes returned
-	// Note: the serial returns with your string with \n\r\n between two double-quotes ("), so we remove these characters
-	stringOutput := fmt.Sprintf("%q", buf[:n])
-	stringOutput = stringOutput[1 : len(stringOutput)-7]
 	if stringOutput != str {
 		return fmt.Errorf("failed echo to AR3. Expected %s but got %s", str, stringOutput)
 	}
@@ -234,126 +255,176 @@ func (ar3 *AR3exec) Echo() error {
 	return nil
 }
 
+// Close closes the connection to the AR3. Queued moves are flushed, even if
+// paused, a command waiting on the AR3 fails, and later commands return
+// ErrTransportClosed.
+func (ar3 *AR3exec) Close() error {
+	ar3.queue.flush()
+	err := ar3.serial.Close()
+	ar3.stopLoop()
+	return err
+}
+
 // moveSteppersRelative moves each of the AR3's stepper motors by a certain
-// amount of steps. In addition to the j1,j2,j3,j4,j5,j6 positions, you can also
-// define 5 other variables: ACCdur, ACCspd, DCCdur, and DCCspd (these are named
-// DEC on ARCS but DCC on the arduino controller), which define the acceleration
-// duration and speed of the stepper motors. Good defaults are:
-//  speed: 25 (line 7941 on ARCS)
-//  accdur: 15 (line 7942 on ARCS)
-//  accspd: 10 (line 7943 on ARCS)
-//  dccdur: 20 (line 7944 on ARCS)
-//  dccspd: 5 (line 7945 on ARCS)
+// amount of steps. In addition to the j1,j2,j3,j4,j5,j6 positions, the
+// MoveParams define the speed along with the acceleration and deceleration
+// duration and speed of the stepper motors. See MoveParams for good defaults.
 //
-// Tr is also an active variable that can be changed. It is for controlling
-// the AR3 arm on a track, but it would appear that has not been implemented.
-// Unless you know what you're doing, please keep this variable at 0.
-func (ar3 *AR3exec) moveSteppersRelative(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error {
-	// First, check if the move can be made
-	to := []int{j1, j2, j3, j4, j5, j6}
-	from := []int{ar3.jointVals[0], ar3.jointVals[1], ar3.jointVals[2], ar3.jointVals[3], ar3.jointVals[4], ar3.jointVals[5]}
-
-	limits := []int{j1stepLim, j2stepLim, j3stepLim, j4stepLim, j5stepLim, j6stepLim}
-
-	motor := []string{"J1", "J2", "J3", "J4", "J5", "J6"}
-	var newPositions [7]int
-	for i := 0; i < 6; i++ {
-		newJ := to[i] + from[i]
-		lowerLimit := 0
-		upperLimit := limits[i]
-		if !calibDirs[i] {
-			lowerLimit = -upperLimit
-			upperLimit = 0
-		}
-		if newJ < lowerLimit || newJ > upperLimit {
-			return fmt.Errorf("%s out of range. Must be between %d and %d. Got %d", motor[i], lowerLimit, upperLimit, newJ)
-		}
-		newPositions[i] = newJ
+// Tr is the number of steps to move the arm along its linear track. Arms whose
+// profile has no track must keep this variable at 0.
+func (ar3 *AR3exec) moveSteppersRelative(ctx context.Context, params MoveParams, j1, j2, j3, j4, j5, j6, tr int) error {
+	relative := [7]int{j1, j2, j3, j4, j5, j6, tr}
+	if err := ar3.checkMoves(relative); err != nil {
+		return err
 	}
-	// If all the limits check out, apply them.
-	ar3.jointVals = newPositions
-
-	// command string for movement is MJ
-	command := "MJ"
-	// First, compute direction. If the stepper is negative, that means that
-	// direction is set to 1. We are going to compute these as a list, and then
-	// append them to a growing string
-	var jdirection int
-	// The move string is assembled with the beginning of an alphabetical
-	// character for each axis. These were derived from line 4493 in the ARCS
-	// source file under the variable "commandCalc".
-	alphabetForCommands := []string{"A", "B", "C", "D", "E", "F", "T"}
-
-	// directions need to be set as well
-	for i, j := range []int{j1, j2, j3, j4, j5, j6, tr} {
-		jdirection = 0
-
-		if j < 0 {
-			jdirection = 1
-			j = -1 * j
-		}
-
-		// We also have to compensate for the direction coded when initializing
-		// the AR3 (as oftentimes, this can be off)
-		if ar3.jointDirs[i] {
-			tempDir := 0
-			switch jdirection {
-			case 1:
-				tempDir = 0
-			case 0:
-				tempDir = 1
-			}
-			jdirection = tempDir
-		}
-		command = command + fmt.Sprintf("%s%d%d", alphabetForCommands[i], jdirection, j)
+	stops := ar3.stopCount()
+	err := ar3.sendMove(ctx, params, relative)
+	if err != nil {
+		return err
 	}
 
-	// We now have the axis commands, so we need to add the speed, accspd, accdur, dccdur, and dccspd.
-	// These are also derived from the above commandCalc.
-	command = command + fmt.Sprintf("S%dG%dH%dI%dK%d\n", speed, accspd, accdur, dccdur, dccspd)
-
-	// Send command to AR3
-	_, err := ar3.serial.Write([]byte(command))
+	// This has to send and get a response to indicate the move is complete
+	err = ar3.echo(ctx)
 	if err != nil {
 		return err
 	}
+	if err = ar3.checkStopped(stops); err != nil {
+		return err
+	}
 
-	err = ar3.readBuffer()
-	if err != nil {
+	// The AR3 code has no way to report successful completion, but the
+	// encoders can tell us whether the joints ended up where we sent them.
+	return ar3.checkEncoders(ctx)
+}
+
+// sendMove sends a single move of each axis by relative steps, without
+// waiting for the arm to finish it.
+func (ar3 *AR3exec) sendMove(ctx context.Context, params MoveParams, relative [7]int) error {
+	if err := params.Validate(); err != nil {
 		return err
 	}
 
-	// This has to send and get a response to indicate the move is complete
-	err = ar3.Echo()
+	// First, check if the move can be made
+	ar3.mu.Lock()
+	var err error
+	if !ar3.uncalibratedMotion {
+		err = ar3.profile.calibrationError(ar3.calibrated)
+	}
+	var newPositions [7]int
+	if err == nil {
+		newPositions, err = ar3.profile.checkStepLimits(ar3.jointVals, relative)
+	}
+	if err == nil {
+		// If all the limits check out, apply them.
+		ar3.jointVals = newPositions
+	}
+	jointDirs := ar3.jointDirs
+	ar3.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	// Normally, we would check here for successful completion. However, there
-	// IS no way to check for successful completion implemented in the AR3 code.
-	// So we do not check for this.
-	return nil
+	// The command is assembled with a direction bit and step count for
+	// each axis. If the stepper is negative, that means that direction is
+	// set to 1.
+	command := protocol.MoveCommand{Speed: params.Speed, AccDur: params.AccDur,
+		AccSpd: params.AccSpd, DccDur: params.DccDur, DccSpd: params.DccSpd}
+	for i, j := range relative {
+		reverse := j < 0
+		if reverse {
+			j = -1 * j
+		}
+
+		// We also have to compensate for the direction coded when initializing
+		// the AR3 (as oftentimes, this can be off)
+		if jointDirs[i] {
+			reverse = !reverse
+		}
+		command.Axes[i] = protocol.Axis{Reverse: reverse, Steps: j}
+	}
+
+	// Send command to AR3
+	if _, err = ar3.exchange(ctx, command.Encode()); err != nil {
+		// The arm may have stopped anywhere along the move, so every joint
+		// it was moving must be calibrated again.
+		ar3.mu.Lock()
+		for i, steps := range relative {
+			if steps != 0 {
+				ar3.calibrated[i] = false
+			}
+		}
+		ar3.mu.Unlock()
+	}
+	return err
 }
 
 // MoveSteppers moves each of the AR3's stepper motors to a relative
 // step position between 0 and the step limit for each joint. See
 // moveSteppersRelative for full documentation of arguments.
 func (ar3 *AR3exec) MoveSteppers(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error {
-	js := ar3.jointVals
-	sl := ar3.limitSwitchSteps
-	return ar3.moveSteppersRelative(speed, accdur, accspd, dccdur, dccspd,
+	return ar3.MoveSteppersContext(context.Background(), speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr)
+}
+
+// MoveSteppersContext is MoveSteppers, giving up when ctx is done.
+func (ar3 *AR3exec) MoveSteppersContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error {
+	params := positionalParams(speed, accdur, accspd, dccdur, dccspd)
+	return ar3.do(ctx, func() error {
+		return ar3.moveSteppers(ctx, params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// MoveSteppersWithParams is MoveSteppers, with the speed and acceleration
+// given as MoveParams.
+func (ar3 *AR3exec) MoveSteppersWithParams(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		return ar3.moveSteppers(ctx, params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// moveSteppers converts absolute step positions into a relative move.
+func (ar3 *AR3exec) moveSteppers(ctx context.Context, params MoveParams, j1, j2, j3, j4, j5, j6, tr int) error {
+	js := ar3.CurrentStepperPosition()
+	sl := ar3.LimitSwitchSteps()
+	return ar3.moveSteppersRelative(ctx, params,
 		j1-js[0]+sl[0], j2-js[1]+sl[1], j3-js[2]+sl[2], j4-js[3]+sl[3],
 		j5-js[4]+sl[4], j6-js[5]+sl[5], tr-js[6]+sl[6])
 }
 
 // MoveJointRadians moves each of the AR3's joints to an absolute angle
 // defined relative to the calibration position for each joint. Angles are
-// defined as radians here.
+// defined as radians here. The track position tr is in millimeters from the
+// track's limit switch.
 func (ar3 *AR3exec) MoveJointRadians(speed, accdur, accspd, dccdur, dccspd int, j1, j2, j3, j4, j5, j6, tr float64) error {
+	return ar3.MoveJointRadiansContext(context.Background(), speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr)
+}
+
+// MoveJointRadiansContext is MoveJointRadians, giving up when ctx is done.
+func (ar3 *AR3exec) MoveJointRadiansContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd int, j1, j2, j3, j4, j5, j6, tr float64) error {
+	params := positionalParams(speed, accdur, accspd, dccdur, dccspd)
+	return ar3.do(ctx, func() error {
+		return ar3.moveJointRadians(ctx, params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// MoveJointRadiansWithParams is MoveJointRadians, with the speed and
+// acceleration given as MoveParams.
+func (ar3 *AR3exec) MoveJointRadiansWithParams(params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		return ar3.moveJointRadians(ctx, params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
 
-	jointSteps := anglesToSteps([7]float64{j1, j2, j3, j4, j5, j6, tr}, false)
+// moveJointRadians converts joint angles into absolute step positions.
+func (ar3 *AR3exec) moveJointRadians(ctx context.Context, params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) error {
 
-	return ar3.MoveSteppers(speed, accdur, accspd, dccdur, dccspd,
+	jointSteps, err := ar3.Profile().jointsToSteps([7]float64{j1, j2, j3, j4, j5, j6, tr})
+	if err != nil {
+		return err
+	}
+
+	return ar3.moveSteppers(ctx, params,
 		jointSteps[0], jointSteps[1], jointSteps[2], jointSteps[3],
 		jointSteps[4], jointSteps[5], jointSteps[6])
 }
@@ -361,73 +432,120 @@ func (ar3 *AR3exec) MoveJointRadians(speed, accdur, accspd, dccdur, dccspd int,
 // Move to a new end effector Pose using inverse kinematics to solve for the
 // joint angles.
 func (ar3 *AR3exec) Move(speed, accdur, accspd, dccdur, dccspd int, pose kinematics.Pose) error {
-	ja := ar3.CurrentJointRadians()
-	thetasInit := []float64{ja[0], ja[1], ja[2], ja[3], ja[4], ja[5]}
-	tj, err := kinematics.InverseKinematics(pose, AR3DhParameters, thetasInit)
+	return ar3.MoveContext(context.Background(), speed, accdur, accspd, dccdur, dccspd, pose)
+}
+
+// MoveContext is Move, giving up when ctx is done.
+func (ar3 *AR3exec) MoveContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd int, pose kinematics.Pose) error {
+	params := positionalParams(speed, accdur, accspd, dccdur, dccspd)
+	return ar3.do(ctx, func() error { return ar3.move(ctx, params, pose) })
+}
+
+// MoveWithParams is Move, with the speed and acceleration given as
+// MoveParams.
+func (ar3 *AR3exec) MoveWithParams(params MoveParams, pose kinematics.Pose) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error { return ar3.move(ctx, params, pose) })
+}
+
+// move solves inverse kinematics for pose, seeded from the current joints,
+// leaving the track where it is.
+func (ar3 *AR3exec) move(ctx context.Context, params MoveParams, pose kinematics.Pose) error {
+	return ar3.moveTrack(ctx, params, pose, ar3.CurrentJointRadians()[6], 0)
+}
+
+// moveTrack solves inverse kinematics for the TCP pose in the arm's base
+// frame, and moves the track to the track position in millimeters. Of the
+// solutions hint allows, the one within the joint limits and nearest the
+// current joints is used.
+func (ar3 *AR3exec) moveTrack(ctx context.Context, params MoveParams, pose kinematics.Pose, track float64, hint ConfigurationHint) error {
+	tj, err := ar3.Profile().solvePose(ar3.CurrentTool().flangePose(pose), ar3.CurrentJointRadians(), hint)
 	if err != nil {
-		return fmt.Errorf("inverse kinematics failed with error: %s", err)
+		return err
 	}
-	return ar3.MoveJointRadians(speed, accdur, accspd, dccdur,
-		dccspd, tj[0], tj[1], tj[2], tj[3], tj[4], tj[5], 0)
+	speeds, err := ar3.CurrentSingularityPolicy().speeds([][6]float64{tj}, ar3.Profile().DhParameters)
+	if err != nil {
+		return err
+	}
+	params = slowParams(params, speeds[0])
+	return ar3.moveJointRadians(ctx, params, tj[0], tj[1], tj[2], tj[3], tj[4], tj[5], track)
 }
 
 // Calibrate moves each of the AR3's stepper motors to their respective limit
 // switch. A good default speed for this action is 50 (line 4659 on ARCS). Set
 // the j1 -> j6 booleans "true" if that joint should be homed. Set the
 // j1calibdir -> j6calibdir booleans "true" if the calibration direction should
-// be in the negative axis direction.
+// be in the negative axis direction. Each homed joint is zeroed and marked
+// calibrated once the AR3 answers that calibration passed. If it fails, times
+// out or is stopped, the homed joints are marked not calibrated.
 func (ar3 *AR3exec) Calibrate(speed int, j1, j2, j3, j4, j5, j6, tr bool) error {
-	// command string for home is LL
-	command := "LL"
+	return ar3.CalibrateContext(context.Background(), speed, j1, j2, j3, j4, j5, j6, tr)
+}
 
-	// The home string is assembled with the beginning of an alphabetical
-	// character for each axis. These were derived from line 4493 in the ARCS
-	// source file under the variable "commandCalc".
-	alphabetForCommands := []string{"A", "B", "C", "D", "E", "F", "T"}
-	jmotors := []int{j1stepLim, j2stepLim, j3stepLim, j4stepLim, j5stepLim, j6stepLim, 0}
+// CalibrateContext is Calibrate, giving up when ctx is done.
+func (ar3 *AR3exec) CalibrateContext(ctx context.Context, speed int, j1, j2, j3, j4, j5, j6, tr bool) error {
+	return ar3.do(ctx, func() error {
+		return ar3.calibrate(ctx, speed, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
 
+// calibrate is Calibrate, run on the command loop.
+func (ar3 *AR3exec) calibrate(ctx context.Context, speed int, j1, j2, j3, j4, j5, j6, tr bool) error {
+	profile := ar3.Profile()
+	sl := profile.StepLimits
+	jmotors := []int{sl[0], sl[1], sl[2], sl[3], sl[4], sl[5], profile.TrackStepLimit}
+	calibDirs := profile.CalibDirs
+
+	command := protocol.CalibrateCommand{Speed: speed}
 	homeMotor := []bool{j1, j2, j3, j4, j5, j6, tr}
+	ar3.mu.Lock()
 	for i := range ar3.jointDirs {
 		// First, we check if we need to home the motor. If we do not (false),
 		// do not home the motor.
 		if homeMotor[i] {
 			// Each direction is set by the boolean and appended into the
-			// calibrate string. The number of steps taken is equivalent to the
-			// step limits, which are hardcoded into the AR3 arm.
-			dirBit := !(ar3.jointDirs[i] != calibDirs[i])
-			if dirBit {
-				command = command + fmt.Sprintf("%s%d%d", alphabetForCommands[i], 0, jmotors[i])
-			} else {
-				command = command + fmt.Sprintf("%s%d%d", alphabetForCommands[i], 1, jmotors[i])
+			// calibrate command. The number of steps taken is equivalent to
+			// the step limits, which are hardcoded into the AR3 arm.
+			calibDir := profile.TrackCalibDir
+			if i < 6 {
+				calibDir = calibDirs[i]
 			}
-			ar3.jointVals[i] = 0
-		} else {
-			command = command + fmt.Sprintf("%s%d%d", alphabetForCommands[i], 0, 0)
+			command.Axes[i] = protocol.Axis{Reverse: ar3.jointDirs[i] != calibDir, Steps: jmotors[i]}
 		}
 	}
-	// Finally, we append the speed.
-	command = command + fmt.Sprintf("S%d\n", speed)
+	stops := ar3.stops
+	ar3.mu.Unlock()
 
 	// Send command to AR3
-	_, err := ar3.serial.Write([]byte(command))
-
-	if err != nil {
-		return err
+	response, err := ar3.exchange(ctx, command.Encode())
+	if err == nil && response != protocol.CalibratePass {
+		err = fmt.Errorf("AR3 failed to calibrate. Got response %q", response)
 	}
 
-	err = ar3.readBuffer()
-	if err != nil {
-		return err
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	if err == nil && ar3.stops != stops {
+		err = ErrStopped
 	}
-
-	// Normally, we would check here for successful completion. However, there IS no way to check for
-	// successful completion implemented in the AR3 code. So we do not check for this.
-	return nil
+	for i := range homeMotor {
+		if !homeMotor[i] {
+			continue
+		}
+		// A homed joint that did not reach its switch may have moved
+		// anywhere on the way.
+		ar3.calibrated[i] = err == nil
+		if err == nil {
+			ar3.jointVals[i] = 0
+		}
+	}
+	return err
 }
 
 // CurrentStepperPosition returns the current position of the AR3 arm as stepper
 // motor steps from the zeroed value for each axis.
 func (ar3 *AR3exec) CurrentStepperPosition() [7]int {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	return ar3.jointVals
 }
 
@@ -436,18 +554,22 @@ func (ar3 *AR3exec) CurrentStepperPosition() [7]int {
 // limit switch zeroed positions, as these values are offset by the
 // limitSwitchSteps array.
 func (ar3 *AR3exec) CurrentJointRadians() [7]float64 {
-	js := ar3.jointVals
-	sl := ar3.limitSwitchSteps
+	ar3.mu.Lock()
+	js, sl, profile := ar3.jointVals, ar3.limitSwitchSteps, ar3.profile
+	ar3.mu.Unlock()
 	stepVals := [7]int{js[0] - sl[0], js[1] - sl[1], js[2] - sl[2], js[3] - sl[3], js[4] - sl[4], js[5] - sl[5], js[6] - sl[6]}
-	jointVals := stepsToAngles(stepVals, false)
+	jointVals := profile.stepsToAngles(stepVals, false)
 	return jointVals
 }
 
 // SetJointRadians sets the joint values of the robot given an array of joint
 // values in Radians. WARNING: This rounds the radian values for joints to the
-// nearest step, and therefore may not be exactly translated.
+// nearest step, and therefore may not be exactly translated. It does not
+// mark the joints calibrated.
 func (ar3 *AR3exec) SetJointRadians(joints [7]float64) {
-	jointSteps := anglesToSteps(joints, false)
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	jointSteps := ar3.profile.anglesToSteps(joints, false)
 
 	sl := ar3.limitSwitchSteps
 	relSteps := [7]int{
@@ -455,63 +577,36 @@ func (ar3 *AR3exec) SetJointRadians(joints [7]float64) {
 		jointSteps[4] + sl[4], jointSteps[5] + sl[5], jointSteps[6] + sl[6]}
 
 	ar3.jointVals = relSteps
-
 }
 
-// CurrentPose returns the current Pose of the robot, using forward kinematics
-// on the DH parameters and current joint angles.
+// CurrentPose returns the current Pose of the robot's TCP, using forward
+// kinematics on the DH parameters and current joint angles. Without a tool
+// set, the TCP is the flange.
 func (ar3 *AR3exec) CurrentPose() kinematics.Pose {
 	ja := ar3.CurrentJointRadians()
 	thetasInit := []float64{ja[0], ja[1], ja[2], ja[3], ja[4], ja[5]}
-	return kinematics.ForwardKinematics(thetasInit, AR3DhParameters)
+	return ar3.CurrentTool().tcpPose(kinematics.ForwardKinematics(thetasInit, ar3.Profile().DhParameters))
 }
 
-// stepsToAngles converts number of steps into angles using the steps to angle
-// conversion for each joint.
-func stepsToAngles(steps [7]int, deg bool) [7]float64 {
-	var conv float64
-	if deg {
-		conv = degreesToRadians
-	} else {
-		conv = 1
-	}
-	jointAngles := [7]float64{
-		j1RadStep * float64(steps[0]) / conv,
-		j2RadStep * float64(steps[1]) / conv,
-		j3RadStep * float64(steps[2]) / conv,
-		j4RadStep * float64(steps[3]) / conv,
-		j5RadStep * float64(steps[4]) / conv,
-		j6RadStep * float64(steps[5]) / conv,
-		trMmStep * float64(steps[6]) / conv}
-	return jointAngles
-}
-
-// anglesToSteps converts joint angles to number of stepper steps
-func anglesToSteps(angles [7]float64, deg bool) [7]int {
-	var conv float64
-	if deg {
-		conv = degreesToRadians
-	} else {
-		conv = 1
-	}
-	jointSteps := [7]int{
-		int(math.Round(conv * angles[0] / j1RadStep)),
-		int(math.Round(conv * angles[1] / j2RadStep)),
-		int(math.Round(conv * angles[2] / j3RadStep)),
-		int(math.Round(conv * angles[3] / j4RadStep)),
-		int(math.Round(conv * angles[4] / j5RadStep)),
-		int(math.Round(conv * angles[5] / j6RadStep)),
-		int(math.Round(conv * angles[6] / trMmStep))}
-	return jointSteps
+// Profile returns the RobotProfile the AR3 was connected with, with any
+// limit switch offsets set by SetLimitSwitchSteps.
+func (ar3 *AR3exec) Profile() RobotProfile {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.profile
 }
 
 // SetDirections sets the directions of the AR3 arm.
 func (ar3 *AR3exec) SetDirections(jointDirs [7]bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	ar3.jointDirs = jointDirs
 }
 
 // GetDirections gets the directions of the AR3 arm.
 func (ar3 *AR3exec) GetDirections() [7]bool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	return ar3.jointDirs
 }
 
@@ -12,3 +12,77 @@ func TestArmInterface(t *testing.T) {
 		t.Errorf("Failed. Ar3exec does not implement the Arm interface")
 	}
 }
+
+// connectMemory connects an AR3exec to a MemoryTransport that answers like
+// an idle AR3. Uncalibrated motion is allowed, so that the only command sent
+// before a test's own is the echo made by connecting.
+func connectMemory(t *testing.T) (*AR3exec, *MemoryTransport) {
+	t.Helper()
+	mt := NewMemoryTransport(EchoResponder)
+	arm, err := ConnectTransport(mt, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect over memory transport. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	return arm.(*AR3exec), mt
+}
+
+func TestConnectTransport(t *testing.T) {
+	_, mt := connectMemory(t)
+	commands := mt.Commands()
+	if len(commands) != 1 || commands[0] != "TMTest" {
+		t.Errorf("Connect should send a single echo. Got %v", commands)
+	}
+}
+
+func TestConnectTransportBadEcho(t *testing.T) {
+	mt := NewMemoryTransport(func(command string) []string { return []string{"Nope"} })
+	_, err := ConnectTransport(mt, [7]bool{}, AR3Profile)
+	if err == nil {
+		t.Errorf("Connect should fail when the echo does not match")
+	}
+}
+
+func TestAR3exec_MoveSteppers(t *testing.T) {
+	arm, mt := connectMemory(t)
+	err := arm.MoveSteppers(25, 15, 10, 20, 5, 500, 500, 500, 500, 500, 500, 0)
+	if err != nil {
+		t.Errorf("Arm should succeed with initial move. Got error: %s", err)
+	}
+	commands := mt.Commands()
+	if len(commands) != 3 || commands[2] != "TMTest" {
+		t.Fatalf("Move should send a single move followed by an echo. Got %v", commands)
+	}
+	expected := "MJA17056B05222C12833D17282E02405F07755T00S25G10H15I20K5"
+	if commands[1] != expected {
+		t.Errorf("Move should send %s. Got %s", expected, commands[1])
+	}
+	js := arm.CurrentStepperPosition()
+	if js != [7]int{-7056, 5222, -2833, -7282, 2405, 7755, js[6]} {
+		t.Errorf("Steppers should be 500 steps from the limit switches. Got %v", js)
+	}
+}
+
+func TestAR3exec_MoveSteppersTooLarge(t *testing.T) {
+	arm, mt := connectMemory(t)
+	err := arm.MoveSteppers(25, 15, 10, 20, 5, 500, 500, 500, 500, 500, 500000000, 0)
+	if err == nil {
+		t.Errorf("Arm should have failed with large j6 value")
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for a rejected move. Got %v", mt.Commands())
+	}
+}
+
+func TestAR3exec_Calibrate(t *testing.T) {
+	arm, mt := connectMemory(t)
+	err := arm.Calibrate(25, true, true, true, true, true, true, false)
+	if err != nil {
+		t.Errorf("Calibrate should succeed. Got error: %s", err)
+	}
+	commands := mt.Commands()
+	expected := "LLA015200B114600C07850D015200E14575F114936T00S25"
+	if commands[len(commands)-1] != expected {
+		t.Errorf("Calibrate should send %s. Got %s", expected, commands[len(commands)-1])
+	}
+}
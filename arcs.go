@@ -0,0 +1,209 @@
+package ar3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ARCSCalibration is an ARbot.cal calibration file, as saved by the Windows
+// ARCS software. ARCS keeps its calibration in a list box of strings, and saves
+// the list as a Python pickle, so the file is read and written by position.
+// Values this package has no use for, such as the saved positions, COM port
+// and frames, are kept as they are so the file can be written back for ARCS.
+type ARCSCalibration struct {
+	Values []string
+}
+
+// Positions in ARbot.cal of the values mapped onto the Go configuration, as
+// laid out by the AR3 version of ARCS.
+const (
+	// arcsAngleLimits holds the negative angle limit, positive angle limit,
+	// both in degrees, and step limit of each joint in turn, J1 first.
+	arcsAngleLimits = 35
+	// arcsCalOffsets holds the degrees each joint's limit switch is offset
+	// from its angle limit, J1 first.
+	arcsCalOffsets = 59
+	// arcsMotorDirs holds "1" for each joint whose motor is reversed.
+	arcsMotorDirs = 65
+	// arcsCalDirs holds "1" for each joint whose limit switch is at its
+	// positive angle limit.
+	arcsCalDirs = 71
+	// arcsValues is the number of values up to and including the last used.
+	arcsValues = 77
+)
+
+// LoadARCSCalibration reads an ARbot.cal file.
+func LoadARCSCalibration(path string) (ARCSCalibration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ARCSCalibration{}, err
+	}
+	return ParseARCSCalibration(data)
+}
+
+// ParseARCSCalibration parses the contents of an ARbot.cal file. Files pickled
+// by either Python 2 or Python 3 ARCS can be read.
+func ParseARCSCalibration(data []byte) (ARCSCalibration, error) {
+	values, err := unpickleStrings(data)
+	if err != nil {
+		return ARCSCalibration{}, fmt.Errorf("error parsing ARCS calibration: %w", err)
+	}
+	return ARCSCalibration{Values: values}, nil
+}
+
+// Save writes the calibration to path as an ARbot.cal file.
+func (c ARCSCalibration) Save(path string) error {
+	return os.WriteFile(path, c.Encode(), 0644)
+}
+
+// Encode returns the calibration as the contents of an ARbot.cal file: a
+// pickled tuple of strings, using pickle protocol 2 so that ARCS can read it
+// under either Python 2 or Python 3.
+func (c ARCSCalibration) Encode() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{pickleProto, 2, pickleMark})
+	for _, v := range c.Values {
+		b.WriteByte(pickleBinUnicode)
+		binary.Write(&b, binary.LittleEndian, uint32(len(v)))
+		b.WriteString(v)
+	}
+	b.Write([]byte{pickleTuple, pickleStop})
+	return b.Bytes()
+}
+
+// Profile returns a copy of base with the step limits, radians per step,
+// calibration directions and limit switch angles of the calibration. The
+// geometry and track are kept from base.
+func (c ARCSCalibration) Profile(base RobotProfile) (RobotProfile, error) {
+	if len(c.Values) < arcsValues {
+		return base, fmt.Errorf("ARCS calibration has %d values, want at least %d", len(c.Values), arcsValues)
+	}
+	p := base
+	for i := 0; i < 6; i++ {
+		negative, err := c.float(arcsAngleLimits + 3*i)
+		if err != nil {
+			return base, err
+		}
+		positive, err := c.float(arcsAngleLimits + 3*i + 1)
+		if err != nil {
+			return base, err
+		}
+		stepLimit, err := c.int(arcsAngleLimits + 3*i + 2)
+		if err != nil {
+			return base, err
+		}
+		offset, err := c.float(arcsCalOffsets + i)
+		if err != nil {
+			return base, err
+		}
+		switchAtPositive, err := c.bool(arcsCalDirs + i)
+		if err != nil {
+			return base, err
+		}
+		if stepLimit <= 0 {
+			return base, fmt.Errorf("J%d step limit must be positive. Got %d", i+1, stepLimit)
+		}
+		p.StepLimits[i] = stepLimit
+		p.RadPerStep[i] = (positive - negative) / float64(stepLimit) * degreesToRadians
+		// Joints travel away from their limit switch, and the profile
+		// gives the angle of the switch negated.
+		p.CalibDirs[i] = !switchAtPositive
+		switchAngle := negative
+		if switchAtPositive {
+			switchAngle = positive
+		}
+		p.LimitSwitchDegrees[i] = -(switchAngle + offset)
+	}
+	return p, p.Validate()
+}
+
+// JointDirs returns the joint directions of the calibration, as taken by
+// Connect. ARCS has no track, so the track is never reversed.
+func (c ARCSCalibration) JointDirs() ([7]bool, error) {
+	var jointDirs [7]bool
+	if len(c.Values) < arcsValues {
+		return jointDirs, fmt.Errorf("ARCS calibration has %d values, want at least %d", len(c.Values), arcsValues)
+	}
+	for i := 0; i < 6; i++ {
+		reversed, err := c.bool(arcsMotorDirs + i)
+		if err != nil {
+			return jointDirs, err
+		}
+		jointDirs[i] = reversed
+	}
+	return jointDirs, nil
+}
+
+// WithProfile returns a copy of the calibration with the angle limits, step
+// limits, calibration offsets and directions set from a profile and the joint
+// directions it is connected with, so ARCS drives the arm as this package
+// does. A calibration without enough values is padded with "0".
+func (c ARCSCalibration) WithProfile(p RobotProfile, jointDirs [7]bool) ARCSCalibration {
+	values := make([]string, len(c.Values))
+	copy(values, c.Values)
+	for len(values) < arcsValues {
+		values = append(values, "0")
+	}
+	for i := 0; i < 6; i++ {
+		travel := float64(p.StepLimits[i]) * p.RadPerStep[i] / degreesToRadians
+		negative := -p.LimitSwitchDegrees[i]
+		positive := negative + travel
+		if !p.CalibDirs[i] {
+			positive = -p.LimitSwitchDegrees[i]
+			negative = positive - travel
+		}
+		values[arcsAngleLimits+3*i] = formatARCSFloat(negative)
+		values[arcsAngleLimits+3*i+1] = formatARCSFloat(positive)
+		values[arcsAngleLimits+3*i+2] = strconv.Itoa(p.StepLimits[i])
+		values[arcsCalOffsets+i] = "0"
+		values[arcsMotorDirs+i] = formatARCSBool(jointDirs[i])
+		values[arcsCalDirs+i] = formatARCSBool(!p.CalibDirs[i])
+	}
+	return ARCSCalibration{Values: values}
+}
+
+func (c ARCSCalibration) float(i int) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(c.Values[i]), 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("ARCS calibration value %d should be a number. Got %q", i, c.Values[i])
+	}
+	return v, nil
+}
+
+func (c ARCSCalibration) int(i int) (int, error) {
+	v, err := c.float(i)
+	if err != nil {
+		return 0, err
+	}
+	if v != math.Trunc(v) {
+		return 0, fmt.Errorf("ARCS calibration value %d should be a whole number. Got %q", i, c.Values[i])
+	}
+	return int(v), nil
+}
+
+func (c ARCSCalibration) bool(i int) (bool, error) {
+	v, err := c.int(i)
+	if err != nil {
+		return false, err
+	}
+	if v != 0 && v != 1 {
+		return false, fmt.Errorf("ARCS calibration value %d should be 0 or 1. Got %q", i, c.Values[i])
+	}
+	return v == 1, nil
+}
+
+func formatARCSFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatARCSBool(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
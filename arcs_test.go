@@ -0,0 +1,160 @@
+package ar3
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseARCSCalibration(t *testing.T) {
+	// Pickled by Python 2 and Python 3 with each protocol ARCS may have used.
+	pickles := map[string]struct {
+		data string
+		want []string
+	}{
+		"python 2 protocol 0": {
+			"(S'COM3'\np0\nS'C:\\\\ARCS\\\\Prog'\np1\nS\"it's\"\np2\nS'tab\\there'\np3\nS'caf\\xe9'\np4\nI1\nF1.5\nI01\ntp5\n.",
+			[]string{"COM3", `C:\ARCS\Prog`, "it's", "tab\there", "café", "1", "1.5", "1"},
+		},
+		"python 2 protocol 2": {
+			"\x80\x02(U\x04COM3q\x00U\x04caf\xe9q\x01T\x00\x01\x00\x00" + strings.Repeat("x", 256) + "q\x02U\x04-170q\x03tq\x04.",
+			[]string{"COM3", "café", strings.Repeat("x", 256), "-170"},
+		},
+		"python 3 protocol 0": {
+			"(VCOM3\np0\nVC:\\u005cARCS\\u005cProg\np1\nV-170\np2\ntp3\n.",
+			[]string{"COM3", `C:\ARCS\Prog`, "-170"},
+		},
+		"python 3 protocol 3": {
+			"\x80\x03(X\x04\x00\x00\x00COM3q\x00X\x01\x00\x00\x000q\x01h\x01X\x04\x00\x00\x00-170q\x02tq\x03.",
+			[]string{"COM3", "0", "0", "-170"},
+		},
+		"python 3 protocol 4 list": {
+			"\x80\x04\x95\x19\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x04COM3\x94\x8c\x010\x94h\x02\x8c\x04-170\x94e.",
+			[]string{"COM3", "0", "0", "-170"},
+		},
+		"python 3 numbers": {
+			"\x80\x02]q\x00(X\x04\x00\x00\x00COM3q\x01K\x01G?\xf8\x00\x00\x00\x00\x00\x00JV\xff\xff\xffJp\x11\x01\x00e.",
+			[]string{"COM3", "1", "1.5", "-170", "70000"},
+		},
+	}
+	for name, p := range pickles {
+		c, err := ParseARCSCalibration([]byte(p.data))
+		if err != nil {
+			t.Errorf("%s should parse. Got error: %s", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Values, p.want) {
+			t.Errorf("%s should parse to %q. Got %q", name, p.want, c.Values)
+		}
+	}
+
+	for _, data := range []string{"", "\x80\x03(X\x04\x00\x00\x00COM", "\x80\x03(X\x04\x00\x00\x00COM3t", "\x80\x03}q\x00.", "(S'COM3\ntp0\n.", "(S'COM3\\x4'\ntp0\n."} {
+		if _, err := ParseARCSCalibration([]byte(data)); err == nil {
+			t.Errorf("%q should not parse", data)
+		}
+	}
+}
+
+// arcsAR3 returns an ARbot.cal for an AR3 as ARCS tunes it, with J1 and J4
+// reversed.
+func arcsAR3() ARCSCalibration {
+	values := make([]string, 90)
+	for i := range values {
+		values[i] = "0"
+	}
+	values[12] = "COM3"
+	limits := [6][3]string{
+		{"-170", "170", "15200"},
+		{"-42.5", "89.5", "14600"},
+		{"-89", "52", "7850"},
+		{"-165", "165", "15200"},
+		{"-105", "105", "4575"},
+		{"-155", "155", "14936"},
+	}
+	for i, l := range limits {
+		copy(values[arcsAngleLimits+3*i:], l[:])
+	}
+	copy(values[arcsCalOffsets:], []string{"0", "0", "8", "0", "0", "0"})
+	copy(values[arcsMotorDirs:], []string{"1", "0", "0", "1", "0", "0"})
+	copy(values[arcsCalDirs:], []string{"1", "0", "1", "1", "0", "0"})
+	return ARCSCalibration{Values: values}
+}
+
+func TestARCSCalibration_Profile(t *testing.T) {
+	p, err := arcsAR3().Profile(AR3Profile)
+	if err != nil {
+		t.Fatalf("Calibration should make a profile. Got error: %s", err)
+	}
+	if p.StepLimits != [6]int{15200, 14600, 7850, 15200, 4575, 14936} {
+		t.Errorf("Step limits should come from the calibration. Got %v", p.StepLimits)
+	}
+	if p.CalibDirs != [6]bool{false, true, false, false, true, true} {
+		t.Errorf("Joints should travel away from their limit switches. Got %v", p.CalibDirs)
+	}
+	if want := 340.0 / 15200 * degreesToRadians; math.Abs(p.RadPerStep[0]-want) > 1e-12 {
+		t.Errorf("J1 radians per step should be %g. Got %g", want, p.RadPerStep[0])
+	}
+	if want := [6]float64{-170, 42.5, -60, -165, 105, 155}; p.LimitSwitchDegrees != want {
+		t.Errorf("Limit switch angles should be %v. Got %v", want, p.LimitSwitchDegrees)
+	}
+	if !reflect.DeepEqual(p.DhParameters, AR3Profile.DhParameters) {
+		t.Errorf("Geometry should be kept from the base profile")
+	}
+	jointDirs, err := arcsAR3().JointDirs()
+	if err != nil || jointDirs != [7]bool{true, false, false, true} {
+		t.Errorf("J1 and J4 should be reversed. Got %v and error %v", jointDirs, err)
+	}
+
+	c := arcsAR3()
+	c.Values[arcsAngleLimits+2] = "many"
+	if _, err = c.Profile(AR3Profile); err == nil || !strings.Contains(err.Error(), "many") {
+		t.Errorf("Step limit that is not a number should be refused. Got %v", err)
+	}
+	c = arcsAR3()
+	c.Values[arcsMotorDirs] = "2"
+	if _, err = c.JointDirs(); err == nil {
+		t.Errorf("Motor direction that is not 0 or 1 should be refused")
+	}
+	c.Values = c.Values[:arcsValues-1]
+	if _, err = c.Profile(AR3Profile); err == nil {
+		t.Errorf("Calibration that is too short should be refused")
+	}
+}
+
+func TestARCSCalibration_WithProfile(t *testing.T) {
+	jointDirs := [7]bool{true, false, false, true, false, true}
+	c := arcsAR3().WithProfile(AR3Profile, jointDirs)
+	path := filepath.Join(t.TempDir(), "ARbot.cal")
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Calibration should save. Got error: %s", err)
+	}
+	loaded, err := LoadARCSCalibration(path)
+	if err != nil {
+		t.Fatalf("Saved calibration should load. Got error: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.Values, c.Values) || loaded.Values[12] != "COM3" {
+		t.Errorf("Saved calibration should load unchanged. Got %q", loaded.Values)
+	}
+
+	p, err := loaded.Profile(AR3Profile)
+	if err != nil {
+		t.Fatalf("Calibration should make a profile. Got error: %s", err)
+	}
+	if p.StepLimits != AR3Profile.StepLimits || p.CalibDirs != AR3Profile.CalibDirs {
+		t.Errorf("Profile should match AR3Profile. Got %+v", p)
+	}
+	for i := 0; i < 6; i++ {
+		if math.Abs(p.RadPerStep[i]-AR3Profile.RadPerStep[i]) > 1e-12 || math.Abs(p.LimitSwitchDegrees[i]-AR3Profile.LimitSwitchDegrees[i]) > 1e-9 {
+			t.Errorf("J%d should match AR3Profile. Got %g radians per step and limit switch at %g degrees", i+1, p.RadPerStep[i], p.LimitSwitchDegrees[i])
+		}
+	}
+	if got, _ := loaded.JointDirs(); got != jointDirs {
+		t.Errorf("Joint directions should be %v. Got %v", jointDirs, got)
+	}
+
+	if got := (ARCSCalibration{}).WithProfile(AR3Profile, jointDirs); len(got.Values) != arcsValues {
+		t.Errorf("Empty calibration should be padded to %d values. Got %d", arcsValues, len(got.Values))
+	}
+}
@@ -0,0 +1,152 @@
+package ar3
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotCalibrated is returned by moves of an arm with joints that have not
+// been calibrated since it connected, or since Stop or a step loss left their
+// position unknown. AllowUncalibratedMotion lets such moves through.
+var ErrNotCalibrated = errors.New("AR3 not calibrated")
+
+// calibrationError returns an error wrapping ErrNotCalibrated that names
+// every joint, and the track if the profile has one, not calibrated.
+func (p RobotProfile) calibrationError(calibrated [7]bool) error {
+	var missing []string
+	for i, c := range calibrated {
+		if !c && (i < 6 || p.HasTrack()) {
+			missing = append(missing, jointName(i))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: calibrate %s", ErrNotCalibrated, strings.Join(missing, ", "))
+}
+
+// loseCalibration marks the joints that lost steps not calibrated, if err is
+// an *ErrStepLoss.
+func loseCalibration(calibrated *[7]bool, err error) {
+	var stepLoss *ErrStepLoss
+	if !errors.As(err, &stepLoss) {
+		return
+	}
+	for i, deviation := range stepLoss.Deviation {
+		if abs(deviation) > stepLoss.Tolerance[i] {
+			calibrated[i] = false
+		}
+	}
+}
+
+// IsCalibrated reports whether every joint, and the track if the profile has
+// one, has been calibrated since the arm connected, and not lost its position
+// to Stop or a step loss since.
+func (ar3 *AR3exec) IsCalibrated() bool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.profile.calibrationError(ar3.calibrated) == nil
+}
+
+// CalibratedJoints returns whether each joint, and the track, is calibrated.
+func (ar3 *AR3exec) CalibratedJoints() [7]bool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.calibrated
+}
+
+// MarkCalibrated sets whether each joint, and the track, is calibrated,
+// without homing it. It is for restoring the calibration of an arm that was
+// calibrated over an earlier connection and has not moved since, along with
+// its joints (see SetJointRadians).
+func (ar3 *AR3exec) MarkCalibrated(calibrated [7]bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.calibrated = calibrated
+}
+
+// AllowUncalibratedMotion sets whether the arm may move before it is
+// calibrated. Moves are refused with ErrNotCalibrated by default, since until
+// then the arm only assumes it starts at its limit switches, or wherever
+// SetJointRadians says.
+func (ar3 *AR3exec) AllowUncalibratedMotion(allow bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.uncalibratedMotion = allow
+}
+
+// SetLimitSwitchSteps sets the number of steps each joint's limit switch is
+// offset from its zero angle, replacing the offsets from the profile's
+// LimitSwitchDegrees. Offsets are usually measured by calibrating a joint and
+// jogging it to its true mechanical zero, where its stepper position is the
+// offset. The track is always zeroed at its limit switch, so its offset must
+// be 0. The stepper positions are kept, so joint angles read afterwards are
+// measured from the new zeros.
+func (ar3 *AR3exec) SetLimitSwitchSteps(steps [7]int) error {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	profile, err := ar3.profile.withLimitSwitchSteps(steps)
+	if err != nil {
+		return err
+	}
+	ar3.profile = profile
+	ar3.limitSwitchSteps = steps
+	return nil
+}
+
+// LimitSwitchSteps returns the number of steps each joint's limit switch is
+// offset from its zero angle.
+func (ar3 *AR3exec) LimitSwitchSteps() [7]int {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.limitSwitchSteps
+}
+
+// IsCalibrated simulates AR3exec.IsCalibrated().
+func (ar3 *AR3simulate) IsCalibrated() bool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.profile.calibrationError(ar3.calibrated) == nil
+}
+
+// CalibratedJoints simulates AR3exec.CalibratedJoints().
+func (ar3 *AR3simulate) CalibratedJoints() [7]bool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.calibrated
+}
+
+// MarkCalibrated simulates AR3exec.MarkCalibrated().
+func (ar3 *AR3simulate) MarkCalibrated(calibrated [7]bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.calibrated = calibrated
+}
+
+// AllowUncalibratedMotion simulates AR3exec.AllowUncalibratedMotion().
+func (ar3 *AR3simulate) AllowUncalibratedMotion(allow bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.uncalibratedMotion = allow
+}
+
+// SetLimitSwitchSteps simulates AR3exec.SetLimitSwitchSteps().
+func (ar3 *AR3simulate) SetLimitSwitchSteps(steps [7]int) error {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	profile, err := ar3.profile.withLimitSwitchSteps(steps)
+	if err != nil {
+		return err
+	}
+	ar3.profile = profile
+	ar3.limitSwitchSteps = steps
+	return nil
+}
+
+// LimitSwitchSteps simulates AR3exec.LimitSwitchSteps().
+func (ar3 *AR3simulate) LimitSwitchSteps() [7]int {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.limitSwitchSteps
+}
@@ -0,0 +1,177 @@
+package ar3
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trilobio/ar3/protocol"
+)
+
+func TestAR3exec_NotCalibrated(t *testing.T) {
+	mt := NewMemoryTransport(EchoResponder)
+	arm, err := ConnectTransport(mt, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	if arm.IsCalibrated() {
+		t.Errorf("Arm should not be calibrated when it connects")
+	}
+	err = arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	if !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Move should fail with ErrNotCalibrated. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for a refused move. Got %v", mt.Commands())
+	}
+
+	if err = arm.Calibrate(50, true, true, true, false, false, false, false); err != nil {
+		t.Fatalf("Calibrate should succeed. Got error: %s", err)
+	}
+	err = arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	if !errors.Is(err, ErrNotCalibrated) || !strings.HasSuffix(err.Error(), "calibrate J4, J5, J6") {
+		t.Errorf("Error should name the joints left to calibrate. Got %v", err)
+	}
+	if err = arm.Calibrate(50, false, false, false, true, true, true, false); err != nil {
+		t.Fatalf("Calibrate should succeed. Got error: %s", err)
+	}
+	if !arm.IsCalibrated() || arm.CalibratedJoints() != [7]bool{true, true, true, true, true, true, false} {
+		t.Errorf("Every joint should be calibrated. Got %v", arm.CalibratedJoints())
+	}
+	if err = arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("Calibrated arm should move. Got error: %s", err)
+	}
+}
+
+func TestAR3exec_CalibrateFails(t *testing.T) {
+	mt := NewMemoryTransport(func(command string) []string {
+		if strings.HasPrefix(command, protocol.CalibrateCode) {
+			return []string{protocol.CalibrateFail}
+		}
+		return EchoResponder(command)
+	})
+	arm, err := ConnectTransport(mt, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	if err = arm.MoveSteppersWithParams(DefaultMoveParams, 100, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	position := arm.CurrentStepperPosition()
+	err = arm.Calibrate(50, true, true, true, true, true, true, false)
+	if err == nil || !strings.Contains(err.Error(), `"fail"`) {
+		t.Errorf("Calibrate should fail when the arm answers fail. Got %v", err)
+	}
+	if arm.IsCalibrated() || arm.CurrentStepperPosition() != position {
+		t.Errorf("Failed calibration should leave the joints as they were, not calibrated. Got %v and %v", arm.CalibratedJoints(), arm.CurrentStepperPosition())
+	}
+
+	mt.Close()
+	if err = arm.Calibrate(50, true, true, true, true, true, true, false); err == nil {
+		t.Errorf("Calibrate over a closed transport should fail")
+	}
+	if arm.IsCalibrated() {
+		t.Errorf("Calibrate over a closed transport should not calibrate the arm")
+	}
+}
+
+func TestAR3exec_CalibrateTimeout(t *testing.T) {
+	arm, _ := connectStalled(t)
+	arm.SetCommandTimeout(20 * time.Millisecond)
+	err := arm.Calibrate(50, true, true, true, true, true, true, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Calibrate without an answer should time out. Got %v", err)
+	}
+	if calibrated := arm.CalibratedJoints(); calibrated != [7]bool{} {
+		t.Errorf("Timed out calibration should not calibrate the arm. Got %v", calibrated)
+	}
+}
+
+func TestAR3simulate_NotCalibrated(t *testing.T) {
+	arm := ConnectMock(trackProfile)
+	err := arm.MoveSteppersWithParams(DefaultMoveParams, 100, 100, 100, 100, 100, 100, 0)
+	if !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Move should fail with ErrNotCalibrated. Got %v", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	if err = arm.MoveSteppersWithParams(DefaultMoveParams, 100, 100, 100, 100, 100, 100, 0); err != nil {
+		t.Errorf("Uncalibrated motion should be allowed. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(false)
+
+	arm.Calibrate(50, true, true, true, true, true, true, false)
+	if arm.IsCalibrated() {
+		t.Errorf("Arm on a track should not be calibrated until its track is")
+	}
+	arm.Calibrate(50, false, false, false, false, false, false, true)
+	if err = arm.MoveSteppersWithParams(DefaultMoveParams, 100, 100, 100, 100, 100, 100, 100); err != nil {
+		t.Errorf("Calibrated arm should move. Got error: %s", err)
+	}
+}
+
+func TestAR3simulate_MarkCalibrated(t *testing.T) {
+	arm := ConnectMock(AR3Profile)
+	arm.MarkCalibrated([7]bool{true, true, true, true, true, true})
+	if !arm.IsCalibrated() {
+		t.Fatalf("Marked joints should be calibrated. Got %v", arm.CalibratedJoints())
+	}
+	mock := arm.(*AR3simulate)
+	arm.EnableStepLossCheck([6]int{5, 5, 5, 5, 5, 5})
+	mock.AddDrift([6]int{10, 0, 0, 0, 0, 0})
+	if err := arm.MoveSteppersWithParams(DefaultMoveParams, 100, 0, 0, 0, 0, 0, 0); err == nil {
+		t.Fatalf("Move should lose steps")
+	}
+	err := arm.MoveSteppersWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	if !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Step loss should still refuse moves on a marked arm. Got %v", err)
+	}
+}
+
+func TestAR3simulate_SetLimitSwitchSteps(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	if arm.LimitSwitchSteps() != AR3Profile.limitSwitchSteps() {
+		t.Errorf("Offsets should start from the profile. Got %v", arm.LimitSwitchSteps())
+	}
+	steps := [7]int{-7000, 5000, -3000, -8000, 2000, 7000, 0}
+	if err := arm.SetLimitSwitchSteps(steps); err != nil {
+		t.Fatalf("Offsets should be set. Got error: %s", err)
+	}
+	if arm.LimitSwitchSteps() != steps || arm.Profile().limitSwitchSteps() != steps {
+		t.Errorf("Expected the offsets that were set. Got %v and %v", arm.LimitSwitchSteps(), arm.Profile().limitSwitchSteps())
+	}
+	if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	if position := arm.CurrentStepperPosition(); position != steps {
+		t.Errorf("Zero angles should be at the new offsets. Got %v", position)
+	}
+
+	if err := arm.SetLimitSwitchSteps([7]int{-7000, 5000, -3000, -8000, 2000, 7000, 10}); err == nil {
+		t.Errorf("Track offset should be refused")
+	}
+	if err := arm.SetLimitSwitchSteps([7]int{7000, 5000, -3000, -8000, 2000, 7000, 0}); err == nil || !strings.Contains(err.Error(), "J1") {
+		t.Errorf("Offset outside the travel of J1 should be refused. Got %v", err)
+	}
+	if arm.LimitSwitchSteps() != steps {
+		t.Errorf("Refused offsets should not be set. Got %v", arm.LimitSwitchSteps())
+	}
+}
+
+func TestAR3exec_SetLimitSwitchSteps(t *testing.T) {
+	arm, mt := connectMemory(t)
+	if err := arm.SetLimitSwitchSteps([7]int{-7000, 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatalf("Offsets should be set. Got error: %s", err)
+	}
+	if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	if command := mt.Commands()[1]; !strings.HasPrefix(command, "MJA17000B0") {
+		t.Errorf("Move should take J1 to its new zero, 7000 steps negative. Got %s", command)
+	}
+	if joints := arm.CurrentJointRadians(); joints != [7]float64{} {
+		t.Errorf("Joints should be at zero. Got %v", joints)
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "embed"
@@ -18,9 +25,14 @@ import (
 )
 
 type State struct {
-	robot *ar3.Arm
-	db    *sqlx.DB
-	speed int
+	robot     *ar3.Arm
+	db        *sqlx.DB
+	params    ar3.MoveParams
+	tools     []ar3.Tool
+	jointDirs [7]bool
+	// calibrationRestored is set once the calibration of the last run has
+	// been restored, so it is only recorded again after that.
+	calibrationRestored bool
 }
 
 //go:embed schema.sql
@@ -50,18 +62,69 @@ func main() {
 				Value:   10,
 				Usage:   "Set the speed of the robot arm",
 			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Value: "AR3",
+				Usage: "Use the robot profile `PROFILE`: AR2, AR3 or a JSON/YAML file",
+			},
+			&cli.StringFlag{
+				Name: "arcs-cal",
+				Usage: "Take the step limits, limit switch angles and joint" +
+					" directions from the ARCS calibration file `FILE`",
+			},
+			&cli.StringFlag{
+				Name:  "tools",
+				Usage: "Load named tools from the JSON/YAML file `FILE`",
+			},
 			&cli.BoolFlag{
 				Name:    "mock",
 				Aliases: []string{"k"},
 				Value:   false,
 				Usage:   "Use the mock robot arm interface",
 			},
+			&cli.BoolFlag{
+				Name:  "uncalibrated",
+				Usage: "Allow moves before the robot arm is calibrated",
+			},
 		},
 		Commands: []*cli.Command{
 			{
 				Name:    "calibrate",
 				Aliases: []string{"c"},
 				Usage:   "Calibrate the robot arm by moving to the limit switches",
+				Subcommands: []*cli.Command{
+					{
+						Name: "wizard",
+						Usage: "Home each joint in turn and jog it to its true" +
+							" mechanical zero, then save how far each zero" +
+							" is from its limit switch",
+						Action: func(c *cli.Context) error {
+							r := *s.robot
+							// Joints are homed one at a time, so the others
+							// are not yet calibrated while each is jogged.
+							r.AllowUncalibratedMotion(true)
+							defer r.AllowUncalibratedMotion(c.Bool("uncalibrated"))
+							steps, err := teachLimitSwitchSteps(c.Context, r, s.params, os.Stdin, os.Stdout)
+							if err != nil {
+								return err
+							}
+							err = r.SetLimitSwitchSteps(steps)
+							if err != nil {
+								return err
+							}
+							err = recordLimitSwitchSteps(s.db, steps)
+							if err != nil {
+								return err
+							}
+							err = recordJoints(s.db, s.robot)
+							if err != nil {
+								return err
+							}
+							fmt.Printf("Saved limit switch offsets %v\n", steps[:6])
+							return nil
+						},
+					},
+				},
 				Action: func(c *cli.Context) error {
 					err := (*s.robot).Calibrate(25, true, true, true, true, true, true, false)
 					if err != nil {
@@ -71,7 +134,7 @@ func main() {
 					if err != nil {
 						return err
 					}
-					err = (*s.robot).MoveJointRadians(s.speed, 10, 10, 10, 10, 0, 0, 0, 0, 0, 0, 0)
+					err = (*s.robot).MoveJointRadiansWithParams(s.params, 0, 0, 0, 0, 0, 0, 0)
 					if err != nil {
 						return fmt.Errorf("error moving to home %v", err)
 					}
@@ -86,8 +149,28 @@ func main() {
 				Name:    "state",
 				Aliases: []string{"s"},
 				Usage:   "Get the current state of the robot arm.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "tool",
+						Value: "flange",
+						Usage: "Give the pose of the center point of tool `TOOL`",
+					},
+					&cli.StringFlag{
+						Name:  "frame",
+						Value: "base",
+						Usage: "Give the pose in the work frame `FRAME`",
+					},
+				},
 				Action: func(c *cli.Context) error {
-					pose := (*s.robot).CurrentPose()
+					err := setTool(&s, c.String("tool"))
+					if err != nil {
+						return err
+					}
+					frame, err := getFrame(s.db, c.String("frame"))
+					if err != nil {
+						return err
+					}
+					pose := (*s.robot).CurrentPoseInFrame(frame)
 
 					poseJSON, err := json.MarshalIndent(pose, "", "  ")
 					if err != nil {
@@ -101,7 +184,7 @@ func main() {
 				Name:  "home",
 				Usage: "Move the robot arm to the home position.",
 				Action: func(c *cli.Context) error {
-					err := (*s.robot).MoveJointRadians(s.speed, 10, 10, 10, 10, 0, 0, 0, 0, 0, 0, 0)
+					err := (*s.robot).MoveJointRadiansWithParams(s.params, 0, 0, 0, 0, 0, 0, 0)
 					if err != nil {
 						return fmt.Errorf("error moving to home %v", err)
 					}
@@ -159,6 +242,16 @@ func main() {
 							" the end effector",
 						Value: 0,
 					},
+					&cli.StringFlag{
+						Name:  "tool",
+						Value: "flange",
+						Usage: "Move the center point of tool `TOOL`",
+					},
+					&cli.StringFlag{
+						Name:  "frame",
+						Value: "base",
+						Usage: "Move in the work frame `FRAME`",
+					},
 					&cli.BoolFlag{
 						Name:    "abs",
 						Aliases: []string{"a"},
@@ -168,6 +261,14 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
+					err := setTool(&s, c.String("tool"))
+					if err != nil {
+						return err
+					}
+					frame, err := getFrame(s.db, c.String("frame"))
+					if err != nil {
+						return err
+					}
 					var targPose kinematics.Pose
 					abs := c.Bool("abs")
 					targPose.Position.X = c.Float64("x")
@@ -180,7 +281,7 @@ func main() {
 
 					// Handle relative transformations
 					if !abs {
-						currPose := (*s.robot).CurrentPose()
+						currPose := (*s.robot).CurrentPoseInFrame(frame)
 
 						var currRot = kinQuatToQuat(currPose.Rotation)
 						var targRot = kinQuatToQuat(targPose.Rotation)
@@ -195,7 +296,7 @@ func main() {
 					targRot.Normalize()
 					targPose.Rotation = quatToKinQuat(targRot)
 
-					err := (*s.robot).Move(s.speed, 10, 10, 10, 10, targPose)
+					err = (*s.robot).MoveInFrame(s.params, frame, targPose)
 
 					if err != nil {
 						return fmt.Errorf("error moving to position %v", err)
@@ -209,6 +310,164 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name: "reach",
+				Usage: "Sample which positions in a box the tool can reach with" +
+					" a given orientation, and write the map to a CSV or PLY" +
+					" file.",
+				Flags: []cli.Flag{
+					&cli.Float64Flag{Name: "min-x", Value: -600, Usage: "Lowest X of the box"},
+					&cli.Float64Flag{Name: "min-y", Value: -600, Usage: "Lowest Y of the box"},
+					&cli.Float64Flag{Name: "min-z", Value: 0, Usage: "Lowest Z of the box"},
+					&cli.Float64Flag{Name: "max-x", Value: 600, Usage: "Highest X of the box"},
+					&cli.Float64Flag{Name: "max-y", Value: 600, Usage: "Highest Y of the box"},
+					&cli.Float64Flag{Name: "max-z", Value: 600, Usage: "Highest Z of the box"},
+					&cli.Float64Flag{Name: "step", Value: 25, Usage: "Sample every `STEP` mm"},
+					&cli.Float64Flag{Name: "qw", Value: 1, Usage: "W component of the rotation quaternion"},
+					&cli.Float64Flag{Name: "qx", Value: 0, Usage: "X component of the rotation quaternion"},
+					&cli.Float64Flag{Name: "qy", Value: 0, Usage: "Y component of the rotation quaternion"},
+					&cli.Float64Flag{Name: "qz", Value: 0, Usage: "Z component of the rotation quaternion"},
+					&cli.StringFlag{
+						Name:  "tool",
+						Value: "flange",
+						Usage: "Sample with the center point of tool `TOOL`",
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Write the map to `FILE`, ending in .csv or .ply",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					tool, ok := ar3.FindTool(s.tools, c.String("tool"))
+					if !ok {
+						return fmt.Errorf("unknown tool %q", c.String("tool"))
+					}
+					min := kinematics.Position{X: c.Float64("min-x"), Y: c.Float64("min-y"), Z: c.Float64("min-z")}
+					max := kinematics.Position{X: c.Float64("max-x"), Y: c.Float64("max-y"), Z: c.Float64("max-z")}
+					rot := Quat{W: c.Float64("qw"), X: c.Float64("qx"), Y: c.Float64("qy"), Z: c.Float64("qz")}
+					rot.Normalize()
+
+					reach, err := (*s.robot).Profile().SampleReach(min, max, c.Float64("step"), quatToKinQuat(rot), tool)
+					if err != nil {
+						return err
+					}
+
+					output := c.String("output")
+					f, err := os.Create(output)
+					if err != nil {
+						return err
+					}
+					switch strings.ToLower(filepath.Ext(output)) {
+					case ".csv":
+						err = reach.WriteCSV(f)
+					case ".ply":
+						err = reach.WritePLY(f)
+					default:
+						err = fmt.Errorf("unknown reach map format %q", filepath.Ext(output))
+					}
+					if errC := f.Close(); err == nil {
+						err = errC
+					}
+					if err != nil {
+						return err
+					}
+					fmt.Printf("%d of %d points reachable\n", reach.Reachable(), len(reach))
+					return nil
+				},
+			},
+			{
+				Name:  "frame",
+				Usage: "Teach and list work frames",
+				Subcommands: []*cli.Command{
+					{
+						Name: "teach",
+						Usage: "Record the current position as point `POINT` of" +
+							" frame `NAME`: origin, x (a point along +X) or xy" +
+							" (a point in the XY plane on the +Y side). The" +
+							" frame is saved once all three are recorded.",
+						ArgsUsage: "NAME POINT",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "tool",
+								Value: "flange",
+								Usage: "Record the center point of tool `TOOL`",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							name, point := c.Args().Get(0), c.Args().Get(1)
+							if name == "" || (point != "origin" && point != "x" && point != "xy") {
+								return fmt.Errorf("usage: frame teach NAME origin|x|xy")
+							}
+							err := setTool(&s, c.String("tool"))
+							if err != nil {
+								return err
+							}
+							frame, ok, err := teachFramePoint(s.db, name, point, (*s.robot).CurrentPose().Position)
+							if err != nil {
+								return err
+							}
+							if !ok {
+								fmt.Printf("Recorded %s point of frame %s\n", point, name)
+								return nil
+							}
+							frameJSON, err := json.MarshalIndent(frame, "", "  ")
+							if err != nil {
+								return err
+							}
+							fmt.Printf("%s\n", string(frameJSON))
+							return nil
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the taught work frames",
+						Action: func(c *cli.Context) error {
+							frames, err := getFrames(s.db)
+							if err != nil {
+								return err
+							}
+							framesJSON, err := json.MarshalIndent(frames, "", "  ")
+							if err != nil {
+								return err
+							}
+							fmt.Printf("%s\n", string(framesJSON))
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name: "arcs-cal",
+				Usage: "Write the arm's step limits, limit switch angles and" +
+					" joint directions to the ARCS calibration file `FILE`," +
+					" keeping its other values if it exists",
+				ArgsUsage: "FILE",
+				Action: func(c *cli.Context) error {
+					path := c.Args().First()
+					if path == "" {
+						return fmt.Errorf("usage: arcs-cal FILE")
+					}
+					var cal ar3.ARCSCalibration
+					if _, err := os.Stat(path); err == nil {
+						cal, err = ar3.LoadARCSCalibration(path)
+						if err != nil {
+							return err
+						}
+					}
+					cal = cal.WithProfile((*s.robot).Profile(), s.jointDirs)
+					return cal.Save(path)
+				},
+			},
+		},
+		After: func(c *cli.Context) error {
+			// Record which joints are still calibrated for the next run,
+			// once this run has restored them.
+			if !s.calibrationRestored {
+				return nil
+			}
+			return recordCalibrated(s.db, s.robot)
 		},
 		Before: func(c *cli.Context) error {
 			port := c.String("port")
@@ -216,19 +475,53 @@ func main() {
 			speed := c.Int("speed")
 			mock := c.Bool("mock")
 
-			s.speed = speed
+			profile, ok := ar3.BuiltinProfile(c.String("profile"))
+			if !ok {
+				var err error
+				profile, err = ar3.LoadProfile(c.String("profile"))
+				if err != nil {
+					return fmt.Errorf("error loading profile: %v", err)
+				}
+			}
+
+			s.params = ar3.DefaultMoveParams.WithSpeed(speed)
+			err := s.params.Validate()
+			if err != nil {
+				return err
+			}
+
+			if tools := c.String("tools"); tools != "" {
+				s.tools, err = ar3.LoadTools(tools)
+				if err != nil {
+					return fmt.Errorf("error loading tools: %v", err)
+				}
+			}
 
 			jointDirs := [7]bool{true, false, false, true, false, true, false}
+			if path := c.String("arcs-cal"); path != "" {
+				cal, err := ar3.LoadARCSCalibration(path)
+				if err != nil {
+					return fmt.Errorf("error loading ARCS calibration: %v", err)
+				}
+				profile, err = cal.Profile(profile)
+				if err != nil {
+					return fmt.Errorf("error loading ARCS calibration: %v", err)
+				}
+				jointDirs, err = cal.JointDirs()
+				if err != nil {
+					return fmt.Errorf("error loading ARCS calibration: %v", err)
+				}
+			}
+			s.jointDirs = jointDirs
 
 			var r ar3.Arm
-			var err error
 			if !mock {
-				r, err = ar3.Connect(port, jointDirs)
+				r, err = ar3.Connect(port, jointDirs, profile)
 				if err != nil {
 					return err
 				}
 			} else {
-				r = ar3.ConnectMock()
+				r = ar3.ConnectMock(profile)
 			}
 
 			s.robot = &r
@@ -246,24 +539,78 @@ func main() {
 				return fmt.Errorf("error executing schema: %v", err)
 			}
 
+			// Offsets taught by the calibration wizard replace the
+			// profile's, and the saved joints are measured from them.
+			limitSwitchSteps, ok, err := getLimitSwitchSteps(s.db)
+			if err != nil {
+				return err
+			}
+			if ok {
+				err = r.SetLimitSwitchSteps(limitSwitchSteps)
+				if err != nil {
+					return fmt.Errorf("error setting limit switch offsets: %v", err)
+				}
+			}
+
 			jointsRestore, err := getJoints(s.db, s.robot)
 			if err == nil {
 				(*s.robot).SetJointRadians(jointsRestore)
 			}
 
+			// Each run connects afresh, so trust the joints an earlier run
+			// calibrated along with where it left them. Step loss and stops
+			// in this run still refuse moves until they are calibrated again.
+			calibrated, err := getCalibrated(s.db)
+			if err != nil {
+				return err
+			}
+			r.MarkCalibrated(calibrated)
+			s.calibrationRestored = true
+			r.AllowUncalibratedMotion(c.Bool("uncalibrated"))
+
+			// Stop the arm on ^C, rather than exit with it still moving. The
+			// command then fails, and the program exits as usual.
+			go func() {
+				<-c.Context.Done()
+				log.Println("interrupted, stopping the arm. Calibrate it before moving it again")
+				if err := r.Stop(); err != nil {
+					log.Printf("error stopping arm: %v", err)
+				}
+			}()
+
 			return nil
 		},
 	}
 
-	err := app.Run(os.Args)
-	if err != nil {
-		log.Fatal(err)
-	}
+	// The first ^C cancels ctx, and a second kills the program.
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		cancel()
+	}()
+
+	err := app.RunContext(ctx, os.Args)
 
 	if s.db != nil {
 		s.db.Close()
 	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
+}
 
+func setTool(s *State, name string) error {
+	tool, ok := ar3.FindTool(s.tools, name)
+	if !ok {
+		return fmt.Errorf("unknown tool %q", name)
+	}
+	return (*s.robot).SetTool(tool)
 }
 
 func recordJoints(db *sqlx.DB, robot *ar3.Arm) error {
@@ -292,6 +639,169 @@ func recordJoints(db *sqlx.DB, robot *ar3.Arm) error {
 	return nil
 }
 
+func recordCalibrated(db *sqlx.DB, robot *ar3.Arm) error {
+	calibrated := (*robot).CalibratedJoints()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	for i, c := range calibrated {
+		_, err = tx.Exec("INSERT OR REPLACE INTO calibrated_joints (joint, calibrated) VALUES (?, ?);", i+1, c)
+		if err != nil {
+			if errR := tx.Rollback(); errR != nil {
+				return fmt.Errorf("error recording calibration: %v (and error rolling back transaction: %v)", err, errR)
+			}
+			return fmt.Errorf("error recording calibration: %v", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// getCalibrated returns which joints, and the track, were calibrated when the
+// last run ended. Nothing is calibrated before the first run.
+func getCalibrated(db *sqlx.DB) ([7]bool, error) {
+	var calibrated [7]bool
+	var rows []struct {
+		Joint      int  `db:"joint"`
+		Calibrated bool `db:"calibrated"`
+	}
+	err := db.Select(&rows, "SELECT joint, calibrated FROM calibrated_joints")
+	if err != nil {
+		return calibrated, fmt.Errorf("error getting calibration: %v", err)
+	}
+	for _, row := range rows {
+		calibrated[row.Joint-1] = row.Calibrated
+	}
+	return calibrated, nil
+}
+
+// teachLimitSwitchSteps homes each joint in turn and lets the operator jog it
+// by a number of steps at a time, read from in, until it sits at its true
+// mechanical zero. The stepper position there is the joint's limit switch
+// offset. It gives up once ctx is done.
+func teachLimitSwitchSteps(ctx context.Context, robot ar3.Arm, params ar3.MoveParams, in io.Reader, out io.Writer) ([7]int, error) {
+	var steps [7]int
+	lines := scanLines(in)
+	for i := 0; i < 6; i++ {
+		home := [7]bool{}
+		home[i] = true
+		err := robot.Calibrate(25, home[0], home[1], home[2], home[3], home[4], home[5], false)
+		if err != nil {
+			return steps, fmt.Errorf("error calibrating J%d: %v", i+1, err)
+		}
+		fmt.Fprintf(out, "J%d is at its limit switch. Jog it to its mechanical zero by entering a number of steps, then enter \"done\".\n", i+1)
+		for {
+			fmt.Fprintf(out, "J%d> ", i+1)
+			var scanned scannedLine
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return steps, ctx.Err()
+			case scanned, ok = <-lines:
+			}
+			if !ok {
+				return steps, fmt.Errorf("calibration wizard ended before J%d was zeroed", i+1)
+			}
+			if scanned.err != nil {
+				return steps, scanned.err
+			}
+			if err := ctx.Err(); err != nil {
+				return steps, err
+			}
+			line := strings.TrimSpace(scanned.text)
+			if line == "done" {
+				break
+			}
+			jog, err := strconv.Atoi(line)
+			if err != nil {
+				fmt.Fprintf(out, "Expected a number of steps or \"done\". Got %q\n", line)
+				continue
+			}
+			// MoveSteppers takes positions from each joint's zero, not
+			// from its limit switch.
+			position, sl := robot.CurrentStepperPosition(), robot.LimitSwitchSteps()
+			var target [7]int
+			for j := range target {
+				target[j] = position[j] - sl[j]
+			}
+			target[i] += jog
+			err = robot.MoveSteppersWithParams(params, target[0], target[1], target[2], target[3], target[4], target[5], target[6])
+			if err != nil {
+				fmt.Fprintf(out, "Error jogging J%d: %v\n", i+1, err)
+			}
+		}
+		steps[i] = robot.CurrentStepperPosition()[i]
+	}
+	return steps, nil
+}
+
+// scannedLine is a line read by scanLines, or the error that ended the input.
+type scannedLine struct {
+	text string
+	err  error
+}
+
+// scanLines reads lines from in on their own goroutine, so a prompt can stop
+// waiting for input as soon as it is cancelled. The channel is closed at the
+// end of the input, after any error reading it.
+func scanLines(in io.Reader) <-chan scannedLine {
+	lines := make(chan scannedLine)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scannedLine{text: scanner.Text()}
+		}
+		if err := scanner.Err(); err != nil {
+			lines <- scannedLine{err: err}
+		}
+	}()
+	return lines
+}
+
+func recordLimitSwitchSteps(db *sqlx.DB, steps [7]int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		_, err = tx.Exec("INSERT OR REPLACE INTO limit_switch_steps (joint, steps) VALUES (?, ?);", i+1, steps[i])
+		if err != nil {
+			if errR := tx.Rollback(); errR != nil {
+				return fmt.Errorf("error recording limit switch offsets: %v (and error rolling back transaction: %v)", err, errR)
+			}
+			return fmt.Errorf("error recording limit switch offsets: %v", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// getLimitSwitchSteps returns the limit switch offsets saved by the
+// calibration wizard, and false if it has not been run.
+func getLimitSwitchSteps(db *sqlx.DB) ([7]int, bool, error) {
+	var steps [7]int
+	var rows []struct {
+		Joint int `db:"joint"`
+		Steps int `db:"steps"`
+	}
+	err := db.Select(&rows, "SELECT joint, steps FROM limit_switch_steps")
+	if err != nil {
+		return steps, false, fmt.Errorf("error getting limit switch offsets: %v", err)
+	}
+	for _, row := range rows {
+		steps[row.Joint-1] = row.Steps
+	}
+	return steps, len(rows) > 0, nil
+}
+
 func getJoints(db *sqlx.DB, robot *ar3.Arm) ([7]float64, error) {
 	var resJoints [7]float64
 
@@ -321,6 +831,113 @@ func getJoints(db *sqlx.DB, robot *ar3.Arm) ([7]float64, error) {
 	return resJoints, nil
 }
 
+type frameRow struct {
+	Name string  `db:"name"`
+	X    float64 `db:"X"`
+	Y    float64 `db:"Y"`
+	Z    float64 `db:"Z"`
+	QW   float64 `db:"QW"`
+	QX   float64 `db:"QX"`
+	QY   float64 `db:"QY"`
+	QZ   float64 `db:"QZ"`
+}
+
+func (row frameRow) frame() ar3.Frame {
+	return ar3.Frame{
+		Name: row.Name,
+		Origin: kinematics.Pose{
+			Position: kinematics.Position{X: row.X, Y: row.Y, Z: row.Z},
+			Rotation: kinematics.Quaternion{W: row.QW, X: row.QX, Y: row.QY, Z: row.QZ},
+		},
+	}
+}
+
+func getFrame(db *sqlx.DB, name string) (ar3.Frame, error) {
+	if name == "" || name == ar3.BaseFrame.Name {
+		return ar3.BaseFrame, nil
+	}
+	var row frameRow
+	err := db.Get(&row, "SELECT * FROM frames WHERE name = ?", name)
+	if err != nil {
+		return ar3.Frame{}, fmt.Errorf("error getting frame %q: %v", name, err)
+	}
+	return row.frame(), nil
+}
+
+func getFrames(db *sqlx.DB) ([]ar3.Frame, error) {
+	var rows []frameRow
+	err := db.Select(&rows, "SELECT * FROM frames ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("error getting frames: %v", err)
+	}
+	frames := make([]ar3.Frame, len(rows))
+	for i, row := range rows {
+		frames[i] = row.frame()
+	}
+	return frames, nil
+}
+
+// teachFramePoint records a point of a frame. Once all three points of the
+// frame are recorded, the frame is built and saved, and ok is true.
+func teachFramePoint(db *sqlx.DB, name, point string, position kinematics.Position) (frame ar3.Frame, ok bool, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return frame, false, fmt.Errorf("error beginning transaction: %v", err)
+	}
+	// A failed commit ends the transaction, so only a transaction that was
+	// never committed is rolled back.
+	committing := false
+	defer func() {
+		if err != nil && !committing {
+			if errR := tx.Rollback(); errR != nil {
+				err = fmt.Errorf("%v (and error rolling back transaction: %v)", err, errR)
+			}
+		}
+	}()
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO frame_points (frame, point, X, Y, Z) VALUES"+
+		" (?, ?, ?, ?, ?);", name, point, position.X, position.Y, position.Z)
+	if err != nil {
+		return frame, false, fmt.Errorf("error inserting frame point: %v", err)
+	}
+
+	var points []struct {
+		Point string  `db:"point"`
+		X     float64 `db:"X"`
+		Y     float64 `db:"Y"`
+		Z     float64 `db:"Z"`
+	}
+	err = tx.Select(&points, "SELECT point, X, Y, Z FROM frame_points WHERE frame = ?", name)
+	if err != nil {
+		return frame, false, fmt.Errorf("error getting frame points: %v", err)
+	}
+	taught := make(map[string]kinematics.Position)
+	for _, p := range points {
+		taught[p.Point] = kinematics.Position{X: p.X, Y: p.Y, Z: p.Z}
+	}
+	if len(taught) == 3 {
+		frame, err = ar3.TeachFrame(name, taught["origin"], taught["x"], taught["xy"])
+		if err != nil {
+			return frame, false, err
+		}
+		o := frame.Origin
+		_, err = tx.Exec("INSERT OR REPLACE INTO frames (name, X, Y, Z, QW, QX, QY, QZ) VALUES"+
+			" (?, ?, ?, ?, ?, ?, ?, ?);", name, o.Position.X, o.Position.Y, o.Position.Z,
+			o.Rotation.W, o.Rotation.X, o.Rotation.Y, o.Rotation.Z)
+		if err != nil {
+			return frame, false, fmt.Errorf("error inserting frame: %v", err)
+		}
+		ok = true
+	}
+
+	committing = true
+	err = tx.Commit()
+	if err != nil {
+		return frame, false, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return frame, ok, nil
+}
+
 func kinQuatToQuat(kq kinematics.Quaternion) Quat {
 	var q = Quat{}
 	q.W = kq.W
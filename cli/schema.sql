@@ -13,3 +13,33 @@ CREATE TABLE IF NOT EXISTS joints (
         J5 REAL NOT NULL,
         J6 REAL NOT NULL
 );
+
+CREATE TABLE IF NOT EXISTS calibrated_joints (
+        joint INTEGER PRIMARY KEY CHECK (joint BETWEEN 1 AND 7),
+        calibrated INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS limit_switch_steps (
+        joint INTEGER PRIMARY KEY CHECK (joint BETWEEN 1 AND 6),
+        steps INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS frames (
+        name TEXT PRIMARY KEY,
+        X REAL NOT NULL,
+        Y REAL NOT NULL,
+        Z REAL NOT NULL,
+        QW REAL NOT NULL,
+        QX REAL NOT NULL,
+        QY REAL NOT NULL,
+        QZ REAL NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS frame_points (
+        frame TEXT NOT NULL,
+        point TEXT NOT NULL CHECK (point IN ('origin', 'x', 'xy')),
+        X REAL NOT NULL,
+        Y REAL NOT NULL,
+        Z REAL NOT NULL,
+        PRIMARY KEY (frame, point)
+);
@@ -0,0 +1,383 @@
+package ar3
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// Obstacle is a solid, convex shape on the bench that the arm must not touch,
+// such as Box, Cylinder or Plane. Positions are in millimeters, in the arm's
+// base frame, or the track's frame for an arm on a track.
+type Obstacle interface {
+	// String names the obstacle in errors.
+	String() string
+	// Distance returns how far a point is from the obstacle, and 0 for a
+	// point inside it.
+	Distance(p kinematics.Position) float64
+}
+
+// Box is an obstacle shaped like a box with its sides along the axes.
+type Box struct {
+	Name     string
+	Min, Max kinematics.Position
+}
+
+// String returns the box's name.
+func (b Box) String() string {
+	return b.Name
+}
+
+// Distance returns how far p is from the box.
+func (b Box) Distance(p kinematics.Position) float64 {
+	outside := func(v, min, max float64) float64 {
+		return math.Max(0, math.Max(min-v, v-max))
+	}
+	return vec3{
+		outside(p.X, b.Min.X, b.Max.X),
+		outside(p.Y, b.Min.Y, b.Max.Y),
+		outside(p.Z, b.Min.Z, b.Max.Z),
+	}.norm()
+}
+
+// depth returns how far p is inside the box, from its nearest face.
+func (b Box) depth(p kinematics.Position) float64 {
+	inside := func(v, min, max float64) float64 {
+		return math.Min(v-min, max-v)
+	}
+	return math.Max(0, math.Min(inside(p.X, b.Min.X, b.Max.X),
+		math.Min(inside(p.Y, b.Min.Y, b.Max.Y), inside(p.Z, b.Min.Z, b.Max.Z))))
+}
+
+// Cylinder is an upright cylindrical obstacle, like a centrifuge.
+type Cylinder struct {
+	Name string
+	// Base is the center of the cylinder's bottom.
+	Base   kinematics.Position
+	Radius float64
+	Height float64
+}
+
+// String returns the cylinder's name.
+func (c Cylinder) String() string {
+	return c.Name
+}
+
+// Distance returns how far p is from the cylinder.
+func (c Cylinder) Distance(p kinematics.Position) float64 {
+	radial := math.Max(0, math.Hypot(p.X-c.Base.X, p.Y-c.Base.Y)-c.Radius)
+	vertical := math.Max(0, math.Max(c.Base.Z-p.Z, p.Z-c.Base.Z-c.Height))
+	return math.Hypot(radial, vertical)
+}
+
+// depth returns how far p is inside the cylinder, from its nearest face.
+func (c Cylinder) depth(p kinematics.Position) float64 {
+	radial := c.Radius - math.Hypot(p.X-c.Base.X, p.Y-c.Base.Y)
+	vertical := math.Min(p.Z-c.Base.Z, c.Base.Z+c.Height-p.Z)
+	return math.Max(0, math.Min(radial, vertical))
+}
+
+// Plane is a level obstacle filling everything below a height, like the
+// table the arm stands on.
+type Plane struct {
+	Name string
+	Z    float64
+}
+
+// String returns the plane's name.
+func (t Plane) String() string {
+	return t.Name
+}
+
+// Distance returns how far p is above the plane.
+func (t Plane) Distance(p kinematics.Position) float64 {
+	return math.Max(0, p.Z-t.Z)
+}
+
+// depth returns how far p is below the plane.
+func (t Plane) depth(p kinematics.Position) float64 {
+	return math.Max(0, t.Z-p.Z)
+}
+
+// signedDistance returns how far p is from an obstacle, negated for a point
+// inside it, if the obstacle can tell how deep the point is.
+func signedDistance(o Obstacle, p kinematics.Position) float64 {
+	d := o.Distance(p)
+	if inside, ok := o.(interface {
+		depth(p kinematics.Position) float64
+	}); ok && d == 0 {
+		return -inside.depth(p)
+	}
+	return d
+}
+
+// AR3LinkRadii are the radii in millimeters of capsules that enclose each of
+// the AR3's links, with a little to spare.
+var AR3LinkRadii = [6]float64{70, 60, 55, 45, 40, 35}
+
+// CollisionModel is the geometry moves are checked against before the arm
+// moves. Each link of the arm is modelled as a capsule, a line with a radius,
+// along the line between its joints from the DH parameters. The column from
+// the base to J2's height stands on the bench and is not checked. The zero
+// value has no obstacles and checks nothing.
+type CollisionModel struct {
+	// LinkRadii are the radii in millimeters of the links from J1 to J2, J2
+	// to J3 and so on to the flange.
+	LinkRadii [6]float64
+	Obstacles []Obstacle
+}
+
+// Validate checks that the radii are not negative and that every box,
+// cylinder and plane has a name and a size.
+func (m CollisionModel) Validate() error {
+	for i, r := range m.LinkRadii {
+		if r < 0 || math.IsNaN(r) {
+			return fmt.Errorf("J%d link radius must not be negative. Got %g", i+1, r)
+		}
+	}
+	for _, obstacle := range m.Obstacles {
+		if obstacle == nil || obstacle.String() == "" {
+			return errors.New("every obstacle needs a name")
+		}
+		switch o := obstacle.(type) {
+		case Box:
+			if o.Min.X > o.Max.X || o.Min.Y > o.Max.Y || o.Min.Z > o.Max.Z {
+				return fmt.Errorf("box %q max must not be below min", o.Name)
+			}
+		case Cylinder:
+			if o.Radius <= 0 || o.Height <= 0 {
+				return fmt.Errorf("cylinder %q radius and height must be positive. Got %g and %g", o.Name, o.Radius, o.Height)
+			}
+		}
+	}
+	return nil
+}
+
+// ToolLink is the Link of the tool in an ErrCollision.
+const ToolLink = 7
+
+// ErrCollision is returned by moves that would bring a link of the arm, or
+// its tool, into an obstacle.
+type ErrCollision struct {
+	// Link is the link that would hit: 1 for the link from J1 to J2, and so
+	// on to 6 for the link from J6 to the flange, or ToolLink.
+	Link     int
+	Obstacle string
+	// Joints are the joint angles in radians, and the track position in
+	// millimeters, where the link would first hit.
+	Joints [7]float64
+}
+
+// Error names the link and the obstacle it would hit.
+func (e *ErrCollision) Error() string {
+	link := "tool"
+	if e.Link != ToolLink {
+		link = fmt.Sprintf("J%d link", e.Link)
+	}
+	return fmt.Sprintf("%s would hit %s at joints %.3f", link, e.Obstacle, e.Joints[:6])
+}
+
+// capsule is a line segment with a radius.
+type capsule struct {
+	link   int
+	a, b   vec3
+	radius float64
+}
+
+// capsules returns the capsules of each link, and the tool, for joint angles
+// in radians, shifted by offset.
+func (m CollisionModel) capsules(joints [6]float64, dh kinematics.DhParameters, tool Tool, offset vec3) []capsule {
+	origins, zAxes, flange := dhFrames(joints, dh)
+	var capsules []capsule
+	add := func(link int, a, b vec3, radius float64) {
+		if radius > 0 {
+			capsules = append(capsules, capsule{link, a.add(offset), b.add(offset), radius})
+		}
+	}
+	for i := 0; i < 6; i++ {
+		// Each link runs d along the previous joint's axis, then a along
+		// its own x axis.
+		corner := origins[i].add(zAxes[i].scale(dh.DValues[i]))
+		if i > 0 {
+			add(i+1, origins[i], corner, m.LinkRadii[i])
+		}
+		add(i+1, corner, origins[i+1], m.LinkRadii[i])
+	}
+	if !tool.isFlange() {
+		add(ToolLink, origins[6], origins[6].add(flange.rotate(toVec3(tool.Offset.Position))), tool.Radius)
+	}
+	return capsules
+}
+
+// segmentDistance returns how near the line segment from a to b comes to an
+// obstacle, or how deep it reaches into it as a negative distance. The signed
+// distance to a convex obstacle is convex along the segment, so a golden
+// section search finds its minimum.
+func segmentDistance(o Obstacle, a, b vec3) float64 {
+	at := func(t float64) float64 {
+		return signedDistance(o, a.add(b.sub(a).scale(t)).position())
+	}
+	lo, hi := 0.0, 1.0
+	ratio := (math.Sqrt(5) - 1) / 2
+	x1, x2 := hi-ratio*(hi-lo), lo+ratio*(hi-lo)
+	f1, f2 := at(x1), at(x2)
+	for i := 0; i < 40; i++ {
+		if f1 < f2 {
+			hi, x2, f2 = x2, x1, f1
+			x1 = hi - ratio*(hi-lo)
+			f1 = at(x1)
+		} else {
+			lo, x1, f1 = x1, x2, f2
+			x2 = lo + ratio*(hi-lo)
+			f2 = at(x2)
+		}
+	}
+	return math.Min(math.Min(f1, f2), math.Min(at(0), at(1)))
+}
+
+// check returns an ErrCollision if any link, or the tool, is in an obstacle
+// at joint angles in radians and track position in millimeters, along with
+// how far, in millimeters, the links reach into the obstacles altogether.
+func (m CollisionModel) check(p RobotProfile, tool Tool, joints [7]float64) (float64, error) {
+	var arm [6]float64
+	copy(arm[:], joints[:6])
+	offset := toVec3(p.trackOffset(joints[6]))
+	var depth float64
+	var err error
+	for _, c := range m.capsules(arm, p.DhParameters, tool, offset) {
+		for _, obstacle := range m.Obstacles {
+			if d := segmentDistance(obstacle, c.a, c.b); d < c.radius {
+				depth += c.radius - d
+				if err == nil {
+					err = &ErrCollision{Link: c.link, Obstacle: obstacle.String(), Joints: joints}
+				}
+			}
+		}
+	}
+	return depth, err
+}
+
+// Collision checks sample joint space moves no more than this far apart, in
+// radians for joints and millimeters for the track.
+const (
+	collisionStepRad = 1 * degreesToRadians
+	collisionStepMM  = 5
+)
+
+// checkSteps checks the moves by each of relative in turn, starting from the
+// stepper position from.
+func (m CollisionModel) checkSteps(p RobotProfile, tool Tool, from [7]int, relative ...[7]int) error {
+	if len(m.Obstacles) == 0 {
+		return nil
+	}
+	return p.walkSteps(from, relative, func(joints [7]float64) (float64, error) {
+		return m.check(p, tool, joints)
+	})
+}
+
+// walkSteps calls check with the joint angles in radians, and the track
+// position in millimeters, at samples along the moves by each of relative in
+// turn, starting from the stepper position from. The AR3 moves every axis in
+// proportion, so each move is a straight line in joint space.
+//
+// check returns how far the joints are into whatever they violate, along with
+// the error. The arm is already at from, so it is not refused there: an arm
+// that starts in violation may keep violating until it first complies, as
+// long as the violation never grows, so it can always be moved back out.
+func (p RobotProfile) walkSteps(from [7]int, relative [][7]int, check func(joints [7]float64) (float64, error)) error {
+	sl := p.limitSwitchSteps()
+	angles := func(steps [7]int) [7]float64 {
+		for i := range steps {
+			steps[i] -= sl[i]
+		}
+		return p.stepsToAngles(steps, false)
+	}
+
+	start := angles(from)
+	depth, err := check(start)
+	recovering := err != nil
+	for _, move := range relative {
+		for i := range from {
+			from[i] += move[i]
+		}
+		end := angles(from)
+		n := 1
+		for i := range start {
+			step := collisionStepRad
+			if i == 6 {
+				step = collisionStepMM
+			}
+			if k := int(math.Ceil(math.Abs(end[i]-start[i]) / step)); k > n {
+				n = k
+			}
+		}
+		for k := 1; k <= n; k++ {
+			var joints [7]float64
+			for i := range joints {
+				joints[i] = start[i] + (end[i]-start[i])*float64(k)/float64(n)
+			}
+			d, err := check(joints)
+			if err == nil {
+				recovering = false
+			} else if !recovering || d > depth {
+				return err
+			}
+			depth = d
+		}
+		start = end
+	}
+	return nil
+}
+
+// SetCollisionModel sets the geometry that every move, other than
+// calibration, is checked against before the arm moves. Without a model set,
+// moves are only checked against the joint limits.
+func (ar3 *AR3exec) SetCollisionModel(model CollisionModel) error {
+	if err := model.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.collisionModel = model
+	return nil
+}
+
+// CurrentCollisionModel returns the model set with SetCollisionModel.
+func (ar3 *AR3exec) CurrentCollisionModel() CollisionModel {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.collisionModel
+}
+
+// checkMoves checks the moves by each of relative in turn, from where the arm
+// is, against the soft limits and the collision model.
+func (ar3 *AR3exec) checkMoves(relative ...[7]int) error {
+	ar3.mu.Lock()
+	limits, model, tool, from := ar3.softLimits, ar3.collisionModel, ar3.tool, ar3.jointVals
+	profile := ar3.profile
+	ar3.mu.Unlock()
+	if err := limits.checkSteps(profile, tool, from, relative...); err != nil {
+		return err
+	}
+	return model.checkSteps(profile, tool, from, relative...)
+}
+
+// SetCollisionModel simulates AR3exec.SetCollisionModel().
+func (ar3 *AR3simulate) SetCollisionModel(model CollisionModel) error {
+	if err := model.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.collisionModel = model
+	return nil
+}
+
+// CurrentCollisionModel simulates AR3exec.CurrentCollisionModel().
+func (ar3 *AR3simulate) CurrentCollisionModel() CollisionModel {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.collisionModel
+}
@@ -0,0 +1,142 @@
+package ar3
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+func TestObstacle_Distance(t *testing.T) {
+	box := Box{Name: "box", Min: kinematics.Position{X: 0, Y: 0, Z: 0}, Max: kinematics.Position{X: 10, Y: 10, Z: 10}}
+	if d := box.Distance(kinematics.Position{X: 5, Y: 5, Z: 5}); d != 0 {
+		t.Errorf("Inside the box should be 0. Got %f", d)
+	}
+	if d := box.Distance(kinematics.Position{X: 13, Y: 14, Z: 5}); math.Abs(d-5) > 1e-9 {
+		t.Errorf("Expected 5 mm from the box. Got %f", d)
+	}
+	centrifuge := Cylinder{Name: "centrifuge", Base: kinematics.Position{X: 100}, Radius: 20, Height: 50}
+	if d := centrifuge.Distance(kinematics.Position{X: 130, Z: 25}); math.Abs(d-10) > 1e-9 {
+		t.Errorf("Expected 10 mm from the side of the centrifuge. Got %f", d)
+	}
+	if d := centrifuge.Distance(kinematics.Position{X: 100, Z: 60}); math.Abs(d-10) > 1e-9 {
+		t.Errorf("Expected 10 mm above the centrifuge. Got %f", d)
+	}
+	table := Plane{Name: "table", Z: -5}
+	if d := table.Distance(kinematics.Position{Z: -10}); d != 0 {
+		t.Errorf("Below the table should be 0. Got %f", d)
+	}
+
+	// The segment passes 10 mm over the top of the box.
+	d := segmentDistance(box, vec3{-100, 5, 20}, vec3{100, 5, 20})
+	if math.Abs(d-10) > 1e-6 {
+		t.Errorf("Expected the segment to pass 10 mm from the box. Got %f", d)
+	}
+}
+
+func TestCollisionModel_Capsules(t *testing.T) {
+	var joints [6]float64
+	copy(joints[:], linearStart[:6])
+	model := CollisionModel{LinkRadii: AR3LinkRadii}
+	tool := pipette
+	tool.Radius = 5
+	capsules := model.capsules(joints, AR3DhParameters, tool, vec3{})
+	last := capsules[len(capsules)-1]
+	flange := kinematics.ForwardKinematics(joints[:], AR3DhParameters)
+	tcp := tool.tcpPose(flange)
+	if last.link != ToolLink || last.b.sub(toVec3(tcp.Position)).norm() > 1e-6 {
+		t.Errorf("Last capsule should be the tool, ending at the TCP. Got %+v", last)
+	}
+	if j6 := capsules[len(capsules)-2]; j6.b.sub(toVec3(flange.Position)).norm() > 1e-6 {
+		t.Errorf("J6 link should end at the flange. Got %+v", j6)
+	}
+	for _, c := range capsules {
+		if c.a[2] < 169 && c.link == 1 {
+			t.Errorf("The base column should not be checked. Got %+v", c)
+		}
+	}
+}
+
+func TestAR3simulate_MoveCollision(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentStepperPosition()
+	target := arm.CurrentPose()
+	target.Position.Z -= 50
+	centrifuge := Cylinder{Name: "centrifuge", Base: target.Position, Radius: 30, Height: 100}
+	centrifuge.Base.Z -= 60
+
+	model := CollisionModel{LinkRadii: AR3LinkRadii, Obstacles: []Obstacle{Plane{Name: "table", Z: -50}, centrifuge}}
+	if err := arm.SetCollisionModel(model); err != nil {
+		t.Fatalf("Model should be set. Got error: %s", err)
+	}
+	err := arm.MoveLinear(DefaultMoveParams, target, 2, 5)
+	var collision *ErrCollision
+	if !errors.As(err, &collision) || collision.Obstacle != "centrifuge" {
+		t.Errorf("Move into the centrifuge should be refused. Got %v", err)
+	}
+	if arm.CurrentStepperPosition() != start {
+		t.Errorf("Refused move should not move the arm")
+	}
+
+	if err = arm.SetCollisionModel(CollisionModel{Obstacles: []Obstacle{Box{Name: "bad", Min: kinematics.Position{X: 1}}}}); err == nil {
+		t.Errorf("Box with max below min should be refused")
+	}
+}
+
+func TestAR3exec_MoveCollision(t *testing.T) {
+	arm, mt := connectMemory(t)
+	// Reaching out, the wrist swings 400 mm as J1 turns.
+	reaching := [7]float64{0, 0.4, 0.3, 0, 0.8, 0, 0}
+	from, to := reaching, reaching
+	from[0], to[0] = -0.5, 0.5
+	arm.SetJointRadians(from)
+
+	// A box where the wrist passes half way, but clear of both ends.
+	var middle [6]float64
+	copy(middle[:], reaching[:6])
+	origins, _, _ := dhFrames(middle, AR3DhParameters)
+	wrist := origins[4].position()
+	box := Box{Name: "bottle", Min: wrist, Max: wrist}
+	if err := arm.SetCollisionModel(CollisionModel{LinkRadii: AR3LinkRadii, Obstacles: []Obstacle{box}}); err != nil {
+		t.Fatalf("Model should be set. Got error: %s", err)
+	}
+
+	err := arm.MoveJointRadiansWithParams(DefaultMoveParams, to[0], to[1], to[2], to[3], to[4], to[5], to[6])
+	var collision *ErrCollision
+	if !errors.As(err, &collision) || collision.Obstacle != "bottle" || math.Abs(collision.Joints[0]) > 0.2 {
+		t.Errorf("Move through the bottle should be refused half way. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for a refused move. Got %v", mt.Commands())
+	}
+}
+
+func TestAR3simulate_MoveCollisionRecovery(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	clear := start
+	clear.Position.Z += 30
+	// The table has been raised into the flange.
+	table := Plane{Name: "table", Z: start.Position.Z + 10}
+	model := CollisionModel{LinkRadii: AR3LinkRadii, Obstacles: []Obstacle{table}}
+	if err := arm.SetCollisionModel(model); err != nil {
+		t.Fatalf("Model should be set. Got error: %s", err)
+	}
+	if _, err := model.check(AR3Profile, arm.CurrentTool(), arm.CurrentJointRadians()); err == nil {
+		t.Fatalf("Arm should start in the table")
+	}
+
+	lower := start
+	lower.Position.Z -= 20
+	err := arm.MoveWithParams(DefaultMoveParams, lower)
+	var collision *ErrCollision
+	if !errors.As(err, &collision) {
+		t.Errorf("Move further into the table should be refused. Got %v", err)
+	}
+	if err = arm.MoveWithParams(DefaultMoveParams, clear); err != nil {
+		t.Errorf("Move up out of the table should be allowed. Got error: %s", err)
+	}
+}
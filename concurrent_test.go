@@ -0,0 +1,90 @@
+package ar3
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hammer runs f from many goroutines at once. Run with -race to catch
+// unguarded state.
+func hammer(f func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				f(i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// hammerArm moves arm while reading and writing its state from many
+// goroutines.
+func hammerArm(t *testing.T, arm Arm) {
+	hammer(func(i int) {
+		switch i % 6 {
+		case 0:
+			if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0.1, 0, 0, 0, 0, 0, 0); err != nil {
+				t.Errorf("Move should succeed. Got error: %s", err)
+			}
+		case 1:
+			if err := arm.MoveSteppersWithParams(DefaultMoveParams, 100, 100, 100, 100, 100, 100, 0); err != nil {
+				t.Errorf("Move should succeed. Got error: %s", err)
+			}
+		case 2:
+			arm.CurrentPose()
+			arm.CurrentTrackPose()
+		case 3:
+			arm.SetDirections(arm.GetDirections())
+			arm.CurrentStepperPosition()
+		case 4:
+			if err := arm.Echo(); err != nil {
+				t.Errorf("Echo should succeed. Got error: %s", err)
+			}
+		case 5:
+			arm.SetJointRadians(arm.CurrentJointRadians())
+		}
+	})
+}
+
+func TestAR3simulate_Concurrent(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	hammerArm(t, arm)
+	hammer(func(i int) {
+		if i%2 == 0 {
+			arm.SetJointRadians([7]float64{0, 0, 0, 0, 0, 0, 0})
+		} else {
+			_ = arm.Calibrate(50, true, true, true, true, true, true, false)
+		}
+	})
+}
+
+func TestAR3exec_Concurrent(t *testing.T) {
+	arm, mt := connectMemory(t)
+	hammerArm(t, arm)
+
+	// Every move must be directly followed by the echo that confirms it, so
+	// commands from different goroutines cannot have interleaved.
+	commands := mt.Commands()
+	for i, command := range commands {
+		if strings.HasPrefix(command, "MJ") {
+			if i+1 == len(commands) || commands[i+1] != "TMTest" {
+				t.Fatalf("Move %d should be followed by its echo. Got %v", i, commands[i:])
+			}
+		}
+	}
+}
+
+func TestAR3exec_Closed(t *testing.T) {
+	arm, _ := connectMemory(t)
+	if err := arm.Close(); err != nil {
+		t.Errorf("Close should succeed. Got error: %s", err)
+	}
+	if err := arm.Echo(); err != ErrTransportClosed {
+		t.Errorf("Echo after Close should fail with ErrTransportClosed. Got %v", err)
+	}
+}
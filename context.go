@@ -0,0 +1,162 @@
+package ar3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/trilobio/ar3/protocol"
+	"github.com/trilobio/kinematics"
+)
+
+// ArmContext is an Arm whose commands can be cancelled. Each method behaves
+// like its Arm counterpart, but gives up once ctx is cancelled or its deadline
+// passes, returning an error that wraps ctx.Err() (for example
+// context.DeadlineExceeded).
+//
+// A command that is given up on may still be running on the arm, so the
+// position of the arm should be treated as unknown until it is calibrated:
+// every joint of a move that is given up on is marked not calibrated.
+type ArmContext interface {
+	Arm
+
+	CalibrateContext(ctx context.Context, speed int, j1, j2, j3, j4, j5, j6, tr bool) error
+	EchoContext(ctx context.Context) error
+
+	MoveSteppersContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error
+	MoveJointRadiansContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd int, j1, j2, j3, j4, j5, j6, tr float64) error
+	MoveContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd int, pose kinematics.Pose) error
+
+	// SetCommandTimeout limits how long each command sent to the arm waits
+	// for its response. A timeout of 0 (the default) waits forever.
+	SetCommandTimeout(timeout time.Duration)
+}
+
+// readDeadliner is implemented by Transports whose ReadLine can be
+// interrupted by a deadline, such as the serial port. Only these Transports
+// can give up on a command that has already been sent.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// SetCommandTimeout limits how long each command sent to the AR3 waits for
+// its response. A timeout of 0 waits forever.
+func (ar3 *AR3exec) SetCommandTimeout(timeout time.Duration) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.timeout = timeout
+}
+
+// exchange sends a command to the AR3 and reads back a single response line,
+// giving up when ctx is done or the command timeout passes. It must run on the
+// command loop.
+func (ar3 *AR3exec) exchange(ctx context.Context, command []byte) (string, error) {
+	ar3.mu.Lock()
+	timeout := ar3.timeout
+	ar3.mu.Unlock()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("command not sent to AR3: %w", err)
+	}
+	ar3.mu.Lock()
+	stale := ar3.stale
+	ar3.stale = false
+	ar3.mu.Unlock()
+	if stale {
+		if err := ar3.clearBuffer(); err != nil {
+			ar3.markStale()
+			return "", err
+		}
+	}
+	if err := ar3.writeCommand(command); err != nil {
+		return "", err
+	}
+	return ar3.readLine(ctx)
+}
+
+// readLine reads a response line off serial, giving up when ctx is done or
+// Stop is called.
+func (ar3 *AR3exec) readLine(ctx context.Context) (string, error) {
+	// Transports without deadlines cannot be interrupted, so ctx is only
+	// checked before the command is sent.
+	rd, ok := ar3.serial.(readDeadliner)
+	if !ok {
+		return ar3.readResponse()
+	}
+	ar3.mu.Lock()
+	if ar3.abort == nil {
+		ar3.abort = make(chan struct{})
+	}
+	abort := ar3.abort
+	ar3.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := rd.SetReadDeadline(deadline); err != nil {
+			return "", err
+		}
+	}
+	// Cancellation and Stop have no deadline of their own, so they interrupt
+	// the read by moving the deadline to now.
+	stop := make(chan struct{})
+	aborted := false
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			_ = rd.SetReadDeadline(time.Now())
+		case <-abort:
+			aborted = true
+			_ = rd.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	line, err := ar3.readResponse()
+	close(stop)
+	wg.Wait()
+	_ = rd.SetReadDeadline(time.Time{})
+
+	if err != nil && aborted {
+		ar3.markStale()
+		return line, ErrStopped
+	}
+
+	// The read deadline can pass a moment before ctx notices its own.
+	if err != nil && (ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded)) {
+		// The response may still arrive, so it is flushed before the next
+		// command is sent.
+		ar3.markStale()
+		ctxErr := ctx.Err()
+		if ctxErr == nil {
+			ctxErr = context.DeadlineExceeded
+		}
+		return line, fmt.Errorf("no response from AR3: %w", ctxErr)
+	}
+	return line, err
+}
+
+// readResponse reads the next line off serial, skipping answers to Stop,
+// which is sent from outside the command loop and can be answered late.
+func (ar3 *AR3exec) readResponse() (string, error) {
+	for {
+		line, err := ar3.serial.ReadLine()
+		if err != nil || line != protocol.StopResponse {
+			return line, err
+		}
+	}
+}
+
+// markStale has serial flushed before the next command is sent.
+func (ar3 *AR3exec) markStale() {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.stale = true
+}
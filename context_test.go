@@ -0,0 +1,155 @@
+package ar3
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stalledTransport is a MemoryTransport whose ReadLine blocks until its read
+// deadline when there is nothing to read, like a serial port attached to an
+// arm that has stopped answering.
+type stalledTransport struct {
+	*MemoryTransport
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (s *stalledTransport) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	return nil
+}
+
+func (s *stalledTransport) ReadLine() (string, error) {
+	for {
+		line, err := s.MemoryTransport.ReadLine()
+		if err != ErrNoResponse {
+			return line, err
+		}
+		s.mu.Lock()
+		deadline := s.deadline
+		s.mu.Unlock()
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return "", os.ErrDeadlineExceeded
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// connectStalled connects to an arm that answers echoes but never finishes
+// a move.
+func connectStalled(t *testing.T) (*AR3exec, *stalledTransport) {
+	t.Helper()
+	st := &stalledTransport{MemoryTransport: NewMemoryTransport(func(command string) []string {
+		if strings.HasPrefix(command, "TM") {
+			return []string{command[2:]}
+		}
+		return nil
+	})}
+	arm, err := ConnectTransport(st, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	return arm.(*AR3exec), st
+}
+
+// TestArmContextInterface checks that both arms implement ArmContext.
+func TestArmContextInterface(t *testing.T) {
+	var _ ArmContext = &AR3exec{}
+	var _ ArmContext = &AR3simulate{}
+}
+
+func TestAR3exec_MoveSteppersContextDeadline(t *testing.T) {
+	arm, _ := connectStalled(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := arm.MoveSteppersContext(ctx, 25, 15, 10, 20, 5, 500, 500, 500, 500, 500, 500, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stalled move should fail with context.DeadlineExceeded. Got %v", err)
+	}
+}
+
+func TestAR3exec_MoveJointRadiansContextCancel(t *testing.T) {
+	arm, _ := connectStalled(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	err := arm.MoveJointRadiansContext(ctx, 25, 15, 10, 20, 5, 0, 0, math.Pi/4, 0, 0, 0, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled move should fail with context.Canceled. Got %v", err)
+	}
+}
+
+func TestAR3exec_MoveTimeoutUncalibrates(t *testing.T) {
+	arm, _ := connectStalled(t)
+	arm.MarkCalibrated([7]bool{true, true, true, true, true, true, true})
+	arm.AllowUncalibratedMotion(false)
+	arm.SetCommandTimeout(20 * time.Millisecond)
+	pos, sl := arm.CurrentStepperPosition(), arm.LimitSwitchSteps()
+	for i := range pos {
+		pos[i] -= sl[i]
+	}
+	err := arm.MoveSteppers(25, 15, 10, 20, 5, pos[0]-500, pos[1], pos[2], pos[3], pos[4], pos[5], pos[6])
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stalled move should time out. Got %v", err)
+	}
+	if got := arm.CalibratedJoints(); got != [7]bool{false, true, true, true, true, true, true} {
+		t.Errorf("Only J1, which was moving, should need calibrating. Got %v", got)
+	}
+	err = arm.MoveSteppers(25, 15, 10, 20, 5, pos[0], pos[1]+500, pos[2], pos[3], pos[4], pos[5], pos[6])
+	if !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Move after a timed out move should fail with ErrNotCalibrated. Got %v", err)
+	}
+}
+
+func TestAR3exec_SetCommandTimeout(t *testing.T) {
+	arm, st := connectStalled(t)
+	arm.SetCommandTimeout(20 * time.Millisecond)
+	err := arm.Calibrate(25, true, true, true, true, true, true, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stalled calibration should time out. Got %v", err)
+	}
+
+	// A late response to the calibration should be flushed before the next
+	// command, rather than read as its response.
+	st.pending = append(st.pending, "pass")
+	if err = arm.Echo(); err != nil {
+		t.Errorf("Echo after a timeout should succeed. Got error: %s", err)
+	}
+}
+
+func TestAR3exec_EchoContextDone(t *testing.T) {
+	arm, mt := connectMemory(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := arm.EchoContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Echo with a cancelled context should fail. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent with a cancelled context. Got %v", mt.Commands())
+	}
+}
+
+func TestAR3simulate_MoveContext(t *testing.T) {
+	arm := connectCalibrated(AR3Profile).(ArmContext)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := arm.MoveContext(ctx, 25, 15, 10, 20, 5, arm.CurrentPose()); err != nil {
+		t.Errorf("Move should succeed. Got error: %s", err)
+	}
+	cancel()
+	if err := arm.MoveContext(ctx, 25, 15, 10, 20, 5, arm.CurrentPose()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Move with a cancelled context should fail. Got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package ar3
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// vec3 is a position or direction in millimeters.
+type vec3 [3]float64
+
+// toVec3 converts a kinematics.Position to a vec3.
+func toVec3(p kinematics.Position) vec3 {
+	return vec3{p.X, p.Y, p.Z}
+}
+
+// position converts v back to a kinematics.Position.
+func (v vec3) position() kinematics.Position {
+	return kinematics.Position{X: v[0], Y: v[1], Z: v[2]}
+}
+
+// add returns v + w.
+func (v vec3) add(w vec3) vec3 {
+	return vec3{v[0] + w[0], v[1] + w[1], v[2] + w[2]}
+}
+
+// sub returns v - w.
+func (v vec3) sub(w vec3) vec3 {
+	return vec3{v[0] - w[0], v[1] - w[1], v[2] - w[2]}
+}
+
+// scale returns v times s.
+func (v vec3) scale(s float64) vec3 {
+	return vec3{v[0] * s, v[1] * s, v[2] * s}
+}
+
+// dot returns the dot product of v and w.
+func (v vec3) dot(w vec3) float64 {
+	return v[0]*w[0] + v[1]*w[1] + v[2]*w[2]
+}
+
+// cross returns the cross product of v and w.
+func (v vec3) cross(w vec3) vec3 {
+	return vec3{v[1]*w[2] - v[2]*w[1], v[2]*w[0] - v[0]*w[2], v[0]*w[1] - v[1]*w[0]}
+}
+
+// norm returns the length of v.
+func (v vec3) norm() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+// unitQuaternion returns q as a unit quaternion, correcting the quaternions
+// kinematics.ForwardKinematics gets wrong (see rotationFromQuaternion).
+func unitQuaternion(q kinematics.Quaternion) kinematics.Quaternion {
+	return quaternionFromRotation(rotationFromQuaternion(q))
+}
+
+// steps returns how many waypoints a path of length mm millimeters, turning
+// deg degrees, needs so that no step is longer than stepMM or turns more than
+// stepDeg. It is always at least 1.
+func steps(mm, deg, stepMM, stepDeg float64) int {
+	n := int(math.Max(math.Ceil(mm/stepMM), math.Ceil(deg/stepDeg)))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// interpolateArc splits the circular arc that starts at start, passes through
+// via and ends at end into waypoints no more than stepMM apart along the arc.
+// The end effector turns steadily from start's rotation to end's, by no more
+// than stepDeg degrees between waypoints; via's rotation is ignored.
+func interpolateArc(start, via, end kinematics.Pose, stepMM, stepDeg float64) ([]kinematics.Pose, error) {
+	if stepMM <= 0 || stepDeg <= 0 {
+		return nil, fmt.Errorf("path steps must be positive. Got %g mm and %g degrees", stepMM, stepDeg)
+	}
+	a, b, c := toVec3(start.Position), toVec3(via.Position), toVec3(end.Position)
+	// The circle's center, from the circumcenter of triangle abc.
+	u, w := a.sub(c), b.sub(c)
+	normal := u.cross(w)
+	if normal.norm() <= 1e-6*u.norm()*w.norm() {
+		return nil, fmt.Errorf("arc start, via and end points must not be in a line")
+	}
+	center := c.add(w.scale(u.dot(u)).sub(u.scale(w.dot(w))).cross(normal).scale(1 / (2 * normal.dot(normal))))
+	radius := a.sub(center).norm()
+
+	// Measure angles around the circle from start, in the direction of via.
+	e1 := a.sub(center).scale(1 / radius)
+	e2 := b.sub(a).cross(c.sub(b)).cross(e1)
+	e2 = e2.scale(1 / e2.norm())
+	angleOf := func(p vec3) float64 {
+		d := p.sub(center)
+		theta := math.Atan2(d.dot(e2), d.dot(e1))
+		if theta < 0 {
+			theta += 2 * math.Pi
+		}
+		return theta
+	}
+	sweep := angleOf(c)
+
+	qa, qb := unitQuaternion(start.Rotation), unitQuaternion(end.Rotation)
+	n := steps(radius*sweep, rotationAngle(qa, qb)/degreesToRadians, stepMM, stepDeg)
+	waypoints := make([]kinematics.Pose, n)
+	for i := range waypoints {
+		t := float64(i+1) / float64(n)
+		theta := t * sweep
+		p := center.add(e1.scale(radius * math.Cos(theta))).add(e2.scale(radius * math.Sin(theta)))
+		waypoints[i] = kinematics.Pose{Position: p.position(), Rotation: slerp(qa, qb, t)}
+	}
+	waypoints[n-1].Position = end.Position
+	return waypoints, nil
+}
+
+// catmullRom returns the point at t, from 0 to 1, of the uniform Catmull-Rom
+// segment from p1 to p2, shaped by p0 before it and p3 after it.
+func catmullRom(p0, p1, p2, p3 vec3, t float64) vec3 {
+	t2, t3 := t*t, t*t*t
+	var out vec3
+	for i := range out {
+		out[i] = 0.5 * (2*p1[i] +
+			(p2[i]-p0[i])*t +
+			(2*p0[i]-5*p1[i]+4*p2[i]-p3[i])*t2 +
+			(3*p1[i]-p0[i]-3*p2[i]+p3[i])*t3)
+	}
+	return out
+}
+
+// splineSamples is how many pieces a spline segment is split into to estimate
+// its length.
+const splineSamples = 16
+
+// interpolateSpline splits a Catmull-Rom spline from start through each of
+// points into waypoints no more than about stepMM apart. The curve passes
+// through every point, and the end effector turns steadily from one point's
+// rotation to the next, by no more than stepDeg degrees between waypoints.
+func interpolateSpline(start kinematics.Pose, points []kinematics.Pose, stepMM, stepDeg float64) ([]kinematics.Pose, error) {
+	if stepMM <= 0 || stepDeg <= 0 {
+		return nil, fmt.Errorf("path steps must be positive. Got %g mm and %g degrees", stepMM, stepDeg)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("spline needs at least one point")
+	}
+	poses := append([]kinematics.Pose{start}, points...)
+	knots := make([]vec3, len(poses))
+	rotations := make([]kinematics.Quaternion, len(poses))
+	for i, pose := range poses {
+		knots[i] = toVec3(pose.Position)
+		rotations[i] = unitQuaternion(pose.Rotation)
+	}
+	// The ends are repeated so the curve starts and finishes on them.
+	knot := func(i int) vec3 {
+		if i < 0 {
+			i = 0
+		} else if i >= len(knots) {
+			i = len(knots) - 1
+		}
+		return knots[i]
+	}
+
+	var waypoints []kinematics.Pose
+	for i := 0; i < len(knots)-1; i++ {
+		p0, p1, p2, p3 := knot(i-1), knots[i], knots[i+1], knot(i+2)
+		length, previous := 0.0, p1
+		for s := 1; s <= splineSamples; s++ {
+			point := catmullRom(p0, p1, p2, p3, float64(s)/splineSamples)
+			length += point.sub(previous).norm()
+			previous = point
+		}
+		n := steps(length, rotationAngle(rotations[i], rotations[i+1])/degreesToRadians, stepMM, stepDeg)
+		for s := 1; s <= n; s++ {
+			t := float64(s) / float64(n)
+			waypoints = append(waypoints, kinematics.Pose{
+				Position: catmullRom(p0, p1, p2, p3, t).position(),
+				Rotation: slerp(rotations[i], rotations[i+1], t),
+			})
+		}
+		waypoints[len(waypoints)-1].Position = points[i].Position
+	}
+	return waypoints, nil
+}
+
+// MoveCircular moves the end effector along the circular arc from where it is,
+// through via's position, to pose, turning it steadily from its current
+// rotation to pose's on the way. The arc is split into waypoints like
+// MoveLinear, and the whole arc is solved and checked against the joint
+// limits before the arm moves.
+func (ar3 *AR3exec) MoveCircular(params MoveParams, via, pose kinematics.Pose, stepMM, stepDeg float64) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		waypoints, err := interpolateArc(ar3.CurrentPose(), via, pose, stepMM, stepDeg)
+		if err != nil {
+			return err
+		}
+		return ar3.movePath(ctx, params, waypoints)
+	})
+}
+
+// MoveSpline moves the end effector along a smooth Catmull-Rom spline from
+// where it is through each of points in turn, finishing at the last. The
+// spline is split into waypoints like MoveLinear, and the whole spline is
+// solved and checked against the joint limits before the arm moves.
+func (ar3 *AR3exec) MoveSpline(params MoveParams, points []kinematics.Pose, stepMM, stepDeg float64) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		waypoints, err := interpolateSpline(ar3.CurrentPose(), points, stepMM, stepDeg)
+		if err != nil {
+			return err
+		}
+		return ar3.movePath(ctx, params, waypoints)
+	})
+}
+
+// MoveCircular simulates AR3exec.MoveCircular().
+func (ar3 *AR3simulate) MoveCircular(params MoveParams, via, pose kinematics.Pose, stepMM, stepDeg float64) error {
+	waypoints, err := interpolateArc(ar3.CurrentPose(), via, pose, stepMM, stepDeg)
+	if err != nil {
+		return err
+	}
+	return ar3.movePath(params, waypoints)
+}
+
+// MoveSpline simulates AR3exec.MoveSpline().
+func (ar3 *AR3simulate) MoveSpline(params MoveParams, points []kinematics.Pose, stepMM, stepDeg float64) error {
+	waypoints, err := interpolateSpline(ar3.CurrentPose(), points, stepMM, stepDeg)
+	if err != nil {
+		return err
+	}
+	return ar3.movePath(params, waypoints)
+}
@@ -0,0 +1,128 @@
+package ar3
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+func TestInterpolateArc(t *testing.T) {
+	rotation := kinematics.Quaternion{W: 1}
+	start := kinematics.Pose{Position: kinematics.Position{X: 10}, Rotation: rotation}
+	via := kinematics.Pose{Position: kinematics.Position{Y: 10}, Rotation: rotation}
+	end := kinematics.Pose{Position: kinematics.Position{X: -10}, Rotation: rotation}
+
+	waypoints, err := interpolateArc(start, via, end, 1, 5)
+	if err != nil {
+		t.Fatalf("Interpolation should succeed. Got error: %s", err)
+	}
+	// Half a circle of radius 10 is 31.4 mm long.
+	if len(waypoints) != 32 {
+		t.Errorf("Expected 32 waypoints. Got %d", len(waypoints))
+	}
+	for _, waypoint := range waypoints {
+		p := toVec3(waypoint.Position)
+		if math.Abs(p.norm()-10) > 1e-9 || p[1] < -1e-9 {
+			t.Errorf("Waypoint should be on the arc through via. Got %+v", p)
+		}
+	}
+	if last := waypoints[len(waypoints)-1]; last.Position != end.Position {
+		t.Errorf("Last waypoint should be the end. Got %+v", last.Position)
+	}
+
+	via.Position = kinematics.Position{}
+	if _, err = interpolateArc(start, via, end, 1, 5); err == nil {
+		t.Errorf("Arc through points in a line should be refused")
+	}
+}
+
+func TestInterpolateSpline(t *testing.T) {
+	rotation := kinematics.Quaternion{W: 1}
+	start := kinematics.Pose{Rotation: rotation}
+	points := []kinematics.Pose{
+		{Position: kinematics.Position{X: 10, Y: 10}, Rotation: rotation},
+		{Position: kinematics.Position{X: 20}, Rotation: rotation},
+		{Position: kinematics.Position{X: 30, Y: 10}, Rotation: rotation},
+	}
+	waypoints, err := interpolateSpline(start, points, 2, 5)
+	if err != nil {
+		t.Fatalf("Interpolation should succeed. Got error: %s", err)
+	}
+	// The spline should pass through every point, in order.
+	next := 0
+	for _, waypoint := range waypoints {
+		if next < len(points) && waypoint.Position == points[next].Position {
+			next++
+		}
+	}
+	if next != len(points) {
+		t.Errorf("Spline should pass through every point. Got %+v", waypoints)
+	}
+	for i := 1; i < len(waypoints); i++ {
+		if step := toVec3(waypoints[i].Position).sub(toVec3(waypoints[i-1].Position)).norm(); step > 2.5 {
+			t.Errorf("Waypoints should be about 2 mm apart. Got %f", step)
+		}
+	}
+
+	if _, err = interpolateSpline(start, nil, 2, 5); err == nil {
+		t.Errorf("Spline without points should be refused")
+	}
+}
+
+func TestAR3simulate_MoveCircular(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	via, end := start, start
+	via.Position.Y += 30
+	via.Position.Z -= 30
+	end.Position.Z -= 60
+
+	if err := arm.MoveCircular(DefaultMoveParams, via, end, 2, 5); err != nil {
+		t.Fatalf("Circular move should succeed. Got error: %s", err)
+	}
+	if d := toVec3(arm.CurrentPose().Position).sub(toVec3(end.Position)).norm(); d > 1 {
+		t.Errorf("Circular move should reach the end. Got %f mm off", d)
+	}
+}
+
+func TestAR3simulate_MoveSpline(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	var points []kinematics.Pose
+	for i := 1; i <= 4; i++ {
+		point := start
+		point.Position.Y += 20 * float64(i)
+		point.Position.Z -= 20 * float64(i%2)
+		points = append(points, point)
+	}
+
+	if err := arm.MoveSpline(DefaultMoveParams, points, 2, 5); err != nil {
+		t.Fatalf("Spline move should succeed. Got error: %s", err)
+	}
+	if d := toVec3(arm.CurrentPose().Position).sub(toVec3(points[3].Position)).norm(); d > 1 {
+		t.Errorf("Spline move should reach the last point. Got %f mm off", d)
+	}
+}
+
+func TestAR3exec_MoveCircular(t *testing.T) {
+	arm, mt := connectMemory(t)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	via, end := start, start
+	via.Position.X += 2000
+	via.Position.Y += 2000
+	end.Position.Y += 4000
+
+	// A circle this big leaves the arm's reach, so nothing should move.
+	err := arm.MoveCircular(DefaultMoveParams, via, end, 1000, 5)
+	if err == nil || !strings.Contains(err.Error(), "waypoint") {
+		t.Errorf("Arc out of reach should fail at a waypoint. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for an arc that fails. Got %v", mt.Commands())
+	}
+}
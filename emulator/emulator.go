@@ -0,0 +1,150 @@
+/*
+Package emulator is a firmware-level emulator of the arduino sketch that runs
+the AR3 robotic arm.
+
+Rather than skipping the wire protocol like ar3.AR3simulate does, the emulator
+opens a linux pseudo-terminal and parses the exact strings that ar3.AR3exec
+sends over serial:
+
+ TM  echo, answered with the echoed text
+ MJ  move joints, answered once the (virtual) move is complete
+ LL  calibrate, answered with pass once every homed axis hits its limit switch
+ RP  request position, answered with the encoder position of J1 through J6
+ ST  stop, answered with Stopped as every move is already complete
+
+The emulator keeps track of virtual stepper counts for each axis, so a program
+can connect to it with ar3.Connect(emulator.Name(), ...) and be tested end to
+end without any hardware. examples/emulator runs an emulator until interrupted,
+which is handy for pointing the CLI at.
+
+Stepper counts are tracked the way the arduino sees them: a direction bit of 0
+adds steps and a direction bit of 1 removes them. For an arm connected with all
+joint directions set to false, these counts line up with
+ar3.Arm.CurrentStepperPosition.
+
+The virtual encoders follow the stepper counts exactly, unless drift is added
+with AddDrift to simulate missed steps.
+*/
+package emulator
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/trilobio/ar3/protocol"
+)
+
+// Emulator emulates the arduino of an AR3 robotic arm.
+type Emulator struct {
+	pty *pty
+
+	mu       sync.Mutex
+	steps    [7]int
+	drift    [6]int
+	commands []string
+}
+
+// Steps returns the virtual stepper counts of each axis.
+func (e *Emulator) Steps() [7]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.steps
+}
+
+// SetSteps sets the virtual stepper counts of each axis.
+func (e *Emulator) SetSteps(steps [7]int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.steps = steps
+}
+
+// AddDrift offsets the virtual encoders of J1 through J6 from the stepper
+// counts, as though the steppers had missed drift steps. Drift accumulates
+// until the joint is calibrated.
+func (e *Emulator) AddDrift(drift [6]int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range drift {
+		e.drift[i] += drift[i]
+	}
+}
+
+// Encoders returns the virtual encoder positions of J1 through J6.
+func (e *Emulator) Encoders() [6]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.encoders()
+}
+
+// encoders is Encoders without locking.
+func (e *Emulator) encoders() [6]int {
+	var encoders [6]int
+	for i := range encoders {
+		encoders[i] = e.steps[i] + e.drift[i]
+	}
+	return encoders
+}
+
+// Commands returns every command the emulator has received, with line endings
+// removed.
+func (e *Emulator) Commands() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	commands := make([]string, len(e.commands))
+	copy(commands, e.commands)
+	return commands
+}
+
+// Handle processes a single command, updating the virtual steppers, and
+// returns the bytes the arduino sketch would write back. Commands the sketch
+// does not understand get no response.
+func (e *Emulator) Handle(command string) string {
+	command = strings.TrimRight(command, "\r\n")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands = append(e.commands, command)
+
+	decoded, err := protocol.Decode([]byte(command))
+	if err != nil {
+		// The sketch fails a calibration it cannot parse, and silently
+		// drops anything else.
+		if strings.HasPrefix(command, protocol.CalibrateCode) {
+			return protocol.CalibrateFail + "\n"
+		}
+		return ""
+	}
+	switch c := decoded.(type) {
+	case protocol.EchoCommand:
+		// The sketch prints the received string, newline included, with
+		// Serial.println, so the echo ends with \n\r\n.
+		return c.Text + "\n\r\n"
+	case protocol.MoveCommand:
+		for i, axis := range c.Axes {
+			if axis.Reverse {
+				e.steps[i] -= axis.Steps
+			} else {
+				e.steps[i] += axis.Steps
+			}
+		}
+		return "Done\n"
+	case protocol.CalibrateCommand:
+		// Every axis given a non-zero step count drives into its limit
+		// switch, which is where AR3exec considers the axis zeroed.
+		for i, axis := range c.Axes {
+			if axis.Steps != 0 {
+				e.steps[i] = 0
+				if i < len(e.drift) {
+					e.drift[i] = 0
+				}
+			}
+		}
+		return protocol.CalibratePass + "\n"
+	case protocol.RequestPositionCommand:
+		return string(protocol.PositionResponse{Steps: e.encoders()}.Encode())
+	case protocol.StopCommand:
+		// Moves finish as soon as they are handled, so there is never a
+		// move to stop.
+		return protocol.StopResponse + "\n"
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package emulator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/trilobio/ar3"
+)
+
+func TestEmulator_Handle(t *testing.T) {
+	var e Emulator
+	if response := e.Handle("TMTest\n"); response != "Test\n\r\n" {
+		t.Errorf("Echo should respond with Test\\n\\r\\n. Got %q", response)
+	}
+	if response := e.Handle("MJA0500B1200C00D00E00F00T00S25G10H15I20K5\n"); response != "Done\n" {
+		t.Errorf("Move should respond with Done. Got %q", response)
+	}
+	if e.Steps() != [7]int{500, -200, 0, 0, 0, 0, 0} {
+		t.Errorf("Steps should be [500 -200 0 0 0 0 0]. Got %v", e.Steps())
+	}
+	if response := e.Handle("LLA015200B00C00D00E00F00T00S25\n"); response != "pass\n" {
+		t.Errorf("Calibrate should respond with pass. Got %q", response)
+	}
+	if e.Steps() != [7]int{0, -200, 0, 0, 0, 0, 0} {
+		t.Errorf("Only J1 should be homed. Got %v", e.Steps())
+	}
+	if response := e.Handle("ST\n"); response != "Stopped\n" {
+		t.Errorf("Stop should respond with Stopped. Got %q", response)
+	}
+	if response := e.Handle("ZZ\n"); response != "" {
+		t.Errorf("Unknown commands should get no response. Got %q", response)
+	}
+	if len(e.Commands()) != 5 {
+		t.Errorf("Emulator should have recorded 5 commands. Got %v", e.Commands())
+	}
+}
+
+func TestEmulator_BadMove(t *testing.T) {
+	var e Emulator
+	if response := e.Handle("MJA0500S25\n"); response != "" {
+		t.Errorf("Malformed moves should get no response. Got %q", response)
+	}
+}
+
+// TestEmulator_Connect drives a real AR3exec over the emulator's
+// pseudo-terminal.
+func TestEmulator_Connect(t *testing.T) {
+	e, err := New()
+	if err != nil {
+		t.Skipf("Could not open a pseudo-terminal: %s", err)
+	}
+	defer e.Close()
+
+	arm, err := ar3.Connect(e.Name(), [7]bool{}, ar3.AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect to emulator. Got error: %s", err)
+	}
+	defer arm.Close()
+
+	err = arm.Calibrate(25, true, true, true, true, true, true, false)
+	if err != nil {
+		t.Errorf("Failed to calibrate. Got error: %s", err)
+	}
+	err = arm.MoveJointRadians(25, 15, 10, 20, 5, 0, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Errorf("Failed to move home. Got error: %s", err)
+	}
+	steps, expected := e.Steps(), arm.CurrentStepperPosition()
+	for i := 0; i < 6; i++ {
+		if steps[i] != expected[i] {
+			t.Errorf("Emulator steps %v should match arm steps %v", steps, expected)
+			break
+		}
+	}
+}
+
+// TestEmulator_Stop stops a real AR3exec over the emulator's pseudo-terminal,
+// checking that the answer to each stop is not taken for the answer to a
+// later command.
+func TestEmulator_Stop(t *testing.T) {
+	e, err := New()
+	if err != nil {
+		t.Skipf("Could not open a pseudo-terminal: %s", err)
+	}
+	defer e.Close()
+
+	arm, err := ar3.Connect(e.Name(), [7]bool{}, ar3.AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect to emulator. Got error: %s", err)
+	}
+	defer arm.Close()
+
+	if err = arm.Calibrate(25, true, true, true, true, true, true, false); err != nil {
+		t.Fatalf("Failed to calibrate. Got error: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err = arm.Stop(); err != nil {
+			t.Fatalf("Failed to stop. Got error: %s", err)
+		}
+		if err = arm.Echo(); err != nil {
+			t.Fatalf("Echo after stop should succeed. Got error: %s", err)
+		}
+	}
+	err = arm.MoveJointRadians(25, 15, 10, 20, 5, 0, 0, 0, 0, 0, 0, 0)
+	if !errors.Is(err, ar3.ErrNotCalibrated) {
+		t.Errorf("Move after stop should fail with ErrNotCalibrated. Got %v", err)
+	}
+	if err = arm.Calibrate(25, true, true, true, true, true, true, false); err != nil {
+		t.Fatalf("Failed to calibrate after stop. Got error: %s", err)
+	}
+	if err = arm.MoveJointRadians(25, 15, 10, 20, 5, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("Move after calibrating should succeed. Got error: %s", err)
+	}
+	steps, expected := e.Steps(), arm.CurrentStepperPosition()
+	for i := 0; i < 6; i++ {
+		if steps[i] != expected[i] {
+			t.Errorf("Emulator steps %v should match arm steps %v", steps, expected)
+			break
+		}
+	}
+
+	stops := 0
+	for _, command := range e.Commands() {
+		if command == "ST" {
+			stops++
+		}
+	}
+	if stops != 10 {
+		t.Errorf("Emulator should have received 10 stops. Got %d", stops)
+	}
+}
+
+func TestEmulator_BadCalibrate(t *testing.T) {
+	var e Emulator
+	if response := e.Handle("LLA015200\n"); response != "fail\n" {
+		t.Errorf("Malformed calibrations should fail. Got %q", response)
+	}
+}
+
+func TestEmulator_Encoders(t *testing.T) {
+	var e Emulator
+	e.Handle("MJA0500B1200C00D00E00F00T00S25G10H15I20K5\n")
+	e.AddDrift([6]int{0, 3})
+	if response := e.Handle("RP\n"); response != "A500B-197C0D0E0F0\n" {
+		t.Errorf("Encoders should include drift. Got %q", response)
+	}
+	e.Handle("LLA00B14600C00D00E00F00T00S25\n")
+	if e.Encoders() != [6]int{500, 0, 0, 0, 0, 0} {
+		t.Errorf("Calibrating J2 should clear its drift. Got %v", e.Encoders())
+	}
+}
+
+// TestEmulator_StepLoss checks that an arm with the step loss check enabled
+// notices drift on the emulator's encoders.
+func TestEmulator_StepLoss(t *testing.T) {
+	e, err := New()
+	if err != nil {
+		t.Skipf("Could not open a pseudo-terminal: %s", err)
+	}
+	defer e.Close()
+
+	arm, err := ar3.Connect(e.Name(), [7]bool{}, ar3.AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect to emulator. Got error: %s", err)
+	}
+	defer arm.Close()
+
+	if err = arm.Calibrate(25, true, true, true, true, true, true, false); err != nil {
+		t.Fatalf("Failed to calibrate. Got error: %s", err)
+	}
+	arm.EnableStepLossCheck([6]int{5, 5, 5, 5, 5, 5})
+	err = arm.MoveJointRadians(25, 15, 10, 20, 5, 0, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Errorf("Move without drift should succeed. Got error: %s", err)
+	}
+	e.AddDrift([6]int{0, 0, -20})
+	err = arm.MoveJointRadians(25, 15, 10, 20, 5, 0, 0, 0, 0, 0, 0, 0)
+	var stepLoss *ar3.ErrStepLoss
+	if !errors.As(err, &stepLoss) {
+		t.Fatalf("Move with drift should fail with ErrStepLoss. Got %v", err)
+	}
+	if stepLoss.Deviation != [6]int{0, 0, -20} {
+		t.Errorf("J3 should be off by -20 steps. Got %v", stepLoss.Deviation)
+	}
+}
@@ -0,0 +1,107 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// pty is the master and slave ends of a linux pseudo-terminal.
+type pty struct {
+	master *os.File
+	// slave is held open for the lifetime of the emulator, so the master
+	// does not see a hang up each time a client closes its end.
+	slave *os.File
+	name  string
+}
+
+// openPty opens a new pseudo-terminal in raw mode.
+func openPty() (*pty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	fd := int(master.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("error unlocking pty: %s", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("error getting pty number: %s", err)
+	}
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	// Put the terminal in raw mode so nothing is echoed or translated before
+	// a client configures it.
+	t, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS)
+	if err == nil {
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB
+		t.Cflag |= unix.CS8
+		err = unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, t)
+	}
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil, fmt.Errorf("error setting pty to raw mode: %s", err)
+	}
+	return &pty{master: master, slave: slave, name: name}, nil
+}
+
+// New starts an emulated AR3 on a new pseudo-terminal. Connect to it using
+// the path returned by Name.
+func New() (*Emulator, error) {
+	p, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+	e := &Emulator{pty: p}
+	go e.serve()
+	return e, nil
+}
+
+// Name returns the path of the pseudo-terminal the emulator is listening on,
+// for example /dev/pts/3.
+func (e *Emulator) Name() string {
+	return e.pty.name
+}
+
+// Close stops the emulator and closes its pseudo-terminal.
+func (e *Emulator) Close() error {
+	err := e.pty.master.Close()
+	errSlave := e.pty.slave.Close()
+	if err != nil {
+		return err
+	}
+	return errSlave
+}
+
+// serve reads commands off the pseudo-terminal until it is closed, writing
+// back the response to each one.
+func (e *Emulator) serve() {
+	reader := bufio.NewReader(e.pty.master)
+	for {
+		command, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		response := e.Handle(command)
+		if response == "" {
+			continue
+		}
+		if _, err = e.pty.master.Write([]byte(response)); err != nil {
+			return
+		}
+	}
+}
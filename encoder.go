@@ -0,0 +1,189 @@
+package ar3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/trilobio/ar3/protocol"
+)
+
+// ErrStepLoss is returned by a move when the step loss check is enabled and
+// the encoders disagree with the commanded position of a joint by more than
+// its tolerance. This usually means a stepper missed steps, and the arm should
+// be calibrated before it is trusted again, so each joint that lost steps is
+// marked not calibrated.
+//
+// CurrentStepperPosition still reports the commanded position after a step
+// loss.
+type ErrStepLoss struct {
+	// Deviation is the encoder position minus the commanded position of
+	// each joint, in steps.
+	Deviation [6]int
+	// Tolerance is the deviation each joint was allowed.
+	Tolerance [6]int
+}
+
+// Error lists every joint that deviated by more than its tolerance.
+func (e *ErrStepLoss) Error() string {
+	var joints []string
+	for i, deviation := range e.Deviation {
+		if abs(deviation) > e.Tolerance[i] {
+			joints = append(joints, fmt.Sprintf("J%d off by %d steps (tolerance %d)", i+1, deviation, e.Tolerance[i]))
+		}
+	}
+	return "step loss detected: " + strings.Join(joints, ", ")
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// checkStepLoss compares encoder positions against commanded stepper
+// positions, returning an *ErrStepLoss if any joint is out of tolerance.
+func checkStepLoss(commanded [7]int, encoders [6]int, tolerance [6]int) error {
+	var deviation [6]int
+	lost := false
+	for i := range encoders {
+		deviation[i] = encoders[i] - commanded[i]
+		if abs(deviation[i]) > tolerance[i] {
+			lost = true
+		}
+	}
+	if lost {
+		return &ErrStepLoss{Deviation: deviation, Tolerance: tolerance}
+	}
+	return nil
+}
+
+// ReadEncoders asks the AR3 for the position of J1 through J6 as read by its
+// encoders. Positions are in steps from the limit switch, like
+// CurrentStepperPosition.
+func (ar3 *AR3exec) ReadEncoders() ([6]int, error) {
+	var encoders [6]int
+	ctx := context.Background()
+	err := ar3.do(ctx, func() (err error) {
+		encoders, err = ar3.readEncoders(ctx)
+		return err
+	})
+	return encoders, err
+}
+
+// readEncoders is ReadEncoders, run on the command loop.
+func (ar3 *AR3exec) readEncoders(ctx context.Context) ([6]int, error) {
+	var encoders [6]int
+	line, err := ar3.exchange(ctx, protocol.RequestPositionCommand{}.Encode())
+	if err != nil {
+		return encoders, err
+	}
+	response, err := protocol.DecodePositionResponse([]byte(line))
+	if err != nil {
+		return encoders, fmt.Errorf("bad encoder positions from AR3 %q: %w", line, err)
+	}
+	// The arduino counts in its own direction, so undo the joint directions
+	// the same way moveSteppersRelative applies them.
+	jointDirs := ar3.GetDirections()
+	for i, steps := range response.Steps {
+		if jointDirs[i] {
+			steps = -steps
+		}
+		encoders[i] = steps
+	}
+	return encoders, nil
+}
+
+// EnableStepLossCheck reads the encoders after every move and fails the move
+// with an *ErrStepLoss if any joint is further than tolerance steps from where
+// it was commanded to go. The check is disabled by default, since not every
+// arm has encoders fitted.
+func (ar3 *AR3exec) EnableStepLossCheck(tolerance [6]int) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.stepLossCheck = true
+	ar3.stepLossTolerance = tolerance
+}
+
+// DisableStepLossCheck stops reading the encoders after every move.
+func (ar3 *AR3exec) DisableStepLossCheck() {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.stepLossCheck = false
+}
+
+// checkEncoders runs the step loss check, if enabled, after a move.
+func (ar3 *AR3exec) checkEncoders(ctx context.Context) error {
+	ar3.mu.Lock()
+	check, tolerance := ar3.stepLossCheck, ar3.stepLossTolerance
+	ar3.mu.Unlock()
+	if !check {
+		return nil
+	}
+	encoders, err := ar3.readEncoders(ctx)
+	if err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	err = checkStepLoss(ar3.jointVals, encoders, tolerance)
+	loseCalibration(&ar3.calibrated, err)
+	return err
+}
+
+// ReadEncoders simulates AR3exec.ReadEncoders(). The simulated encoders follow
+// the steppers, offset by any drift added with AddDrift.
+func (ar3 *AR3simulate) ReadEncoders() ([6]int, error) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.readEncoders(), nil
+}
+
+// readEncoders is ReadEncoders for callers holding ar3.mu.
+func (ar3 *AR3simulate) readEncoders() [6]int {
+	var encoders [6]int
+	for i := range encoders {
+		encoders[i] = ar3.jointVals[i] + ar3.drift[i]
+	}
+	return encoders
+}
+
+// AddDrift offsets the simulated encoders by drift steps, as though the
+// steppers of each joint had missed that many steps. Drift accumulates until
+// the joint is calibrated.
+func (ar3 *AR3simulate) AddDrift(drift [6]int) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	for i := range drift {
+		ar3.drift[i] += drift[i]
+	}
+}
+
+// EnableStepLossCheck simulates AR3exec.EnableStepLossCheck().
+func (ar3 *AR3simulate) EnableStepLossCheck(tolerance [6]int) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.stepLossCheck = true
+	ar3.stepLossTolerance = tolerance
+}
+
+// DisableStepLossCheck simulates AR3exec.DisableStepLossCheck().
+func (ar3 *AR3simulate) DisableStepLossCheck() {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.stepLossCheck = false
+}
+
+// checkEncoders simulates AR3exec.checkEncoders(). The caller must hold
+// ar3.mu.
+func (ar3 *AR3simulate) checkEncoders() error {
+	if !ar3.stepLossCheck {
+		return nil
+	}
+	encoders := ar3.readEncoders()
+	err := checkStepLoss(ar3.jointVals, encoders, ar3.stepLossTolerance)
+	loseCalibration(&ar3.calibrated, err)
+	return err
+}
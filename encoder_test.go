@@ -0,0 +1,105 @@
+package ar3
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/ar3/protocol"
+)
+
+func TestAR3exec_ReadEncoders(t *testing.T) {
+	mt := NewMemoryTransport(func(command string) []string {
+		if command == "RP" {
+			return []string{"A100B-200C300D0E0F7"}
+		}
+		return EchoResponder(command)
+	})
+	arm, err := ConnectTransport(mt, [7]bool{false, true}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	encoders, err := arm.ReadEncoders()
+	if err != nil {
+		t.Errorf("ReadEncoders should succeed. Got error: %s", err)
+	}
+	if encoders != [6]int{100, 200, 300, 0, 0, 7} {
+		t.Errorf("J2 should be flipped by its joint direction. Got %v", encoders)
+	}
+}
+
+func TestAR3exec_StepLoss(t *testing.T) {
+	var position [6]int
+	mt := NewMemoryTransport(func(command string) []string {
+		if command == "RP" {
+			return []string{string(protocol.PositionResponse{Steps: position}.Encode())}
+		}
+		return EchoResponder(command)
+	})
+	arm, err := ConnectTransport(mt, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	if err = arm.MoveSteppers(25, 15, 10, 20, 5, 10, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("Moves should not read the encoders unless asked. Got error: %s", err)
+	}
+	current := arm.CurrentStepperPosition()
+	copy(position[:], current[:6])
+
+	arm.EnableStepLossCheck([6]int{2, 2, 2, 2, 2, 2})
+	if err = arm.MoveSteppers(25, 15, 10, 20, 5, 10, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("Move matching the encoders should succeed. Got error: %s", err)
+	}
+	commands := mt.Commands()
+	if commands[len(commands)-1] != "RP" {
+		t.Errorf("Move should finish by reading the encoders. Got %v", commands)
+	}
+
+	err = arm.MoveSteppers(25, 15, 10, 20, 5, 20, 0, 0, 0, 0, 0, 0)
+	var stepLoss *ErrStepLoss
+	if !errors.As(err, &stepLoss) {
+		t.Fatalf("Move should fail with ErrStepLoss. Got %v", err)
+	}
+	if stepLoss.Deviation != [6]int{-10, 0, 0, 0, 0, 0} {
+		t.Errorf("J1 should be off by -10 steps. Got %v", stepLoss.Deviation)
+	}
+	if !strings.Contains(err.Error(), "J1 off by -10 steps") {
+		t.Errorf("Error should name J1. Got %s", err)
+	}
+	if calibrated := arm.CalibratedJoints(); calibrated[0] {
+		t.Errorf("J1 should no longer be calibrated")
+	}
+}
+
+func TestAR3simulate_StepLoss(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	mock := arm.(*AR3simulate)
+	arm.EnableStepLossCheck([6]int{5, 5, 5, 5, 5, 5})
+	if err := arm.MoveSteppers(25, 15, 10, 20, 5, 100, 100, 100, 100, 100, 100, 0); err != nil {
+		t.Errorf("Move without drift should succeed. Got error: %s", err)
+	}
+
+	mock.AddDrift([6]int{0, 0, 0, 0, 6, 0})
+	err := arm.MoveSteppers(25, 15, 10, 20, 5, 200, 200, 200, 200, 200, 200, 0)
+	var stepLoss *ErrStepLoss
+	if !errors.As(err, &stepLoss) || stepLoss.Deviation[4] != 6 {
+		t.Errorf("Move should fail with J5 off by 6 steps. Got %v", err)
+	}
+	err = arm.MoveSteppers(25, 15, 10, 20, 5, 100, 100, 100, 100, 100, 100, 0)
+	if !errors.Is(err, ErrNotCalibrated) || !strings.HasSuffix(err.Error(), "calibrate J5") {
+		t.Errorf("Moves should be refused until J5 is calibrated. Got %v", err)
+	}
+
+	if err = arm.Calibrate(25, false, false, false, false, true, false, false); err != nil {
+		t.Errorf("Calibrate should succeed. Got error: %s", err)
+	}
+	encoders, _ := arm.ReadEncoders()
+	if encoders[4] != 0 {
+		t.Errorf("Calibrating J5 should clear its drift. Got %v", encoders)
+	}
+	arm.DisableStepLossCheck()
+	if err = arm.MoveSteppers(25, 15, 10, 20, 5, 100, 100, 100, 100, 100, 100, 0); err != nil {
+		t.Errorf("Move should succeed with the check disabled. Got error: %s", err)
+	}
+}
@@ -7,9 +7,21 @@ import (
 
 // This example shows basic connection to the robot.
 func Example_basic() {
-	arm := ar3.ConnectMock() // arm := ar3.Connect("/dev/ttyUSB0")
+	arm := ar3.ConnectMock(ar3.AR3Profile) // arm := ar3.Connect("/dev/ttyUSB0", jointDirs, ar3.AR3Profile)
+	// Calibrate every joint before moving. Moves are refused until then.
+	_ = arm.Calibrate(50, true, true, true, true, true, true, false)
 	// Move the arm. First 5 are rational defaults, following 6 numbers are joint stepper counts, and the final is the track length.
 	_ = arm.MoveSteppers(25, 15, 10, 20, 5, 500, 500, 500, 500, 500, 500, 0)
 	fmt.Println("Moved arm!")
 	// Output: Moved arm!
 }
+
+// This example shows moving with named speed and acceleration settings.
+func ExampleMoveParams() {
+	arm := ar3.ConnectMock(ar3.AR3Profile)
+	_ = arm.Calibrate(50, true, true, true, true, true, true, false)
+	params := ar3.DefaultMoveParams.WithSpeed(40)
+	err := arm.MoveSteppersWithParams(params, 500, 500, 500, 500, 500, 500, 0)
+	fmt.Println(err)
+	// Output: <nil>
+}
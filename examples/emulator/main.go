@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/trilobio/ar3/emulator"
+)
+
+// Runs an emulated AR3 until interrupted. Point ar3.Connect, or the CLI's
+// --port flag, at the printed pseudo-terminal.
+func main() {
+	e, err := emulator.New()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	defer e.Close()
+	fmt.Printf("Emulating AR3 on %s\n", e.Name())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	fmt.Printf("Stepper counts: %v\n", e.Steps())
+}
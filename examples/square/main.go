@@ -11,7 +11,7 @@ const DEG float64 = math.Pi / 180
 
 func main() {
 	jointDirs := [7]bool{true, false, false, true, false, true, false}
-	robot, err := ar3.Connect("/dev/ttyUSB0", jointDirs)
+	robot, err := ar3.Connect("/dev/ttyUSB0", jointDirs, ar3.AR3Profile)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 	}
@@ -34,25 +34,39 @@ func main() {
 		fmt.Printf("%s\n", err)
 	}
 
-	// Now make a 100 mm square
+	// Now make a 100 mm square, keeping the tool on straight lines between
+	// corners, 1 mm and 1 degree at a time
 	sideLength := 100.0
-	targPose.Position.Z -= sideLength
-	err = robot.Move(5, 10, 10, 10, 10, targPose)
-	if err != nil {
-		fmt.Printf("%s\n", err)
+	params := ar3.SlowMoveParams
+	corners := [][2]float64{{0, -sideLength}, {-sideLength, -sideLength}, {-sideLength, 0}, {0, 0}}
+	for _, corner := range corners {
+		targ := targPose
+		targ.Position.Y += corner[0]
+		targ.Position.Z += corner[1]
+		err = robot.MoveLinear(params, targ, 1, 1)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+		}
 	}
-	targPose.Position.Y -= sideLength
-	err = robot.Move(5, 10, 10, 10, 10, targPose)
+
+	// And a circle inside it, as two half circles
+	top := targPose
+	top.Position.Y -= sideLength / 2
+	err = robot.MoveLinear(params, top, 1, 1)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 	}
-	targPose.Position.Z += sideLength
-	err = robot.Move(5, 10, 10, 10, 10, targPose)
+	left, bottom, right := top, top, top
+	left.Position.Y += sideLength / 2
+	left.Position.Z -= sideLength / 2
+	bottom.Position.Z -= sideLength
+	right.Position.Y -= sideLength / 2
+	right.Position.Z -= sideLength / 2
+	err = robot.MoveCircular(params, left, bottom, 1, 1)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 	}
-	targPose.Position.Y += sideLength
-	err = robot.Move(5, 10, 10, 10, 10, targPose)
+	err = robot.MoveCircular(params, right, top, 1, 1)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 	}
@@ -0,0 +1,117 @@
+package ar3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/trilobio/kinematics"
+)
+
+// Frame is a work coordinate frame, such as the corner of a bench, so poses
+// can be given relative to the work instead of the arm's base. When the work
+// moves, only the frame has to be taught again.
+type Frame struct {
+	Name string `json:"name"`
+	// Origin is the pose of the frame in the arm's base frame, in
+	// millimeters. A zero rotation is treated as no rotation.
+	Origin kinematics.Pose `json:"origin"`
+}
+
+// BaseFrame is the arm's base frame, which every other frame is relative to.
+var BaseFrame = Frame{Name: "base", Origin: kinematics.Pose{Rotation: kinematics.Quaternion{W: 1}}}
+
+// ToBase converts a pose in the frame to the arm's base frame.
+func (f Frame) ToBase(pose kinematics.Pose) kinematics.Pose {
+	return composePoses(f.origin(), pose)
+}
+
+// FromBase converts a pose in the arm's base frame to the frame.
+func (f Frame) FromBase(pose kinematics.Pose) kinematics.Pose {
+	return composePoses(invertPose(f.origin()), pose)
+}
+
+// origin returns the pose of the frame in the arm's base frame.
+func (f Frame) origin() kinematics.Pose {
+	origin := f.Origin
+	if origin.Rotation == (kinematics.Quaternion{}) {
+		origin.Rotation.W = 1
+	}
+	return origin
+}
+
+// TeachFrame builds a frame from three points, usually positions of the TCP
+// captured with CurrentPose: the frame's origin, a point along its +X axis,
+// and a point in its XY plane on the +Y side. Z points up out of the XY
+// plane, following the right hand rule.
+func TeachFrame(name string, origin, x, xy kinematics.Position) (Frame, error) {
+	o := toVec3(origin)
+	xAxis := toVec3(x).sub(o)
+	if xAxis.norm() < 1 {
+		return Frame{}, fmt.Errorf("frame %q: +X point must be at least 1 mm from the origin", name)
+	}
+	xAxis = xAxis.scale(1 / xAxis.norm())
+	zAxis := xAxis.cross(toVec3(xy).sub(o))
+	if zAxis.norm() < 1 {
+		return Frame{}, fmt.Errorf("frame %q: XY plane point must be at least 1 mm from the X axis", name)
+	}
+	zAxis = zAxis.scale(1 / zAxis.norm())
+	yAxis := zAxis.cross(xAxis)
+
+	var rot mat3
+	for i := 0; i < 3; i++ {
+		rot[i] = [3]float64{xAxis[i], yAxis[i], zAxis[i]}
+	}
+	return Frame{
+		Name:   name,
+		Origin: kinematics.Pose{Position: origin, Rotation: quaternionFromRotation(rot)},
+	}, nil
+}
+
+// rotate returns m times v.
+func (m mat3) rotate(v vec3) vec3 {
+	var out vec3
+	for i := range out {
+		out[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return out
+}
+
+// composePoses returns pose b, given in the frame of pose a, in a's parent
+// frame.
+func composePoses(a, b kinematics.Pose) kinematics.Pose {
+	ra := rotationFromQuaternion(a.Rotation)
+	return kinematics.Pose{
+		Position: toVec3(a.Position).add(ra.rotate(toVec3(b.Position))).position(),
+		Rotation: quaternionFromRotation(ra.mul(rotationFromQuaternion(b.Rotation))),
+	}
+}
+
+// invertPose returns the pose of a's parent frame in the frame of a.
+func invertPose(a kinematics.Pose) kinematics.Pose {
+	inverse := rotationFromQuaternion(a.Rotation).transpose()
+	return kinematics.Pose{
+		Position: inverse.rotate(toVec3(a.Position)).scale(-1).position(),
+		Rotation: quaternionFromRotation(inverse),
+	}
+}
+
+// MoveInFrame is MoveWithParams, with pose given in frame.
+func (ar3 *AR3exec) MoveInFrame(params MoveParams, frame Frame, pose kinematics.Pose) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error { return ar3.move(ctx, params, frame.ToBase(pose)) })
+}
+
+// CurrentPoseInFrame is CurrentPose, given in frame.
+func (ar3 *AR3exec) CurrentPoseInFrame(frame Frame) kinematics.Pose {
+	return frame.FromBase(ar3.CurrentPose())
+}
+
+// MoveInFrame simulates AR3exec.MoveInFrame().
+func (ar3 *AR3simulate) MoveInFrame(params MoveParams, frame Frame, pose kinematics.Pose) error {
+	return ar3.MoveWithParams(params, frame.ToBase(pose))
+}
+
+// CurrentPoseInFrame simulates AR3exec.CurrentPoseInFrame().
+func (ar3 *AR3simulate) CurrentPoseInFrame(frame Frame) kinematics.Pose {
+	return frame.FromBase(ar3.CurrentPose())
+}
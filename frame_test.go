@@ -0,0 +1,77 @@
+package ar3
+
+import (
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+func TestTeachFrame(t *testing.T) {
+	// A bench turned a quarter turn, so its X axis is the base's Y axis.
+	bench, err := TeachFrame("bench",
+		kinematics.Position{X: 300, Y: 100, Z: 50},
+		kinematics.Position{X: 300, Y: 200, Z: 50},
+		kinematics.Position{X: 250, Y: 150, Z: 50})
+	if err != nil {
+		t.Fatalf("Frame should be taught. Got error: %s", err)
+	}
+	pose := kinematics.Pose{Position: kinematics.Position{X: 10, Y: 20, Z: 5}, Rotation: kinematics.Quaternion{W: 1}}
+	base := bench.ToBase(pose)
+	want := kinematics.Position{X: 280, Y: 110, Z: 55}
+	if !samePose(kinematics.Pose{Position: want, Rotation: base.Rotation}, base) {
+		t.Errorf("Expected %+v in the base frame. Got %+v", want, base.Position)
+	}
+	if !samePose(bench.FromBase(base), pose) {
+		t.Errorf("FromBase should undo ToBase. Got %+v", bench.FromBase(base))
+	}
+
+	_, err = TeachFrame("line",
+		kinematics.Position{},
+		kinematics.Position{X: 100},
+		kinematics.Position{X: 200})
+	if err == nil {
+		t.Errorf("Points in a line should not make a frame")
+	}
+}
+
+func TestFrame_ZeroRotation(t *testing.T) {
+	pose := kinematics.Pose{Position: kinematics.Position{X: 10, Y: 20, Z: 5}, Rotation: kinematics.Quaternion{W: 1}}
+	if got := (Frame{}).ToBase(pose); !samePose(got, pose) {
+		t.Errorf("Zero frame should be the base frame. Got %+v", got)
+	}
+	shifted := Frame{Origin: kinematics.Pose{Position: kinematics.Position{Z: 100}}}
+	want := kinematics.Pose{Position: kinematics.Position{X: 10, Y: 20, Z: 105}, Rotation: kinematics.Quaternion{W: 1}}
+	if got := shifted.ToBase(pose); !samePose(got, want) {
+		t.Errorf("Frame without a rotation should only be shifted. Got %+v", got)
+	}
+	if got := shifted.FromBase(want); !samePose(got, pose) {
+		t.Errorf("FromBase should undo ToBase. Got %+v", got)
+	}
+}
+
+func TestAR3simulate_MoveInFrame(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	origin := arm.CurrentPose().Position
+	x, xy := origin, origin
+	x.Y += 50
+	xy.X -= 50
+	frame, err := TeachFrame("bench", origin, x, xy)
+	if err != nil {
+		t.Fatalf("Frame should be taught. Got error: %s", err)
+	}
+
+	target := arm.CurrentPoseInFrame(frame)
+	if d := toVec3(target.Position).norm(); d > 1e-6 {
+		t.Errorf("The arm should be at the frame's origin. Got %+v", target.Position)
+	}
+	target.Position.X += 20
+	target.Position.Z -= 30
+	if err = arm.MoveInFrame(DefaultMoveParams, frame, target); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	got := arm.CurrentPoseInFrame(frame).Position
+	if d := toVec3(got).sub(toVec3(target.Position)).norm(); d > 1 {
+		t.Errorf("Move should reach %+v in the frame. Got %+v", target.Position, got)
+	}
+}
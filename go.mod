@@ -6,15 +6,15 @@ require (
 	github.com/jmoiron/sqlx v1.3.4
 	github.com/mattn/go-sqlite3 v1.14.9
 	github.com/trilobio/kinematics v0.0.4
+	github.com/trilobio/quaternion v0.0.0-20211202192458-cf101a1997a8
 	github.com/urfave/cli/v2 v2.3.0
 	golang.org/x/sys v0.0.0-20211124211545-fe61309f8881
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.1 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
-	github.com/trilobio/quaternion v0.0.0-20211202192458-cf101a1997a8 // indirect
 	golang.org/x/exp v0.0.0-20211129234152-8a230f1f7d7a // indirect
 	golang.org/x/tools v0.1.8-0.20211029000441-d6a9af8af023 // indirect
 	gonum.org/v1/gonum v0.9.3 // indirect
@@ -0,0 +1,271 @@
+package ar3
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/trilobio/kinematics"
+)
+
+// Configuration names one of the up to eight branches of the AR3's inverse
+// kinematics.
+type Configuration struct {
+	// ShoulderBack is true when J1 points away from the wrist, so the arm
+	// reaches back over itself to get there.
+	ShoulderBack bool
+	// ElbowUp is true when the elbow is above the line from the shoulder to
+	// the wrist.
+	ElbowUp bool
+	// WristFlip is true when J5 is negative.
+	WristFlip bool
+}
+
+// String describes the configuration, for example "shoulder front, elbow up,
+// wrist no-flip".
+func (c Configuration) String() string {
+	shoulder, elbow, wrist := "front", "down", "no-flip"
+	if c.ShoulderBack {
+		shoulder = "back"
+	}
+	if c.ElbowUp {
+		elbow = "up"
+	}
+	if c.WristFlip {
+		wrist = "flip"
+	}
+	return fmt.Sprintf("shoulder %s, elbow %s, wrist %s", shoulder, elbow, wrist)
+}
+
+// less orders configurations shoulder front before back, elbow up before
+// down, and wrist no-flip before flip.
+func (c Configuration) less(d Configuration) bool {
+	if c.ShoulderBack != d.ShoulderBack {
+		return d.ShoulderBack
+	}
+	if c.ElbowUp != d.ElbowUp {
+		return c.ElbowUp
+	}
+	return !c.WristFlip && d.WristFlip
+}
+
+// IKSolution is one set of joint angles, in radians, that puts the end
+// effector at a pose.
+type IKSolution struct {
+	Joints        [6]float64
+	Configuration Configuration
+}
+
+// ikTolerance is how far off the AR3's shape a set of DH parameters may be,
+// and how close to a singularity a pose may get before it is treated as on
+// it.
+const ikTolerance = 1e-9
+
+// checkSphericalWrist returns an error unless dh has the AR3's shape: J4, J5
+// and J6 meeting at a point, and J2 and J3 moving the wrist in a plane
+// through J1.
+func checkSphericalWrist(dh kinematics.DhParameters) error {
+	if len(dh.ThetaOffsets) != 6 || len(dh.AlphaValues) != 6 || len(dh.AValues) != 6 || len(dh.DValues) != 6 {
+		return fmt.Errorf("analytic inverse kinematics needs 6 DH parameters per joint")
+	}
+	alphas := [6]float64{-math.Pi / 2, 0, math.Pi / 2, -math.Pi / 2, math.Pi / 2, 0}
+	for i, alpha := range alphas {
+		if math.Abs(dh.AlphaValues[i]-alpha) > ikTolerance {
+			return fmt.Errorf("analytic inverse kinematics needs the AR3's alpha values. J%d has %f", i+1, dh.AlphaValues[i])
+		}
+	}
+	for _, i := range []int{2, 3, 4, 5} {
+		if math.Abs(dh.AValues[i]) > ikTolerance {
+			return fmt.Errorf("analytic inverse kinematics needs a spherical wrist. J%d has a of %f", i+1, dh.AValues[i])
+		}
+	}
+	for _, i := range []int{1, 2, 4} {
+		if math.Abs(dh.DValues[i]) > ikTolerance {
+			return fmt.Errorf("analytic inverse kinematics needs a spherical wrist. J%d has d of %f", i+1, dh.DValues[i])
+		}
+	}
+	return nil
+}
+
+// AnalyticInverseKinematics solves for every set of joint angles that puts
+// the end effector of an arm shaped like the AR3 (see AR3DhParameters) at
+// pose. Unlike kinematics.InverseKinematics it needs no seed, always
+// converges, and returns every branch: up to eight solutions, ordered shoulder
+// front before back, elbow up before down, and wrist no-flip before flip.
+//
+// Joint limits are not checked. Where the wrist is singular (J5 at 0) J4 is
+// set to 0 and J6 takes up the whole rotation, and where the wrist is directly
+// above J1 J1 is set to 0.
+func AnalyticInverseKinematics(pose kinematics.Pose, dh kinematics.DhParameters) ([]IKSolution, error) {
+	if err := checkSphericalWrist(dh); err != nil {
+		return nil, err
+	}
+	rot := rotationFromQuaternion(pose.Rotation)
+	p := [3]float64{pose.Position.X, pose.Position.Y, pose.Position.Z}
+
+	// The wrist center is where J4, J5 and J6 meet, back along the tool's z
+	// axis from the flange.
+	d6 := dh.DValues[5]
+	wc := [3]float64{p[0] - d6*rot[0][2], p[1] - d6*rot[1][2], p[2] - d6*rot[2][2]}
+
+	a1, d1 := dh.AValues[0], dh.DValues[0]
+	l2 := dh.AValues[1]
+	d4 := dh.DValues[3]
+	l3 := math.Abs(d4)
+	// In the plane of J2 and J3, the forearm points a quarter turn from J3's
+	// x axis, towards whichever side d4 is on.
+	forearm := -math.Pi / 2
+	if d4 < 0 {
+		forearm = math.Pi / 2
+	}
+
+	front := 0.0
+	if math.Hypot(wc[0], wc[1]) > ikTolerance {
+		front = math.Atan2(wc[1], wc[0])
+	}
+
+	var solutions []IKSolution
+	for _, back := range []bool{false, true} {
+		t1 := front
+		if back {
+			t1 += math.Pi
+		}
+		// Wrist center in the plane of J2 and J3, relative to J2. y points
+		// down, following J1's frame.
+		x := wc[0]*math.Cos(t1) + wc[1]*math.Sin(t1) - a1
+		y := d1 - wc[2]
+
+		cosElbow := (x*x + y*y - l2*l2 - l3*l3) / (2 * l2 * l3)
+		if math.Abs(cosElbow) > 1+ikTolerance {
+			continue
+		}
+		cosElbow = math.Max(-1, math.Min(1, cosElbow))
+		for _, sign := range []float64{1, -1} {
+			elbow := sign * math.Acos(cosElbow)
+			t2 := math.Atan2(y, x) - math.Atan2(l3*math.Sin(elbow), l2+l3*math.Cos(elbow))
+			t3 := elbow - forearm
+			// The elbow is up when it sits above the line from J2 to the
+			// wrist, wherever that line points.
+			ex, ey := l2*math.Cos(t2), l2*math.Sin(t2)
+			elbowUp := (x*ey-y*ex)*x < 0
+			if math.Abs(x) < ikTolerance {
+				elbowUp = ex*y < 0
+			}
+
+			// J4, J5 and J6 take up whatever rotation J1, J2 and J3 leave.
+			r03 := dhRotation(t1, dh.AlphaValues[0]).mul(dhRotation(t2, dh.AlphaValues[1])).mul(dhRotation(t3, dh.AlphaValues[2]))
+			r36 := r03.transpose().mul(rot)
+			for _, wrist := range zyzAngles(r36) {
+				dhThetas := [6]float64{t1, t2, t3, wrist[0], wrist[1], wrist[2]}
+				var joints [6]float64
+				for i, theta := range dhThetas {
+					joints[i] = normalizeAngle(theta - dh.ThetaOffsets[i])
+				}
+				solutions = append(solutions, IKSolution{
+					Joints: joints,
+					Configuration: Configuration{
+						ShoulderBack: back,
+						ElbowUp:      elbowUp,
+						WristFlip:    joints[4] < 0,
+					},
+				})
+			}
+		}
+	}
+	if len(solutions) == 0 {
+		return nil, fmt.Errorf("pose out of reach: wrist center (%.2f, %.2f, %.2f) is beyond the arm", wc[0], wc[1], wc[2])
+	}
+	sort.SliceStable(solutions, func(i, j int) bool {
+		return solutions[i].Configuration.less(solutions[j].Configuration)
+	})
+	return solutions, nil
+}
+
+// zyzAngles returns both sets of z-y-z Euler angles for r: the one with a
+// positive middle angle, then the flipped one. At the singularity, where the
+// middle angle is 0 or pi, the first angle is 0 and only one set is returned.
+func zyzAngles(r mat3) [][3]float64 {
+	sinB := math.Hypot(r[0][2], r[1][2])
+	if sinB < ikTolerance {
+		b := 0.0
+		if r[2][2] < 0 {
+			b = math.Pi
+		}
+		return [][3]float64{{0, b, math.Atan2(r[1][0], r[1][1])}}
+	}
+	b := math.Atan2(sinB, r[2][2])
+	a := math.Atan2(r[1][2], r[0][2])
+	c := math.Atan2(r[2][1], -r[2][0])
+	return [][3]float64{{a, b, c}, {a + math.Pi, -b, c + math.Pi}}
+}
+
+// normalizeAngle wraps an angle in radians into (-pi, pi].
+func normalizeAngle(theta float64) float64 {
+	theta = math.Mod(theta, 2*math.Pi)
+	if theta > math.Pi {
+		theta -= 2 * math.Pi
+	} else if theta <= -math.Pi {
+		theta += 2 * math.Pi
+	}
+	return theta
+}
+
+// mat3 is a 3x3 rotation matrix.
+type mat3 [3][3]float64
+
+// mul returns m times n.
+func (m mat3) mul(n mat3) mat3 {
+	var out mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				out[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return out
+}
+
+// transpose returns the transpose of m, which is its inverse.
+func (m mat3) transpose() mat3 {
+	var out mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			out[i][j] = m[j][i]
+		}
+	}
+	return out
+}
+
+// dhRotation is the rotation of a single DH link, Rz(theta) * Rx(alpha).
+func dhRotation(theta, alpha float64) mat3 {
+	ct, st := math.Cos(theta), math.Sin(theta)
+	ca, sa := math.Cos(alpha), math.Sin(alpha)
+	return mat3{
+		{ct, -st * ca, st * sa},
+		{st, ct * ca, -ct * sa},
+		{0, sa, ca},
+	}
+}
+
+// rotationFromQuaternion converts a quaternion to a rotation matrix.
+//
+// kinematics.ForwardKinematics (as of v0.0.4) leaves W unscaled, and with the
+// wrong sign, for rotations whose largest diagonal element is the last one.
+// Such a quaternion is not of unit length, but W can be recovered from X, Y
+// and Z, so poses from CurrentPose can be fed straight back in.
+func rotationFromQuaternion(q kinematics.Quaternion) mat3 {
+	norm := math.Sqrt(q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z)
+	if math.Abs(norm-1) > 1e-6 && q.Z != 0 {
+		w := -q.W / (4 * q.Z)
+		if math.Abs(w*w+q.X*q.X+q.Y*q.Y+q.Z*q.Z-1) < 1e-6 {
+			q.W, norm = w, 1
+		}
+	}
+	w, x, y, z := q.W/norm, q.X/norm, q.Y/norm, q.Z/norm
+	return mat3{
+		{1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w)},
+		{2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w)},
+		{2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y)},
+	}
+}
@@ -0,0 +1,141 @@
+package ar3
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+// samePose reports whether two poses match, comparing rotations as matrices
+// so that q and -q are equal.
+func samePose(a, b kinematics.Pose) bool {
+	// Comparisons are written so that NaN is never the same as anything.
+	if !(math.Abs(a.Position.X-b.Position.X) <= 1e-6) ||
+		!(math.Abs(a.Position.Y-b.Position.Y) <= 1e-6) ||
+		!(math.Abs(a.Position.Z-b.Position.Z) <= 1e-6) {
+		return false
+	}
+	ra, rb := rotationFromQuaternion(a.Rotation), rotationFromQuaternion(b.Rotation)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if !(math.Abs(ra[i][j]-rb[i][j]) <= 1e-6) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestAnalyticInverseKinematics(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 500; n++ {
+		var joints [6]float64
+		for i := range joints {
+			joints[i] = (r.Float64() - 0.5) * 2 * math.Pi
+		}
+		pose := kinematics.ForwardKinematics(joints[:], AR3DhParameters)
+		solutions, err := AnalyticInverseKinematics(pose, AR3DhParameters)
+		if err != nil {
+			t.Fatalf("Failed to solve for %v. Got error: %s", joints, err)
+		}
+		if len(solutions) != 4 && len(solutions) != 8 {
+			t.Errorf("Expected 4 or 8 solutions for %v. Got %d", joints, len(solutions))
+		}
+		found := false
+		for _, solution := range solutions {
+			got := kinematics.ForwardKinematics(solution.Joints[:], AR3DhParameters)
+			if !samePose(got, pose) {
+				t.Fatalf("Solution %v (%s) for %v reaches %+v, not %+v", solution.Joints, solution.Configuration, joints, got, pose)
+			}
+			same := true
+			for i := range joints {
+				if math.Abs(normalizeAngle(solution.Joints[i]-joints[i])) > 1e-6 {
+					same = false
+				}
+			}
+			found = found || same
+		}
+		if !found {
+			t.Errorf("Solutions for %v should include the joints themselves. Got %v", joints, solutions)
+		}
+	}
+}
+
+func TestAnalyticInverseKinematics_Configuration(t *testing.T) {
+	joints := []float64{0.2, 0.1, 0.3, 0.4, 0.5, 0.6}
+	pose := kinematics.ForwardKinematics(joints, AR3DhParameters)
+	solutions, err := AnalyticInverseKinematics(pose, AR3DhParameters)
+	if err != nil {
+		t.Fatalf("Failed to solve. Got error: %s", err)
+	}
+	first := solutions[0]
+	for i := range joints {
+		if math.Abs(first.Joints[i]-joints[i]) > 1e-6 {
+			t.Errorf("First solution should be the shoulder front, elbow up, wrist no-flip one. Got %v", first.Joints)
+			break
+		}
+	}
+	if first.Configuration.String() != "shoulder front, elbow up, wrist no-flip" {
+		t.Errorf("Unexpected configuration %s", first.Configuration)
+	}
+	last := solutions[len(solutions)-1].Configuration
+	if last != (Configuration{ShoulderBack: true, ElbowUp: false, WristFlip: true}) {
+		t.Errorf("Last solution should be shoulder back, elbow down, wrist flip. Got %s", last)
+	}
+}
+
+func TestAnalyticInverseKinematics_Singular(t *testing.T) {
+	// At home, J5 is 0, so J4 and J6 line up.
+	pose := kinematics.ForwardKinematics([]float64{0, 0, 0, 0, 0, 0}, AR3DhParameters)
+	solutions, err := AnalyticInverseKinematics(pose, AR3DhParameters)
+	if err != nil {
+		t.Fatalf("Failed to solve. Got error: %s", err)
+	}
+	for _, joint := range solutions[0].Joints {
+		if math.Abs(joint) > 1e-9 {
+			t.Errorf("Home should solve to all zeros, with J4 at 0. Got %v", solutions[0].Joints)
+			break
+		}
+	}
+	if len(solutions) == 8 {
+		t.Errorf("The singular branch should only give one wrist solution")
+	}
+	for _, solution := range solutions {
+		if !samePose(kinematics.ForwardKinematics(solution.Joints[:], AR3DhParameters), pose) {
+			t.Errorf("Solution %v does not reach home", solution.Joints)
+		}
+	}
+}
+
+func TestAnalyticInverseKinematics_OutOfReach(t *testing.T) {
+	pose := kinematics.Pose{Position: kinematics.Position{X: 2000}, Rotation: kinematics.Quaternion{W: 1}}
+	_, err := AnalyticInverseKinematics(pose, AR3DhParameters)
+	if err == nil || !strings.Contains(err.Error(), "out of reach") {
+		t.Errorf("Pose 2m away should be out of reach. Got %v", err)
+	}
+
+	dh := AR3DhParameters
+	dh.AValues = []float64{64.2, 305, 10, 0, 0, 0}
+	if _, err = AnalyticInverseKinematics(pose, dh); err == nil {
+		t.Errorf("Arm without a spherical wrist should be refused")
+	}
+}
+
+// benchmarkPose is a reachable pose away from any singularity.
+var benchmarkPose = kinematics.ForwardKinematics([]float64{0.2, 0.1, 0.3, 0.4, 0.5, 0.6}, AR3DhParameters)
+
+func BenchmarkAnalyticInverseKinematics(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = AnalyticInverseKinematics(benchmarkPose, AR3DhParameters)
+	}
+}
+
+func BenchmarkNumericInverseKinematics(b *testing.B) {
+	seed := []float64{0, 0, 0, 0, 0, 0}
+	for i := 0; i < b.N; i++ {
+		_, _ = kinematics.InverseKinematics(benchmarkPose, AR3DhParameters, seed)
+	}
+}
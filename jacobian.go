@@ -0,0 +1,151 @@
+package ar3
+
+import (
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// dhFrames returns the origin and z axis of each joint's frame, in the arm's
+// base frame, for joint angles in radians. Entry 0 is the base frame and entry
+// i is the frame at the end of link i, so entry 6 is the flange. flange is the
+// flange's rotation.
+func dhFrames(joints [6]float64, dh kinematics.DhParameters) (origins, zAxes [7]vec3, flange mat3) {
+	rot := mat3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	var origin vec3
+	origins[0], zAxes[0] = origin, vec3{0, 0, 1}
+	for i, joint := range joints {
+		theta := joint + dh.ThetaOffsets[i]
+		link := vec3{dh.AValues[i] * math.Cos(theta), dh.AValues[i] * math.Sin(theta), dh.DValues[i]}
+		origin = origin.add(rot.rotate(link))
+		rot = rot.mul(dhRotation(theta, dh.AlphaValues[i]))
+		origins[i+1], zAxes[i+1] = origin, vec3{rot[0][2], rot[1][2], rot[2][2]}
+	}
+	return origins, zAxes, rot
+}
+
+// Jacobian returns the geometric Jacobian of the flange for joint angles in
+// radians. Row i, column j is how fast component i of the flange's velocity
+// changes as joint j turns: rows 0 to 2 are linear velocity in millimeters per
+// radian, and rows 3 to 5 are angular velocity in radians per radian, both in
+// the arm's base frame.
+func Jacobian(joints [6]float64, dh kinematics.DhParameters) [6][6]float64 {
+	origins, zAxes, _ := dhFrames(joints, dh)
+	var j [6][6]float64
+	for col := 0; col < 6; col++ {
+		z := zAxes[col]
+		linear := z.cross(origins[6].sub(origins[col]))
+		for row := 0; row < 3; row++ {
+			j[row][col] = linear[row]
+			j[row+3][col] = z[row]
+		}
+	}
+	return j
+}
+
+// reach is the length of the AR3's upper arm and forearm together. Dividing
+// the Jacobian's linear rows by it makes them comparable to its angular rows.
+func reach(dh kinematics.DhParameters) float64 {
+	r := math.Abs(dh.AValues[1]) + math.Abs(dh.DValues[3])
+	if r == 0 {
+		return 1
+	}
+	return r
+}
+
+// singularValues returns the singular values of the Jacobian with its linear
+// rows divided by the arm's reach, largest first.
+func singularValues(j [6][6]float64, dh kinematics.DhParameters) [6]float64 {
+	r := reach(dh)
+	for row := 0; row < 3; row++ {
+		for col := range j[row] {
+			j[row][col] /= r
+		}
+	}
+	var jtj [6][6]float64
+	for a := 0; a < 6; a++ {
+		for b := 0; b < 6; b++ {
+			for k := 0; k < 6; k++ {
+				jtj[a][b] += j[k][a] * j[k][b]
+			}
+		}
+	}
+	values := symmetricEigenvalues(jtj)
+	for i, v := range values {
+		values[i] = math.Sqrt(math.Max(v, 0))
+	}
+	return values
+}
+
+// Manipulability returns Yoshikawa's manipulability measure for joint angles
+// in radians: the product of the Jacobian's singular values, with the linear
+// rows divided by the arm's reach so the measure has no units. It is 0 on a
+// singularity and grows the more freely the arm can move.
+func Manipulability(joints [6]float64, dh kinematics.DhParameters) float64 {
+	m := 1.0
+	for _, v := range singularValues(Jacobian(joints, dh), dh) {
+		m *= v
+	}
+	return m
+}
+
+// ConditionNumber returns the ratio of the Jacobian's largest to smallest
+// singular value for joint angles in radians, with the linear rows divided by
+// the arm's reach. It is 1 where the arm moves equally well in every
+// direction, and grows to +Inf at a singularity.
+func ConditionNumber(joints [6]float64, dh kinematics.DhParameters) float64 {
+	values := singularValues(Jacobian(joints, dh), dh)
+	if values[5] < 1e-12 {
+		return math.Inf(1)
+	}
+	return values[0] / values[5]
+}
+
+// symmetricEigenvalues returns the eigenvalues of a symmetric matrix, largest
+// first, by the cyclic Jacobi method.
+func symmetricEigenvalues(a [6][6]float64) [6]float64 {
+	for sweep := 0; sweep < 50; sweep++ {
+		off := 0.0
+		for p := 0; p < 6; p++ {
+			for q := p + 1; q < 6; q++ {
+				off += a[p][q] * a[p][q]
+			}
+		}
+		if off < 1e-24 {
+			break
+		}
+		for p := 0; p < 6; p++ {
+			for q := p + 1; q < 6; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				// Rotate rows and columns p and q to zero a[p][q].
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < 6; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 6; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+			}
+		}
+	}
+	var values [6]float64
+	for i := range values {
+		values[i] = a[i][i]
+	}
+	for i := 1; i < 6; i++ {
+		for k := i; k > 0 && values[k] > values[k-1]; k-- {
+			values[k], values[k-1] = values[k-1], values[k]
+		}
+	}
+	return values
+}
@@ -0,0 +1,214 @@
+package ar3
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// JointLimit is the range a joint may move within, in radians, or in
+// millimeters for the track. Only an enabled limit limits the joint, so the
+// zero value limits nothing, while a limit from 0 to 0 that is enabled pins
+// the joint at 0.
+type JointLimit struct {
+	Enabled  bool
+	Min, Max float64
+}
+
+// SoftLimits narrow where the arm may go, beyond the joint limits of its
+// profile. Every move, other than calibration, is checked against them before
+// the arm moves. The zero value limits nothing.
+type SoftLimits struct {
+	// Joints are the limits of J1 to J6 and the track.
+	Joints [7]JointLimit
+	// KeepIn are zones the TCP must stay in, in the arm's base frame, or the
+	// track's frame for an arm on a track. With several, the TCP must stay
+	// in at least one of them. Without any, the TCP may go anywhere not in a
+	// KeepOut zone.
+	KeepIn []Box
+	// KeepOut are zones the TCP must stay out of.
+	KeepOut []Box
+}
+
+// Validate checks that no enabled joint limit's max is below its min and that
+// every zone has a name, bounds that are numbers, and a size along at least
+// one axis.
+func (l SoftLimits) Validate() error {
+	for i, joint := range l.Joints {
+		if !joint.Enabled {
+			continue
+		}
+		if math.IsNaN(joint.Min) || math.IsNaN(joint.Max) || joint.Min > joint.Max {
+			return fmt.Errorf("%s soft limit max must not be below min. Got %g to %g", jointName(i), joint.Min, joint.Max)
+		}
+	}
+	for _, zones := range [][]Box{l.KeepIn, l.KeepOut} {
+		for _, zone := range zones {
+			if zone.Name == "" {
+				return errors.New("every zone needs a name")
+			}
+			for _, v := range []float64{zone.Min.X, zone.Min.Y, zone.Min.Z, zone.Max.X, zone.Max.Y, zone.Max.Z} {
+				if math.IsNaN(v) {
+					return fmt.Errorf("zone %q has a bound that is not a number", zone.Name)
+				}
+			}
+			if zone.Min.X > zone.Max.X || zone.Min.Y > zone.Max.Y || zone.Min.Z > zone.Max.Z {
+				return fmt.Errorf("zone %q max must not be below min", zone.Name)
+			}
+			if zone.Min.X == zone.Max.X && zone.Min.Y == zone.Max.Y && zone.Min.Z == zone.Max.Z {
+				return fmt.Errorf("zone %q must have a size", zone.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// jointName names joint i, counting from 0, with 6 for the track.
+func jointName(i int) string {
+	if i == 6 {
+		return "track"
+	}
+	return fmt.Sprintf("J%d", i+1)
+}
+
+// ErrSoftLimit is returned by moves that would take a joint past its soft
+// limit.
+type ErrSoftLimit struct {
+	// Joint is the joint, counting from 0, with 6 for the track.
+	Joint int
+	// Value is where the joint would go, in radians, or millimeters for the
+	// track.
+	Value float64
+	Limit JointLimit
+}
+
+// Error names the joint and its limit.
+func (e *ErrSoftLimit) Error() string {
+	unit := "radians"
+	if e.Joint == 6 {
+		unit = "mm"
+	}
+	return fmt.Sprintf("%s would move to %.3f %s, outside its soft limit of %.3f to %.3f", jointName(e.Joint), e.Value, unit, e.Limit.Min, e.Limit.Max)
+}
+
+// ErrZone is returned by moves that would take the TCP into a keep-out zone,
+// or out of every keep-in zone.
+type ErrZone struct {
+	// Zone names the keep-out zone, or is empty when the TCP would leave the
+	// keep-in zones.
+	Zone string
+	// Position is where the TCP would first be outside the zones it must
+	// stay in, or inside the zone it must stay out of.
+	Position kinematics.Position
+}
+
+// Error names the zone.
+func (e *ErrZone) Error() string {
+	p := e.Position
+	if e.Zone == "" {
+		return fmt.Sprintf("TCP would leave the keep-in zones at (%.1f, %.1f, %.1f)", p.X, p.Y, p.Z)
+	}
+	return fmt.Sprintf("TCP would enter keep-out zone %s at (%.1f, %.1f, %.1f)", e.Zone, p.X, p.Y, p.Z)
+}
+
+// check returns an ErrSoftLimit or ErrZone if joint angles in radians and
+// track position in millimeters are outside the limits, along with how far
+// outside they are altogether: radians past joint limits, millimeters past
+// the track limit and millimeters into keep-out zones or out of the keep-in
+// zones.
+func (l SoftLimits) check(p RobotProfile, tool Tool, joints [7]float64) (float64, error) {
+	var depth float64
+	var err error
+	for i, limit := range l.Joints {
+		if !limit.Enabled {
+			continue
+		}
+		if past := math.Max(limit.Min-joints[i], joints[i]-limit.Max); past > 0 {
+			depth += past
+			if err == nil {
+				err = &ErrSoftLimit{Joint: i, Value: joints[i], Limit: limit}
+			}
+		}
+	}
+	if len(l.KeepIn) == 0 && len(l.KeepOut) == 0 {
+		return depth, err
+	}
+	tcp := tool.tcpPose(kinematics.ForwardKinematics(joints[:6], p.DhParameters)).Position
+	tcp = toVec3(tcp).add(toVec3(p.trackOffset(joints[6]))).position()
+	for _, zone := range l.KeepOut {
+		if zone.Distance(tcp) == 0 {
+			depth += zone.depth(tcp)
+			if err == nil {
+				err = &ErrZone{Zone: zone.Name, Position: tcp}
+			}
+		}
+	}
+	if len(l.KeepIn) == 0 {
+		return depth, err
+	}
+	outside := math.Inf(1)
+	for _, zone := range l.KeepIn {
+		outside = math.Min(outside, zone.Distance(tcp))
+	}
+	if outside > 0 {
+		depth += outside
+		if err == nil {
+			err = &ErrZone{Position: tcp}
+		}
+	}
+	return depth, err
+}
+
+// checkSteps checks the moves by each of relative in turn, starting from the
+// stepper position from.
+func (l SoftLimits) checkSteps(p RobotProfile, tool Tool, from [7]int, relative ...[7]int) error {
+	none := true
+	for _, limit := range l.Joints {
+		none = none && !limit.Enabled
+	}
+	if none && len(l.KeepIn) == 0 && len(l.KeepOut) == 0 {
+		return nil
+	}
+	return p.walkSteps(from, relative, func(joints [7]float64) (float64, error) {
+		return l.check(p, tool, joints)
+	})
+}
+
+// SetSoftLimits sets the limits that every move, other than calibration, is
+// checked against before the arm moves.
+func (ar3 *AR3exec) SetSoftLimits(limits SoftLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.softLimits = limits
+	return nil
+}
+
+// CurrentSoftLimits returns the limits set with SetSoftLimits.
+func (ar3 *AR3exec) CurrentSoftLimits() SoftLimits {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.softLimits
+}
+
+// SetSoftLimits simulates AR3exec.SetSoftLimits().
+func (ar3 *AR3simulate) SetSoftLimits(limits SoftLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.softLimits = limits
+	return nil
+}
+
+// CurrentSoftLimits simulates AR3exec.CurrentSoftLimits().
+func (ar3 *AR3simulate) CurrentSoftLimits() SoftLimits {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.softLimits
+}
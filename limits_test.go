@@ -0,0 +1,203 @@
+package ar3
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+func TestSoftLimits_Validate(t *testing.T) {
+	var limits SoftLimits
+	limits.Joints[1] = JointLimit{Enabled: true, Min: 0.5, Max: -0.5}
+	if err := limits.Validate(); err == nil {
+		t.Errorf("Joint limit with max below min should be refused")
+	}
+	limits = SoftLimits{KeepOut: []Box{{Max: kinematics.Position{X: 1, Y: 1, Z: 1}}}}
+	if err := limits.Validate(); err == nil {
+		t.Errorf("Zone without a name should be refused")
+	}
+	arm := connectCalibrated(AR3Profile)
+	if err := arm.SetSoftLimits(limits); err == nil {
+		t.Errorf("Invalid limits should not be set")
+	}
+	limits = SoftLimits{KeepOut: []Box{{Name: "point", Min: kinematics.Position{X: 1, Y: 1, Z: 1}, Max: kinematics.Position{X: 1, Y: 1, Z: 1}}}}
+	if err := limits.Validate(); err == nil {
+		t.Errorf("Zone without a size should be refused")
+	}
+	limits = SoftLimits{KeepIn: []Box{{Name: "nan", Max: kinematics.Position{X: math.NaN(), Y: 1, Z: 1}}}}
+	if err := limits.Validate(); err == nil {
+		t.Errorf("Zone with a NaN bound should be refused")
+	}
+	limits = SoftLimits{KeepOut: []Box{{Name: "wall", Max: kinematics.Position{X: 1, Y: 1}}}}
+	if err := limits.Validate(); err != nil {
+		t.Errorf("Flat zone with a size should be allowed. Got error: %s", err)
+	}
+	limits = SoftLimits{}
+	limits.Joints[1] = JointLimit{Min: 0.5, Max: -0.5}
+	if err := limits.Validate(); err != nil {
+		t.Errorf("Disabled joint limit should not be checked. Got error: %s", err)
+	}
+}
+
+func TestAR3simulate_MoveSoftLimitPinned(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	var limits SoftLimits
+	limits.Joints[3] = JointLimit{Enabled: true}
+	if err := arm.SetSoftLimits(limits); err != nil {
+		t.Fatalf("Limits should be set. Got error: %s", err)
+	}
+
+	p := DefaultMoveParams
+	err := arm.MoveJointRadiansWithParams(p, 0, -0.5, -0.8, 0.1, 0.8, 0, 0)
+	var softLimit *ErrSoftLimit
+	if !errors.As(err, &softLimit) || softLimit.Joint != 3 {
+		t.Errorf("J4 pinned at 0 should not move. Got %v", err)
+	}
+	if err = arm.MoveJointRadiansWithParams(p, 0.1, -0.5, -0.8, 0, 0.8, 0, 0); err != nil {
+		t.Errorf("Move keeping J4 at 0 should be made. Got error: %s", err)
+	}
+}
+
+func TestAR3simulate_MoveSoftLimit(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentStepperPosition()
+	var limits SoftLimits
+	limits.Joints[2] = JointLimit{Enabled: true, Min: -1, Max: 0}
+	if err := arm.SetSoftLimits(limits); err != nil {
+		t.Fatalf("Limits should be set. Got error: %s", err)
+	}
+
+	p := DefaultMoveParams
+	err := arm.MoveJointRadians(p.Speed, p.AccDur, p.AccSpd, p.DccDur, p.DccSpd, 0, -0.5, 0.3, 0, 0.8, 0, 0)
+	var softLimit *ErrSoftLimit
+	if !errors.As(err, &softLimit) || softLimit.Joint != 2 || softLimit.Limit != limits.Joints[2] {
+		t.Errorf("J3 past its soft limit should be refused. Got %v", err)
+	}
+	err = arm.MoveSteppers(p.Speed, p.AccDur, p.AccSpd, p.DccDur, p.DccSpd, 0, 0, 2000, 0, 0, 0, 0)
+	if !errors.As(err, &softLimit) {
+		t.Errorf("Steps past the soft limit should be refused. Got %v", err)
+	}
+	if arm.CurrentStepperPosition() != start {
+		t.Errorf("Refused move should not move the arm")
+	}
+	if err = arm.MoveJointRadians(p.Speed, p.AccDur, p.AccSpd, p.DccDur, p.DccSpd, 0.3, -0.5, -0.5, 0, 0.8, 0, 0); err != nil {
+		t.Errorf("Move within the soft limits should be made. Got error: %s", err)
+	}
+}
+
+func TestAR3simulate_MoveZone(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	around := func(p kinematics.Position, size float64) (kinematics.Position, kinematics.Position) {
+		return kinematics.Position{X: p.X - size, Y: p.Y - size, Z: p.Z - size},
+			kinematics.Position{X: p.X + size, Y: p.Y + size, Z: p.Z + size}
+	}
+	min, max := around(start.Position, 30)
+	bench := Box{Name: "bench", Min: min, Max: max}
+	if err := arm.SetSoftLimits(SoftLimits{KeepIn: []Box{bench}}); err != nil {
+		t.Fatalf("Limits should be set. Got error: %s", err)
+	}
+
+	target := start
+	target.Position.Z -= 20
+	if err := arm.Move(DefaultMoveParams.Speed, DefaultMoveParams.AccDur, DefaultMoveParams.AccSpd, DefaultMoveParams.DccDur, DefaultMoveParams.DccSpd, target); err != nil {
+		t.Errorf("Move within the keep-in zone should be made. Got error: %s", err)
+	}
+	target.Position.Z -= 40
+	err := arm.MoveWithParams(DefaultMoveParams, target)
+	var zone *ErrZone
+	if !errors.As(err, &zone) || zone.Zone != "" {
+		t.Errorf("Move out of the keep-in zone should be refused. Got %v", err)
+	}
+}
+
+func TestAR3exec_MoveZone(t *testing.T) {
+	arm, mt := connectMemory(t)
+	arm.SetJointRadians(linearStart)
+	target := arm.CurrentPose()
+	target.Position.Z -= 50
+
+	// A tube rack half way down, clear of both ends.
+	rack := Box{Name: "rack", Min: target.Position, Max: target.Position}
+	rack.Min.Z += 20
+	rack.Max.Z += 30
+	rack.Min.X -= 10
+	rack.Max.X += 10
+	rack.Min.Y -= 10
+	rack.Max.Y += 10
+	if err := arm.SetSoftLimits(SoftLimits{KeepOut: []Box{rack}}); err != nil {
+		t.Fatalf("Limits should be set. Got error: %s", err)
+	}
+	err := arm.MoveWithParams(DefaultMoveParams, target)
+	var zone *ErrZone
+	if !errors.As(err, &zone) || zone.Zone != "rack" {
+		t.Errorf("Move through the rack should be refused. Got %v", err)
+	}
+	err = arm.MoveLinear(DefaultMoveParams, target, 2, 5)
+	if !errors.As(err, &zone) || zone.Zone != "rack" {
+		t.Errorf("Linear move through the rack should be refused. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for a refused move. Got %v", mt.Commands())
+	}
+	if got := arm.CurrentSoftLimits(); len(got.KeepOut) != 1 || got.KeepOut[0] != rack {
+		t.Errorf("Expected the limits that were set. Got %+v", got)
+	}
+}
+
+func TestAR3simulate_MoveSoftLimitRecovery(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians([7]float64{0, -0.5, 0.3, 0, 0.8, 0, 0})
+	var limits SoftLimits
+	limits.Joints[2] = JointLimit{Enabled: true, Min: -1, Max: 0}
+	if err := arm.SetSoftLimits(limits); err != nil {
+		t.Fatalf("Limits should be set. Got error: %s", err)
+	}
+
+	p := DefaultMoveParams
+	var softLimit *ErrSoftLimit
+	err := arm.MoveJointRadiansWithParams(p, 0, -0.5, 0.5, 0, 0.8, 0, 0)
+	if !errors.As(err, &softLimit) {
+		t.Errorf("J3 further past its soft limit should be refused. Got %v", err)
+	}
+	if err = arm.MoveJointRadiansWithParams(p, 0, -0.5, 0.1, 0, 0.8, 0, 0); err != nil {
+		t.Errorf("J3 moving back towards its soft limit should be allowed. Got error: %s", err)
+	}
+	if err = arm.MoveJointRadiansWithParams(p, 0, -0.5, -0.5, 0, 0.8, 0, 0); err != nil {
+		t.Errorf("J3 moving back within its soft limit should be allowed. Got error: %s", err)
+	}
+	if err = arm.MoveJointRadiansWithParams(p, 0, -0.5, 0.1, 0, 0.8, 0, 0); !errors.As(err, &softLimit) {
+		t.Errorf("J3 leaving its soft limit again should be refused. Got %v", err)
+	}
+}
+
+func TestAR3simulate_MoveZoneRecovery(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	inside := start
+	inside.Position.Z -= 40
+	// The TCP starts 10 mm above the bench.
+	bench := Box{Name: "bench", Min: inside.Position, Max: inside.Position}
+	bench.Min.X, bench.Min.Y, bench.Min.Z = bench.Min.X-30, bench.Min.Y-30, bench.Min.Z-30
+	bench.Max.X, bench.Max.Y, bench.Max.Z = bench.Max.X+30, bench.Max.Y+30, bench.Max.Z+30
+	if err := arm.SetSoftLimits(SoftLimits{KeepIn: []Box{bench}}); err != nil {
+		t.Fatalf("Limits should be set. Got error: %s", err)
+	}
+
+	above := start
+	above.Position.Z += 20
+	err := arm.MoveWithParams(DefaultMoveParams, above)
+	var zone *ErrZone
+	if !errors.As(err, &zone) {
+		t.Errorf("Move further from the keep-in zone should be refused. Got %v", err)
+	}
+	if err = arm.MoveWithParams(DefaultMoveParams, inside); err != nil {
+		t.Errorf("Move back into the keep-in zone should be allowed. Got error: %s", err)
+	}
+}
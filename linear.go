@@ -0,0 +1,288 @@
+package ar3
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// maxWaypointJointStep is the furthest, in radians, any joint may turn
+// between two waypoints of a Cartesian path. A bigger jump means inverse
+// kinematics changed branch, which happens when the path runs through or
+// close to a singularity.
+const maxWaypointJointStep = 20 * degreesToRadians
+
+// quaternionFromRotation converts a rotation matrix to a unit quaternion.
+func quaternionFromRotation(r mat3) kinematics.Quaternion {
+	var q kinematics.Quaternion
+	switch tr := r[0][0] + r[1][1] + r[2][2]; {
+	case tr > 0:
+		s := math.Sqrt(tr+1) * 2
+		q = kinematics.Quaternion{W: s / 4, X: (r[2][1] - r[1][2]) / s, Y: (r[0][2] - r[2][0]) / s, Z: (r[1][0] - r[0][1]) / s}
+	case r[0][0] > r[1][1] && r[0][0] > r[2][2]:
+		s := math.Sqrt(1+r[0][0]-r[1][1]-r[2][2]) * 2
+		q = kinematics.Quaternion{W: (r[2][1] - r[1][2]) / s, X: s / 4, Y: (r[0][1] + r[1][0]) / s, Z: (r[0][2] + r[2][0]) / s}
+	case r[1][1] > r[2][2]:
+		s := math.Sqrt(1+r[1][1]-r[0][0]-r[2][2]) * 2
+		q = kinematics.Quaternion{W: (r[0][2] - r[2][0]) / s, X: (r[0][1] + r[1][0]) / s, Y: s / 4, Z: (r[1][2] + r[2][1]) / s}
+	default:
+		s := math.Sqrt(1+r[2][2]-r[0][0]-r[1][1]) * 2
+		q = kinematics.Quaternion{W: (r[1][0] - r[0][1]) / s, X: (r[0][2] + r[2][0]) / s, Y: (r[1][2] + r[2][1]) / s, Z: s / 4}
+	}
+	return q
+}
+
+// slerp interpolates between unit quaternions a and b along the shorter arc,
+// returning a at t = 0 and b at t = 1.
+func slerp(a, b kinematics.Quaternion, t float64) kinematics.Quaternion {
+	dot := a.W*b.W + a.X*b.X + a.Y*b.Y + a.Z*b.Z
+	if dot < 0 {
+		b = kinematics.Quaternion{W: -b.W, X: -b.X, Y: -b.Y, Z: -b.Z}
+		dot = -dot
+	}
+	wa, wb := 1-t, t
+	// Nearly parallel quaternions are interpolated linearly, which avoids
+	// dividing by a tiny sine.
+	if dot < 1-1e-9 {
+		theta := math.Acos(math.Min(dot, 1))
+		wa = math.Sin((1-t)*theta) / math.Sin(theta)
+		wb = math.Sin(t*theta) / math.Sin(theta)
+	}
+	q := kinematics.Quaternion{
+		W: wa*a.W + wb*b.W,
+		X: wa*a.X + wb*b.X,
+		Y: wa*a.Y + wb*b.Y,
+		Z: wa*a.Z + wb*b.Z,
+	}
+	norm := math.Sqrt(q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z)
+	return kinematics.Quaternion{W: q.W / norm, X: q.X / norm, Y: q.Y / norm, Z: q.Z / norm}
+}
+
+// rotationAngle returns the angle in radians of the rotation from a to b.
+func rotationAngle(a, b kinematics.Quaternion) float64 {
+	dot := math.Abs(a.W*b.W + a.X*b.X + a.Y*b.Y + a.Z*b.Z)
+	return 2 * math.Acos(math.Min(dot, 1))
+}
+
+// interpolatePoses splits the straight line from start to end into
+// waypoints no more than stepMM apart, rotating by no more than stepDeg
+// degrees between them. The last waypoint is end.
+func interpolatePoses(start, end kinematics.Pose, stepMM, stepDeg float64) ([]kinematics.Pose, error) {
+	if stepMM <= 0 || stepDeg <= 0 {
+		return nil, fmt.Errorf("path steps must be positive. Got %g mm and %g degrees", stepMM, stepDeg)
+	}
+	qa, qb := unitQuaternion(start.Rotation), unitQuaternion(end.Rotation)
+	a, b := start.Position, end.Position
+	distance := toVec3(b).sub(toVec3(a)).norm()
+	n := steps(distance, rotationAngle(qa, qb)/degreesToRadians, stepMM, stepDeg)
+	waypoints := make([]kinematics.Pose, n)
+	for i := range waypoints {
+		t := float64(i+1) / float64(n)
+		waypoints[i] = kinematics.Pose{
+			Position: kinematics.Position{
+				X: a.X + t*(b.X-a.X),
+				Y: a.Y + t*(b.Y-a.Y),
+				Z: a.Z + t*(b.Z-a.Z),
+			},
+			Rotation: slerp(qa, qb, t),
+		}
+	}
+	return waypoints, nil
+}
+
+// planPath solves inverse kinematics for each waypoint of the tool's TCP,
+// starting from the current joints and keeping to the solution nearest the
+// previous waypoint.
+// Every waypoint is checked against the joint limits, and the path is refused
+// if a joint would jump between waypoints.
+func (p RobotProfile) planPath(current [7]float64, tool Tool, waypoints []kinematics.Pose) ([][6]float64, error) {
+	joints := make([][6]float64, len(waypoints))
+	previous := current
+	for i, waypoint := range waypoints {
+		solution, err := p.solvePose(tool.flangePose(waypoint), previous, 0)
+		if err != nil {
+			return nil, fmt.Errorf("waypoint %d of %d: %w", i+1, len(waypoints), err)
+		}
+		for j := range solution {
+			if jump := math.Abs(solution[j] - previous[j]); jump > maxWaypointJointStep {
+				return nil, fmt.Errorf("waypoint %d of %d: J%d would jump %.1f degrees, so the path runs through a singularity", i+1, len(waypoints), j+1, jump/degreesToRadians)
+			}
+		}
+		joints[i] = solution
+		copy(previous[:6], solution[:])
+	}
+	return joints, nil
+}
+
+// pathSteps converts a path of joint angles to the relative steps of each
+// move along it, starting from the stepper position from, with the track held
+// at track millimeters.
+func (p RobotProfile) pathSteps(from [7]int, track float64, path [][6]float64) ([][7]int, error) {
+	sl := p.limitSwitchSteps()
+	moves := make([][7]int, len(path))
+	for i, joints := range path {
+		steps, err := p.jointsToSteps([7]float64{joints[0], joints[1], joints[2], joints[3], joints[4], joints[5], track})
+		if err != nil {
+			return nil, err
+		}
+		for j := range from {
+			moves[i][j] = steps[j] + sl[j] - from[j]
+			from[j] += moves[i][j]
+		}
+	}
+	return moves, nil
+}
+
+// segmentRampDur is the longest ramp, as a percentage of the segment, at
+// the ends of a path's segments other than its first and last.
+const segmentRampDur = 5
+
+// segmentParams returns the MoveParams for segment i of n along a path. The
+// firmware finishes each move before it reads the next, so every segment
+// starts and ends at rest. The first segment accelerates and the last
+// decelerates as params do, and the ends in between keep a short ramp at the
+// same ramp speeds, so the steppers do not skip steps starting and stopping
+// at full speed.
+func segmentParams(params MoveParams, i, n int) MoveParams {
+	if i > 0 && params.AccDur > segmentRampDur {
+		params.AccDur = segmentRampDur
+	}
+	if i < n-1 && params.DccDur > segmentRampDur {
+		params.DccDur = segmentRampDur
+	}
+	return params
+}
+
+// movingSegments returns the indices of the moves that step at least one axis.
+// Moves that step nothing are never sent, so the segments are numbered for
+// segmentParams by these alone.
+func movingSegments(moves [][7]int) []int {
+	var moving []int
+	for i, relative := range moves {
+		if relative != ([7]int{}) {
+			moving = append(moving, i)
+		}
+	}
+	return moving
+}
+
+// MoveLinear moves the end effector to pose in a straight line, turning it
+// steadily (by quaternion SLERP) on the way. The line is split into waypoints
+// no more than stepMM millimeters apart and stepDeg degrees of rotation apart.
+// Every waypoint is solved and checked against the joint limits before the
+// arm moves, then the segments are streamed to the arm as one move command
+// each. The track stays where it is.
+func (ar3 *AR3exec) MoveLinear(params MoveParams, pose kinematics.Pose, stepMM, stepDeg float64) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		return ar3.moveLinear(ctx, params, pose, stepMM, stepDeg)
+	})
+}
+
+// moveLinear is MoveLinear, run on the command loop.
+func (ar3 *AR3exec) moveLinear(ctx context.Context, params MoveParams, pose kinematics.Pose, stepMM, stepDeg float64) error {
+	waypoints, err := interpolatePoses(ar3.CurrentPose(), pose, stepMM, stepDeg)
+	if err != nil {
+		return err
+	}
+	return ar3.movePath(ctx, params, waypoints)
+}
+
+// movePath solves and checks every waypoint, then streams them to the arm,
+// waiting for the arm only once it reaches the last.
+func (ar3 *AR3exec) movePath(ctx context.Context, params MoveParams, waypoints []kinematics.Pose) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	profile := ar3.Profile()
+	current := ar3.CurrentJointRadians()
+	path, err := profile.planPath(current, ar3.CurrentTool(), waypoints)
+	if err != nil {
+		return err
+	}
+	speeds, err := ar3.CurrentSingularityPolicy().speeds(path, profile.DhParameters)
+	if err != nil {
+		return err
+	}
+
+	moves, err := profile.pathSteps(ar3.CurrentStepperPosition(), current[6], path)
+	if err != nil {
+		return err
+	}
+	if err := ar3.checkMoves(moves...); err != nil {
+		return err
+	}
+	stops := ar3.stopCount()
+	moving := movingSegments(moves)
+	for n, i := range moving {
+		if err := ar3.checkStopped(stops); err != nil {
+			return err
+		}
+		if err := ar3.sendMove(ctx, slowParams(segmentParams(params, n, len(moving)), speeds[i]), moves[i]); err != nil {
+			return err
+		}
+	}
+
+	// This has to send and get a response to indicate the path is complete
+	if err := ar3.echo(ctx); err != nil {
+		return err
+	}
+	if err := ar3.checkStopped(stops); err != nil {
+		return err
+	}
+	return ar3.checkEncoders(ctx)
+}
+
+// MoveLinear simulates AR3exec.MoveLinear().
+func (ar3 *AR3simulate) MoveLinear(params MoveParams, pose kinematics.Pose, stepMM, stepDeg float64) error {
+	waypoints, err := interpolatePoses(ar3.CurrentPose(), pose, stepMM, stepDeg)
+	if err != nil {
+		return err
+	}
+	return ar3.movePath(params, waypoints)
+}
+
+// movePath simulates AR3exec.movePath().
+func (ar3 *AR3simulate) movePath(params MoveParams, waypoints []kinematics.Pose) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	profile := ar3.Profile()
+	current := ar3.CurrentJointRadians()
+	path, err := profile.planPath(current, ar3.CurrentTool(), waypoints)
+	if err != nil {
+		return err
+	}
+	speeds, err := ar3.CurrentSingularityPolicy().speeds(path, profile.DhParameters)
+	if err != nil {
+		return err
+	}
+	from := ar3.CurrentStepperPosition()
+	moves, err := profile.pathSteps(from, current[6], path)
+	if err != nil {
+		return err
+	}
+	err = ar3.CurrentSoftLimits().checkSteps(profile, ar3.CurrentTool(), from, moves...)
+	if err != nil {
+		return err
+	}
+	err = ar3.CurrentCollisionModel().checkSteps(profile, ar3.CurrentTool(), from, moves...)
+	if err != nil {
+		return err
+	}
+	stops := ar3.stopCount()
+	moving := movingSegments(moves)
+	for n, i := range moving {
+		if ar3.stopCount() != stops {
+			return ErrStopped
+		}
+		j := path[i]
+		err := ar3.MoveJointRadiansWithParams(slowParams(segmentParams(params, n, len(moving)), speeds[i]), j[0], j[1], j[2], j[3], j[4], j[5], current[6])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package ar3
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+// linearStart is a pose in the middle of the AR3's workspace.
+var linearStart = [7]float64{0, -0.5, -0.8, 0, 0.8, 0, 0}
+
+func TestInterpolatePoses(t *testing.T) {
+	start := kinematics.Pose{Rotation: kinematics.Quaternion{W: 1}}
+	end := kinematics.Pose{
+		Position: kinematics.Position{X: 10, Y: -5},
+		Rotation: kinematics.Quaternion{W: math.Cos(math.Pi / 4), Z: math.Sin(math.Pi / 4)},
+	}
+	waypoints, err := interpolatePoses(start, end, 1, 30)
+	if err != nil {
+		t.Fatalf("Interpolation should succeed. Got error: %s", err)
+	}
+	// 11.2 mm at 1 mm a step beats 90 degrees at 30 degrees a step.
+	if len(waypoints) != 12 {
+		t.Errorf("Expected 12 waypoints. Got %d", len(waypoints))
+	}
+	if !samePose(waypoints[len(waypoints)-1], end) {
+		t.Errorf("Last waypoint should be the end pose. Got %+v", waypoints[len(waypoints)-1])
+	}
+	half := slerp(start.Rotation, end.Rotation, 0.5)
+	if angle := rotationAngle(start.Rotation, half); math.Abs(angle-math.Pi/4) > 1e-9 {
+		t.Errorf("Half way should be rotated 45 degrees. Got %f", angle/degreesToRadians)
+	}
+
+	if _, err = interpolatePoses(start, end, 0, 1); err == nil {
+		t.Errorf("Zero step should be refused")
+	}
+}
+
+func TestAR3simulate_MoveLinear(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	start := arm.CurrentPose()
+	end := start
+	end.Position.Z -= 50
+	end.Position.X += 20
+
+	waypoints, _ := interpolatePoses(start, end, 2, 5)
+	path, err := AR3Profile.planPath(arm.CurrentJointRadians(), Tool{}, waypoints)
+	if err != nil {
+		t.Fatalf("Path should plan. Got error: %s", err)
+	}
+	// Every waypoint should sit on the line from start to end.
+	for _, joints := range path {
+		p := kinematics.ForwardKinematics(joints[:], AR3DhParameters).Position
+		x := start.Position.X + 20*(start.Position.Z-p.Z)/50
+		if math.Abs(p.X-x) > 1e-6 || math.Abs(p.Y-start.Position.Y) > 1e-6 {
+			t.Errorf("Waypoint should be on the line. Got %+v", p)
+		}
+	}
+
+	if err = arm.MoveLinear(DefaultMoveParams, end, 2, 5); err != nil {
+		t.Fatalf("Linear move should succeed. Got error: %s", err)
+	}
+	got := arm.CurrentPose().Position
+	if math.Abs(got.X-end.Position.X)+math.Abs(got.Y-end.Position.Y)+math.Abs(got.Z-end.Position.Z) > 1 {
+		t.Errorf("Linear move should reach %+v. Got %+v", end.Position, got)
+	}
+}
+
+func TestAR3exec_MoveLinear(t *testing.T) {
+	arm, mt := connectMemory(t)
+	arm.SetJointRadians(linearStart)
+	end := arm.CurrentPose()
+	end.Position.Z -= 10
+
+	if err := arm.MoveLinear(DefaultMoveParams, end, 2, 5); err != nil {
+		t.Fatalf("Linear move should succeed. Got error: %s", err)
+	}
+	commands := mt.Commands()[1:]
+	if len(commands) != 6 {
+		t.Fatalf("Expected 5 moves and a single echo. Got %v", commands)
+	}
+	if !strings.HasSuffix(commands[0], "S25G10H15I5K5") ||
+		!strings.HasSuffix(commands[2], "S25G10H5I5K5") ||
+		!strings.HasSuffix(commands[4], "S25G10H5I20K5") {
+		t.Errorf("The ends of the path should ramp as asked, and the waypoints briefly. Got %v", commands)
+	}
+	if commands[5] != "TMTest" {
+		t.Errorf("Path should finish with an echo. Got %s", commands[5])
+	}
+}
+
+func TestAR3exec_MovePathSkippedEnd(t *testing.T) {
+	arm, mt := connectMemory(t)
+	arm.SetJointRadians(linearStart)
+	end := arm.CurrentPose()
+	end.Position.Z -= 10
+
+	// The spline's last segment, from end back to end, steps nothing.
+	if err := arm.MoveSpline(DefaultMoveParams, []kinematics.Pose{end, end}, 2, 5); err != nil {
+		t.Fatalf("Spline move should succeed. Got error: %s", err)
+	}
+	commands := mt.Commands()[1:]
+	if len(commands) < 2 || commands[len(commands)-1] != "TMTest" {
+		t.Fatalf("Expected moves and a single echo. Got %v", commands)
+	}
+	for i, command := range commands[:len(commands)-1] {
+		if last := i == len(commands)-2; strings.HasSuffix(command, "I20K5") != last {
+			t.Errorf("Only the last move sent should decelerate as asked. Got %v", commands)
+			break
+		}
+	}
+}
+
+func TestAR3exec_MoveLinearOutOfRange(t *testing.T) {
+	arm, mt := connectMemory(t)
+	arm.SetJointRadians(linearStart)
+	end := arm.CurrentPose()
+	end.Position.X += 1000
+
+	err := arm.MoveLinear(DefaultMoveParams, end, 5, 5)
+	if err == nil || !strings.Contains(err.Error(), "waypoint") {
+		t.Errorf("Path out of reach should fail at a waypoint. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for a path that fails. Got %v", mt.Commands())
+	}
+}
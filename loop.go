@@ -0,0 +1,64 @@
+package ar3
+
+import (
+	"context"
+	"fmt"
+)
+
+// request is a command waiting to run on the command loop of an AR3exec.
+type request struct {
+	run  func() error
+	done chan error
+}
+
+// startLoop starts the command loop. Every command sent to the AR3 runs on
+// the loop one at a time, so commands from different goroutines never
+// interleave on serial, and a move and the echo that confirms it are never
+// split up.
+func (ar3 *AR3exec) startLoop() {
+	ar3.requests = make(chan request)
+	ar3.quit = make(chan struct{})
+	go ar3.loop()
+}
+
+// loop runs requests until the AR3exec is closed.
+func (ar3 *AR3exec) loop() {
+	for {
+		select {
+		case r := <-ar3.requests:
+			r.done <- r.run()
+		case <-ar3.quit:
+			return
+		}
+	}
+}
+
+// do runs f on the command loop and returns its error. Unexported methods
+// that talk to serial (echo, moveSteppers, calibrate, and so on) must only be
+// called from within f, and f must not call do.
+func (ar3 *AR3exec) do(ctx context.Context, f func() error) error {
+	if ar3.requests == nil {
+		return ErrTransportClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("command not sent to AR3: %w", err)
+	}
+	r := request{run: f, done: make(chan error, 1)}
+	select {
+	case ar3.requests <- r:
+	case <-ctx.Done():
+		return fmt.Errorf("command not sent to AR3: %w", ctx.Err())
+	case <-ar3.quit:
+		return ErrTransportClosed
+	}
+	return <-r.done
+}
+
+// stopLoop stops the command loop once the command it is running finishes.
+func (ar3 *AR3exec) stopLoop() {
+	ar3.closeOnce.Do(func() {
+		if ar3.quit != nil {
+			close(ar3.quit)
+		}
+	})
+}
@@ -1,29 +1,59 @@
 package ar3
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/trilobio/kinematics"
 )
 
 // AR3simulate struct represents an AR3 robotic arm interface for testing purposes.
+// Like AR3exec, it is safe for concurrent use.
 type AR3simulate struct {
+	queue  motionQueue
+	moving sync.Mutex // held for the whole of each move
+
+	mu               sync.Mutex // guards the fields below
+	profile          RobotProfile
+	limitSwitchSteps [7]int
 	jointVals        [7]int
 	jointDirs        [7]bool
-	limitSwitchSteps [7]int
+
+	drift              [6]int
+	stepLossCheck      bool
+	stepLossTolerance  [6]int
+	tool               Tool
+	singularityPolicy  SingularityPolicy
+	collisionModel     CollisionModel
+	softLimits         SoftLimits
+	realTime           bool
+	elapsed            time.Duration
+	calibrated         [7]bool
+	uncalibratedMotion bool
+	stops              int
+	abort              chan struct{}
 }
 
-// ConnectMock connects to a mock AR3simulate interface.
-func ConnectMock() Arm {
-	return &AR3simulate{limitSwitchSteps: limitSwitchSteps}
+// ConnectMock connects to a mock AR3simulate interface with the given
+// profile. Profiles from BuiltinProfile and LoadProfile are already validated.
+func ConnectMock(profile RobotProfile) Arm {
+	return &AR3simulate{profile: profile, limitSwitchSteps: profile.limitSwitchSteps()}
 }
 
 // Calibrate simulates AR3exec.Calibrate()
 func (ar3 *AR3simulate) Calibrate(speed int, j1, j2, j3, j4, j5, j6, tr bool) error {
 	homeMotor := []bool{j1, j2, j3, j4, j5, j6, tr}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	for i := range ar3.jointVals {
 		if homeMotor[i] {
 			ar3.jointVals[i] = 0
+			if i < len(ar3.drift) {
+				ar3.drift[i] = 0
+			}
+			ar3.calibrated[i] = true
 		}
 	}
 	return nil
@@ -36,31 +66,40 @@ func (ar3 *AR3simulate) Echo() error {
 
 // SetDirections simulates AR3exec.SetDirections().
 func (ar3 *AR3simulate) SetDirections(jointDirs [7]bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	ar3.jointDirs = jointDirs
 }
 
 // GetDirections simulates AR3exec.GetDirections().
 func (ar3 *AR3simulate) GetDirections() [7]bool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	return ar3.jointDirs
 }
 
 // CurrentStepperPosition simulates AR3exec.CurrentStepperPosition().
 func (ar3 *AR3simulate) CurrentStepperPosition() [7]int {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
 	return ar3.jointVals
 }
 
 // CurrentJointRadians simulates AR3exec.CurrentJointRadians().
 func (ar3 *AR3simulate) CurrentJointRadians() [7]float64 {
-	js := ar3.jointVals
-	sl := ar3.limitSwitchSteps
+	ar3.mu.Lock()
+	js, sl, profile := ar3.jointVals, ar3.limitSwitchSteps, ar3.profile
+	ar3.mu.Unlock()
 	stepVals := [7]int{js[0] - sl[0], js[1] - sl[1], js[2] - sl[2], js[3] - sl[3], js[4] - sl[4], js[5] - sl[5], js[6] - sl[6]}
-	jointVals := stepsToAngles(stepVals, false)
+	jointVals := profile.stepsToAngles(stepVals, false)
 	return jointVals
 }
 
 // SetJointRadians simulates AR3exec.SetJointRadians().
 func (ar3 *AR3simulate) SetJointRadians(joints [7]float64) {
-	jointSteps := anglesToSteps(joints, false)
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	jointSteps := ar3.profile.anglesToSteps(joints, false)
 
 	sl := ar3.limitSwitchSteps
 	relSteps := [7]int{
@@ -74,52 +113,108 @@ func (ar3 *AR3simulate) SetJointRadians(joints [7]float64) {
 func (ar3 *AR3simulate) CurrentPose() kinematics.Pose {
 	ja := ar3.CurrentJointRadians()
 	thetasInit := []float64{ja[0], ja[1], ja[2], ja[3], ja[4], ja[5]}
-	return kinematics.ForwardKinematics(thetasInit, AR3DhParameters)
+	return ar3.CurrentTool().tcpPose(kinematics.ForwardKinematics(thetasInit, ar3.Profile().DhParameters))
 }
 
-// MoveSteppers simulates AR3exec.MoveSteppers().
-func (ar3 *AR3simulate) moveSteppersRelative(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error {
-	// First, check if the move can be made
-	to := []int{j1, j2, j3, j4, j5, j6}
-	from := []int{ar3.jointVals[0], ar3.jointVals[1], ar3.jointVals[2], ar3.jointVals[3], ar3.jointVals[4], ar3.jointVals[5]}
-	limits := []int{j1stepLim, j2stepLim, j3stepLim, j4stepLim, j5stepLim, j6stepLim}
-	motor := []string{"J1", "J2", "J3", "J4", "J5", "J6"}
-	var newPositions [7]int
-	for i := 0; i < 6; i++ {
-		newJ := to[i] + from[i]
-		lowerLimit := 0
-		upperLimit := limits[i]
-		if !calibDirs[i] {
-			lowerLimit = -upperLimit
-			upperLimit = 0
-		}
-		if newJ < lowerLimit || newJ > upperLimit {
-			return fmt.Errorf("%s out of range. Must be between %d and %d. Got %d", motor[i], lowerLimit, upperLimit, newJ)
+// Profile simulates AR3exec.Profile().
+func (ar3 *AR3simulate) Profile() RobotProfile {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.profile
+}
+
+// moveSteppersRelative simulates AR3exec.moveSteppersRelative(), returning
+// how long the move would take the AR3. The caller must hold ar3.mu.
+func (ar3 *AR3simulate) moveSteppersRelative(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) (time.Duration, error) {
+	if err := params.Validate(); err != nil {
+		return 0, err
+	}
+
+	if !ar3.uncalibratedMotion {
+		if err := ar3.profile.calibrationError(ar3.calibrated); err != nil {
+			return 0, err
 		}
-		newPositions[i] = newJ
+	}
+
+	// First, check if the move can be made
+	relative := [7]int{j1, j2, j3, j4, j5, j6, tr}
+	newPositions, err := ar3.profile.checkStepLimits(ar3.jointVals, relative)
+	if err != nil {
+		return 0, err
+	}
+	err = ar3.softLimits.checkSteps(ar3.profile, ar3.tool, ar3.jointVals, relative)
+	if err != nil {
+		return 0, err
+	}
+	err = ar3.collisionModel.checkSteps(ar3.profile, ar3.tool, ar3.jointVals, relative)
+	if err != nil {
+		return 0, err
+	}
+	duration, err := EstimateMoveDuration(params, relative)
+	if err != nil {
+		return 0, err
 	}
 	// If all the limits check out, apply them.
 	ar3.jointVals = newPositions
+	ar3.elapsed += duration
 
-	// Since we are simulating, simply update and assume that there is no error.
-	return nil
+	// Since we are simulating, simply update. Only drift added with AddDrift
+	// can make the move fail.
+	return duration, ar3.checkEncoders()
 }
 
 // MoveSteppers simulates AR3exec.MoveSteppers
 func (ar3 *AR3simulate) MoveSteppers(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error {
+	params := positionalParams(speed, accdur, accspd, dccdur, dccspd)
+	return ar3.MoveSteppersWithParams(params, j1, j2, j3, j4, j5, j6, tr)
+}
+
+// MoveSteppersWithParams simulates AR3exec.MoveSteppersWithParams
+func (ar3 *AR3simulate) MoveSteppersWithParams(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) error {
+	// Like the AR3, the mock makes one move at a time.
+	ar3.moving.Lock()
+	defer ar3.moving.Unlock()
+
+	ar3.mu.Lock()
 	js := ar3.jointVals
 	sl := ar3.limitSwitchSteps
-	return ar3.moveSteppersRelative(speed, accdur, accspd, dccdur, dccspd,
+	duration, err := ar3.moveSteppersRelative(params,
 		j1-js[0]+sl[0], j2-js[1]+sl[1], j3-js[2]+sl[2], j4-js[3]+sl[3],
 		j5-js[4]+sl[4], j6-js[5]+sl[5], tr-js[6]+sl[6])
+	realTime := ar3.realTime
+	if ar3.abort == nil {
+		ar3.abort = make(chan struct{})
+	}
+	abort := ar3.abort
+	ar3.mu.Unlock()
+
+	if realTime && err == nil {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-abort:
+			return ErrStopped
+		}
+	}
+	return err
 }
 
 // MoveJointRadians simulates AR3exec.MoveJointRadians
 func (ar3 *AR3simulate) MoveJointRadians(speed, accdur, accspd, dccdur, dccspd int, j1, j2, j3, j4, j5, j6, tr float64) error {
+	params := positionalParams(speed, accdur, accspd, dccdur, dccspd)
+	return ar3.MoveJointRadiansWithParams(params, j1, j2, j3, j4, j5, j6, tr)
+}
 
-	jointSteps := anglesToSteps([7]float64{j1, j2, j3, j4, j5, j6, tr}, false)
+// MoveJointRadiansWithParams simulates AR3exec.MoveJointRadiansWithParams
+func (ar3 *AR3simulate) MoveJointRadiansWithParams(params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) error {
 
-	return ar3.MoveSteppers(speed, accdur, accspd, dccdur, dccspd,
+	jointSteps, err := ar3.Profile().jointsToSteps([7]float64{j1, j2, j3, j4, j5, j6, tr})
+	if err != nil {
+		return err
+	}
+
+	return ar3.MoveSteppersWithParams(params,
 		jointSteps[0], jointSteps[1], jointSteps[2], jointSteps[3],
 		jointSteps[4], jointSteps[5], jointSteps[6])
 }
@@ -127,17 +222,110 @@ func (ar3 *AR3simulate) MoveJointRadians(speed, accdur, accspd, dccdur, dccspd i
 // Move to a new end effector Pose using inverse kinematics to solve for the
 // joint angles.
 func (ar3 *AR3simulate) Move(speed, accdur, accspd, dccdur, dccspd int, pose kinematics.Pose) error {
-	ja := ar3.CurrentJointRadians()
-	thetasInit := []float64{ja[0], ja[1], ja[2], ja[3], ja[4], ja[5]}
-	tj, err := kinematics.InverseKinematics(pose, AR3DhParameters, thetasInit)
+	return ar3.MoveWithParams(positionalParams(speed, accdur, accspd, dccdur, dccspd), pose)
+}
+
+// MoveWithParams simulates AR3exec.MoveWithParams
+func (ar3 *AR3simulate) MoveWithParams(params MoveParams, pose kinematics.Pose) error {
+	return ar3.moveTrack(params, pose, ar3.CurrentJointRadians()[6], 0)
+}
+
+// moveTrack simulates AR3exec.moveTrack
+func (ar3 *AR3simulate) moveTrack(params MoveParams, pose kinematics.Pose, track float64, hint ConfigurationHint) error {
+	tj, err := ar3.Profile().solvePose(ar3.CurrentTool().flangePose(pose), ar3.CurrentJointRadians(), hint)
 	if err != nil {
-		return fmt.Errorf("Inverse Kinematics failed with error: %s", err)
+		return err
 	}
-	return ar3.MoveJointRadians(speed, accdur, accspd, dccdur,
-		dccspd, tj[0], tj[1], tj[2], tj[3], tj[4], tj[5], 0)
+	speeds, err := ar3.CurrentSingularityPolicy().speeds([][6]float64{tj}, ar3.Profile().DhParameters)
+	if err != nil {
+		return err
+	}
+	params = slowParams(params, speeds[0])
+	return ar3.MoveJointRadiansWithParams(params, tj[0], tj[1], tj[2], tj[3], tj[4], tj[5], track)
 }
 
-// Wait simulates AR3.Wait().
+// Wait simulates AR3.Wait(). It only sleeps in real time (see SetRealTime),
+// but always adds to SimulatedTime.
 func (ar3 *AR3simulate) Wait(waitTimeMilliseconds int) error {
+	wait := time.Duration(waitTimeMilliseconds) * time.Millisecond
+	ar3.mu.Lock()
+	ar3.elapsed += wait
+	realTime := ar3.realTime
+	ar3.mu.Unlock()
+	if realTime {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// SetRealTime sets whether moves and waits take as long as they would on the
+// AR3 (see MoveTiming), or finish immediately, which is the default.
+func (ar3 *AR3simulate) SetRealTime(realTime bool) {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.realTime = realTime
+}
+
+// SimulatedTime returns how long the moves and waits made so far would have
+// taken the AR3, whether or not they were made in real time.
+func (ar3 *AR3simulate) SimulatedTime() time.Duration {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.elapsed
+}
+
+// Close simulates AR3exec.Close().
+func (ar3 *AR3simulate) Close() error {
+	ar3.queue.flush()
+	return nil
+}
+
+// SetCommandTimeout simulates AR3exec.SetCommandTimeout(). Simulated commands
+// complete immediately, so the timeout is never reached.
+func (ar3 *AR3simulate) SetCommandTimeout(timeout time.Duration) {}
+
+// checkContext returns a wrapped ctx.Err() if ctx is already done, the same
+// way AR3exec refuses to send a command.
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("command not sent to AR3: %w", err)
+	}
 	return nil
 }
+
+// CalibrateContext simulates AR3exec.CalibrateContext().
+func (ar3 *AR3simulate) CalibrateContext(ctx context.Context, speed int, j1, j2, j3, j4, j5, j6, tr bool) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	return ar3.Calibrate(speed, j1, j2, j3, j4, j5, j6, tr)
+}
+
+// EchoContext simulates AR3exec.EchoContext().
+func (ar3 *AR3simulate) EchoContext(ctx context.Context) error {
+	return checkContext(ctx)
+}
+
+// MoveSteppersContext simulates AR3exec.MoveSteppersContext().
+func (ar3 *AR3simulate) MoveSteppersContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	return ar3.MoveSteppers(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr)
+}
+
+// MoveJointRadiansContext simulates AR3exec.MoveJointRadiansContext().
+func (ar3 *AR3simulate) MoveJointRadiansContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd int, j1, j2, j3, j4, j5, j6, tr float64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	return ar3.MoveJointRadians(speed, accdur, accspd, dccdur, dccspd, j1, j2, j3, j4, j5, j6, tr)
+}
+
+// MoveContext simulates AR3exec.MoveContext().
+func (ar3 *AR3simulate) MoveContext(ctx context.Context, speed, accdur, accspd, dccdur, dccspd int, pose kinematics.Pose) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	return ar3.Move(speed, accdur, accspd, dccdur, dccspd, pose)
+}
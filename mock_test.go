@@ -16,15 +16,23 @@ func TestMockArmInterface(t *testing.T) {
 	}
 }
 
+// connectCalibrated connects to a mock arm and calibrates it, as a program
+// would before moving a real one.
+func connectCalibrated(profile RobotProfile) Arm {
+	arm := ConnectMock(profile)
+	_ = arm.Calibrate(50, true, true, true, true, true, true, profile.HasTrack())
+	return arm
+}
+
 func TestConnectMock(t *testing.T) {
-	arm := ConnectMock()
+	arm := ConnectMock(AR3Profile)
 	if arm.Echo() != nil {
 		t.Errorf("Mock echo should always connect")
 	}
 }
 
 func TestAR3simulate_SetDirections(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	arm.SetDirections([7]bool{true, false, true, false, true, false, true})
 	if arm.GetDirections() != [7]bool{true, false, true, false, true, false, true} {
 		t.Errorf("GetDirections should be equivalent to SetDirections")
@@ -32,7 +40,7 @@ func TestAR3simulate_SetDirections(t *testing.T) {
 }
 
 func TestAR3simulate_CurrentStepperPosition(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	currentStepperPositions := arm.CurrentStepperPosition()
 	if currentStepperPositions != [7]int{0, 0, 0, 0, 0, 0, 0} {
 		t.Errorf("Steppers should be equivalent to [7]int{0, 0, 0, 0, 0, 0, 0}. Got %v", currentStepperPositions)
@@ -40,7 +48,7 @@ func TestAR3simulate_CurrentStepperPosition(t *testing.T) {
 }
 
 func TestAR3simulate_CurrentJointRadians(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	err := arm.MoveJointRadians(10, 10, 10, 10, 10, 0, 0, 0, 0, 0, 0, 0)
 	if err != nil {
 		t.Error(err)
@@ -52,7 +60,7 @@ func TestAR3simulate_CurrentJointRadians(t *testing.T) {
 }
 
 func TestAR3simulate_CurrentPose(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	currentPose := arm.CurrentPose()
 	// x86 and ARM systems calculate kinematics slightly differently.
 	if fmt.Sprintf("%5f", currentPose.Position.X) != "-76.626104" {
@@ -61,7 +69,7 @@ func TestAR3simulate_CurrentPose(t *testing.T) {
 }
 
 func TestAR3simulate_MoveSteppers(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	// Move the arm. First 5 numbers are rational defaults, and each motor gets moved 500 steps
 	err := arm.MoveSteppers(25, 15, 10, 20, 5, 500, 500, 500, 500, 500, 500, 0)
 	if err != nil {
@@ -72,7 +80,7 @@ func TestAR3simulate_MoveSteppers(t *testing.T) {
 func TestAR3simulate_MoveSteppersTooLarge(t *testing.T) {
 	// The following line establishes that mock DOES implement the AR3 interface.
 	var arm Arm //nolint
-	arm = ConnectMock()
+	arm = connectCalibrated(AR3Profile)
 	err := arm.MoveSteppers(25, 15, 10, 20, 5, 500, 500, 500, 500, 500, 500000000, 0)
 	if err == nil {
 		t.Errorf("Arm should have failed with large j6 value")
@@ -80,7 +88,7 @@ func TestAR3simulate_MoveSteppersTooLarge(t *testing.T) {
 }
 
 func TestAR3simulate_MoveJointRadians(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	// Move the arm 1 radian in each direction.
 	err := arm.MoveJointRadians(5, 10, 10, 10, 10, 0, 0, 0, 0, 0, 0, 0)
 	if err != nil {
@@ -89,7 +97,7 @@ func TestAR3simulate_MoveJointRadians(t *testing.T) {
 }
 
 func TestAR3simulate_Move(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	// Establish position to move to
 	err := arm.MoveJointRadians(25, 10, 10, 10, 10, 0, 0, math.Pi/4, 0, -math.Pi/4, 0, 0)
 	if err != nil {
@@ -117,7 +125,7 @@ func TestAR3simulate_Move(t *testing.T) {
 }
 
 func TestAR3simulate_Calibrate(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	err := arm.Calibrate(25, true, true, true, true, true, true, true)
 	if err != nil {
 		t.Errorf("Simulate arm should always succeed. Got error: %s", err)
@@ -125,7 +133,7 @@ func TestAR3simulate_Calibrate(t *testing.T) {
 }
 
 func TestAR3simulate_Wait(t *testing.T) {
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	err := arm.Wait(100)
 	if err != nil {
 		t.Errorf("Wait should always succeed")
@@ -134,7 +142,7 @@ func TestAR3simulate_Wait(t *testing.T) {
 
 func TestBasicHome(t *testing.T) {
 	// This tests a basic rational default for homing
-	arm := ConnectMock()
+	arm := connectCalibrated(AR3Profile)
 	err := arm.MoveJointRadians(25, 10, 10, 10, 10, 0, 0, 0, 0, 0, 0, 0)
 	if err != nil {
 		t.Errorf("Failed to go to basic position with error: %s", err)
@@ -0,0 +1,252 @@
+package ar3
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/trilobio/kinematics"
+)
+
+// ErrMotionFlushed is the error of a queued move that was flushed from the
+// motion queue before it started.
+var ErrMotionFlushed = errors.New("motion flushed from queue")
+
+// Motion is a handle on a move queued with one of the MoveAsync methods.
+// Queued moves run one after another, in the order they were queued. Moves
+// made with the blocking methods skip the queue, running between queued moves.
+type Motion struct {
+	run     func() error
+	done    chan struct{}
+	err     error
+	started bool // guarded by the queue's mu
+}
+
+// Done returns a channel that is closed once the move has finished, failed,
+// or been flushed from the queue.
+func (m *Motion) Done() <-chan struct{} {
+	return m.done
+}
+
+// Wait waits for the move to finish and returns its error. If ctx is done
+// first, Wait returns ctx.Err() and the move carries on.
+func (m *Motion) Wait(ctx context.Context) error {
+	select {
+	case <-m.done:
+		return m.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Err returns the error of the move once it is done, and nil while it is
+// still queued or running.
+func (m *Motion) Err() error {
+	select {
+	case <-m.done:
+		return m.err
+	default:
+		return nil
+	}
+}
+
+// finish records the result of the move and closes Done.
+func (m *Motion) finish(err error) {
+	m.err = err
+	close(m.done)
+}
+
+// motionQueue is a FIFO of moves, run by a worker goroutine that exits
+// whenever the queue empties. The zero value is an empty queue.
+type motionQueue struct {
+	mu      sync.Mutex
+	motions []*Motion
+	running bool // whether the worker goroutine is running
+	paused  bool
+	// wake is closed to wake a paused worker.
+	wake chan struct{}
+}
+
+// push queues a move that runs run, starting the worker if needed.
+func (q *motionQueue) push(run func() error) *Motion {
+	m := &Motion{run: run, done: make(chan struct{})}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.motions = append(q.motions, m)
+	if !q.running {
+		q.running = true
+		go q.work()
+	}
+	return m
+}
+
+// work runs queued moves until the queue is empty.
+func (q *motionQueue) work() {
+	for {
+		q.mu.Lock()
+		if len(q.motions) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		if q.paused {
+			wake := q.wake
+			q.mu.Unlock()
+			<-wake
+			continue
+		}
+		m := q.motions[0]
+		m.started = true
+		q.mu.Unlock()
+
+		err := m.run()
+
+		q.mu.Lock()
+		q.motions = q.motions[1:]
+		q.mu.Unlock()
+		m.finish(err)
+	}
+}
+
+// pending returns the moves that have not finished, running move first.
+func (q *motionQueue) pending() []*Motion {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	motions := make([]*Motion, len(q.motions))
+	copy(motions, q.motions)
+	return motions
+}
+
+// flush fails every move that has not started with ErrMotionFlushed, and
+// returns how many there were.
+func (q *motionQueue) flush() int {
+	q.mu.Lock()
+	keep := 0
+	if len(q.motions) > 0 && q.motions[0].started {
+		keep = 1
+	}
+	flushed := q.motions[keep:]
+	q.motions = q.motions[:keep:keep]
+	if q.paused {
+		// A paused worker wakes to find the queue empty, and exits.
+		close(q.wake)
+		q.wake = make(chan struct{})
+	}
+	q.mu.Unlock()
+	for _, m := range flushed {
+		m.finish(ErrMotionFlushed)
+	}
+	return len(flushed)
+}
+
+// pause stops the worker from starting queued moves.
+func (q *motionQueue) pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.paused {
+		q.paused = true
+		q.wake = make(chan struct{})
+	}
+}
+
+// resume lets the worker start queued moves again.
+func (q *motionQueue) resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused {
+		q.paused = false
+		close(q.wake)
+	}
+}
+
+// MoveSteppersAsync queues MoveSteppersWithParams on the motion queue and
+// returns without waiting for the arm.
+func (ar3 *AR3exec) MoveSteppersAsync(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) *Motion {
+	return ar3.queue.push(func() error {
+		return ar3.MoveSteppersWithParams(params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// MoveJointRadiansAsync queues MoveJointRadiansWithParams on the motion queue
+// and returns without waiting for the arm.
+func (ar3 *AR3exec) MoveJointRadiansAsync(params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) *Motion {
+	return ar3.queue.push(func() error {
+		return ar3.MoveJointRadiansWithParams(params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// MoveAsync queues MoveWithParams on the motion queue and returns without
+// waiting for the arm. Inverse kinematics is solved when the move starts, from
+// wherever the moves before it left the arm.
+func (ar3 *AR3exec) MoveAsync(params MoveParams, pose kinematics.Pose) *Motion {
+	return ar3.queue.push(func() error {
+		return ar3.MoveWithParams(params, pose)
+	})
+}
+
+// QueuedMotions returns the moves on the motion queue that have not finished,
+// in the order they will run. The first may already be running.
+func (ar3 *AR3exec) QueuedMotions() []*Motion {
+	return ar3.queue.pending()
+}
+
+// FlushQueue removes every move from the motion queue that has not started,
+// failing each with ErrMotionFlushed, and returns how many were removed. A
+// move that is already running is left to finish.
+func (ar3 *AR3exec) FlushQueue() int {
+	return ar3.queue.flush()
+}
+
+// Pause holds the moves on the motion queue until Resume. A move that is
+// already running is left to finish, so the arm comes to rest at the end of
+// it; use Stop to halt the arm mid-move. Moves made with the blocking methods
+// are not held.
+func (ar3 *AR3exec) Pause() {
+	ar3.queue.pause()
+}
+
+// Resume starts the moves held by Pause, in the order they were queued.
+func (ar3 *AR3exec) Resume() {
+	ar3.queue.resume()
+}
+
+// MoveSteppersAsync simulates AR3exec.MoveSteppersAsync().
+func (ar3 *AR3simulate) MoveSteppersAsync(params MoveParams, j1, j2, j3, j4, j5, j6, tr int) *Motion {
+	return ar3.queue.push(func() error {
+		return ar3.MoveSteppersWithParams(params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// MoveJointRadiansAsync simulates AR3exec.MoveJointRadiansAsync().
+func (ar3 *AR3simulate) MoveJointRadiansAsync(params MoveParams, j1, j2, j3, j4, j5, j6, tr float64) *Motion {
+	return ar3.queue.push(func() error {
+		return ar3.MoveJointRadiansWithParams(params, j1, j2, j3, j4, j5, j6, tr)
+	})
+}
+
+// MoveAsync simulates AR3exec.MoveAsync().
+func (ar3 *AR3simulate) MoveAsync(params MoveParams, pose kinematics.Pose) *Motion {
+	return ar3.queue.push(func() error {
+		return ar3.MoveWithParams(params, pose)
+	})
+}
+
+// QueuedMotions simulates AR3exec.QueuedMotions().
+func (ar3 *AR3simulate) QueuedMotions() []*Motion {
+	return ar3.queue.pending()
+}
+
+// FlushQueue simulates AR3exec.FlushQueue().
+func (ar3 *AR3simulate) FlushQueue() int {
+	return ar3.queue.flush()
+}
+
+// Pause simulates AR3exec.Pause().
+func (ar3 *AR3simulate) Pause() {
+	ar3.queue.pause()
+}
+
+// Resume simulates AR3exec.Resume().
+func (ar3 *AR3simulate) Resume() {
+	ar3.queue.resume()
+}
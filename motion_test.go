@@ -0,0 +1,86 @@
+package ar3
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAR3simulate_MoveAsync(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	first := arm.MoveJointRadiansAsync(DefaultMoveParams, 0.1, 0, 0, 0, 0, 0, 0)
+	last := arm.MoveSteppersAsync(DefaultMoveParams, 100, 100, 100, 100, 100, 100, 0)
+	if err := last.Wait(context.Background()); err != nil {
+		t.Errorf("Queued move should succeed. Got error: %s", err)
+	}
+	select {
+	case <-first.Done():
+	default:
+		t.Errorf("Moves should run in the order they were queued")
+	}
+	sl := AR3Profile.limitSwitchSteps()
+	if pos := arm.CurrentStepperPosition(); pos[0] != 100+sl[0] {
+		t.Errorf("Last queued move should win. Got %v", pos)
+	}
+
+	bad := arm.MoveSteppersAsync(DefaultMoveParams, 100000, 0, 0, 0, 0, 0, 0)
+	<-bad.Done()
+	if bad.Err() == nil {
+		t.Errorf("Queued move out of range should fail")
+	}
+	if len(arm.QueuedMotions()) != 0 {
+		t.Errorf("Queue should be empty. Got %d motions", len(arm.QueuedMotions()))
+	}
+}
+
+func TestAR3exec_FlushQueue(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	mt := NewMemoryTransport(func(command string) []string {
+		if strings.HasPrefix(command, "MJ") {
+			started <- struct{}{}
+			<-release
+		}
+		return EchoResponder(command)
+	})
+	arm, err := ConnectTransport(mt, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+
+	running := arm.MoveJointRadiansAsync(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	queued := arm.MoveJointRadiansAsync(DefaultMoveParams, 0.1, 0, 0, 0, 0, 0, 0)
+	arm.MoveJointRadiansAsync(DefaultMoveParams, 0.2, 0, 0, 0, 0, 0, 0)
+	// Wait for the first move to reach the arm.
+	<-started
+	if running.Err() != nil || len(arm.QueuedMotions()) != 3 {
+		t.Errorf("3 moves should be queued. Got %d", len(arm.QueuedMotions()))
+	}
+
+	if flushed := arm.FlushQueue(); flushed != 2 {
+		t.Errorf("Flush should remove the 2 moves that have not started. Got %d", flushed)
+	}
+	if err := queued.Wait(context.Background()); err != ErrMotionFlushed {
+		t.Errorf("Flushed move should fail with ErrMotionFlushed. Got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := running.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait should give up on a move still running. Got %v", err)
+	}
+	close(release)
+	if err := running.Wait(context.Background()); err != nil {
+		t.Errorf("Running move should be left to finish. Got error: %s", err)
+	}
+	moves := 0
+	for _, command := range mt.Commands() {
+		if strings.HasPrefix(command, "MJ") {
+			moves++
+		}
+	}
+	if moves != 1 {
+		t.Errorf("Only the running move should reach the arm. Got %d moves", moves)
+	}
+}
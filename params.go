@@ -0,0 +1,78 @@
+package ar3
+
+import (
+	"fmt"
+)
+
+// MoveParams are the speed and acceleration settings sent to the AR3 with
+// every move. AccDur and DccDur are the percentage of the move spent
+// accelerating and decelerating, and AccSpd and DccSpd are the speed (as a
+// percentage) during acceleration and deceleration. DCC is named DEC on ARCS.
+type MoveParams struct {
+	Speed  int
+	AccDur int
+	AccSpd int
+	DccDur int
+	DccSpd int
+}
+
+// DefaultMoveParams are the defaults used by ARCS (lines 7941 to 7945).
+var DefaultMoveParams = MoveParams{Speed: 25, AccDur: 15, AccSpd: 10, DccDur: 20, DccSpd: 5}
+
+// SlowMoveParams are for moving carefully, such as near labware.
+var SlowMoveParams = MoveParams{Speed: 10, AccDur: 20, AccSpd: 5, DccDur: 25, DccSpd: 5}
+
+// FastMoveParams are for long moves through free space.
+var FastMoveParams = MoveParams{Speed: 50, AccDur: 10, AccSpd: 20, DccDur: 15, DccSpd: 10}
+
+// CalibrationMoveParams are for moves made while homing the arm. A good
+// speed for calibration is 50 (line 4659 on ARCS).
+var CalibrationMoveParams = MoveParams{Speed: 50, AccDur: 15, AccSpd: 10, DccDur: 20, DccSpd: 5}
+
+// positionalParams builds MoveParams from the positional arguments of the
+// original motion methods.
+func positionalParams(speed, accdur, accspd, dccdur, dccspd int) MoveParams {
+	return MoveParams{Speed: speed, AccDur: accdur, AccSpd: accspd, DccDur: dccdur, DccSpd: dccspd}
+}
+
+// WithSpeed returns a copy of the MoveParams with the given speed.
+func (p MoveParams) WithSpeed(speed int) MoveParams {
+	p.Speed = speed
+	return p
+}
+
+// WithAcceleration returns a copy of the MoveParams with the given
+// acceleration duration and speed.
+func (p MoveParams) WithAcceleration(accdur, accspd int) MoveParams {
+	p.AccDur = accdur
+	p.AccSpd = accspd
+	return p
+}
+
+// WithDeceleration returns a copy of the MoveParams with the given
+// deceleration duration and speed.
+func (p MoveParams) WithDeceleration(dccdur, dccspd int) MoveParams {
+	p.DccDur = dccdur
+	p.DccSpd = dccspd
+	return p
+}
+
+// Validate checks that each value is a percentage the AR3 understands. Speed
+// must be between 1 and 100, the other values between 0 and 100, and the arm
+// cannot spend more than the whole move accelerating and decelerating.
+func (p MoveParams) Validate() error {
+	if p.Speed < 1 || p.Speed > 100 {
+		return fmt.Errorf("speed must be between 1 and 100. Got %d", p.Speed)
+	}
+	values := []int{p.AccDur, p.AccSpd, p.DccDur, p.DccSpd}
+	names := []string{"accdur", "accspd", "dccdur", "dccspd"}
+	for i, value := range values {
+		if value < 0 || value > 100 {
+			return fmt.Errorf("%s must be between 0 and 100. Got %d", names[i], value)
+		}
+	}
+	if p.AccDur+p.DccDur > 100 {
+		return fmt.Errorf("accdur and dccdur must add up to at most 100. Got %d", p.AccDur+p.DccDur)
+	}
+	return nil
+}
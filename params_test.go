@@ -0,0 +1,72 @@
+package ar3
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMoveParams_Validate(t *testing.T) {
+	for _, p := range []MoveParams{DefaultMoveParams, SlowMoveParams, FastMoveParams, CalibrationMoveParams} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("Preset %+v should be valid. Got error: %s", p, err)
+		}
+	}
+	bad := []MoveParams{
+		DefaultMoveParams.WithSpeed(0),
+		DefaultMoveParams.WithSpeed(101),
+		DefaultMoveParams.WithAcceleration(-1, 10),
+		DefaultMoveParams.WithDeceleration(20, 200),
+		DefaultMoveParams.WithAcceleration(60, 10).WithDeceleration(60, 10),
+	}
+	for _, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Errorf("MoveParams %+v should not be valid", p)
+		}
+	}
+}
+
+func TestMoveParams_With(t *testing.T) {
+	p := DefaultMoveParams.WithSpeed(40).WithAcceleration(1, 2).WithDeceleration(3, 4)
+	if p != (MoveParams{Speed: 40, AccDur: 1, AccSpd: 2, DccDur: 3, DccSpd: 4}) {
+		t.Errorf("Helpers should set each field. Got %+v", p)
+	}
+	if DefaultMoveParams.Speed != 25 {
+		t.Errorf("Helpers should not change the preset. Got %+v", DefaultMoveParams)
+	}
+}
+
+func TestAR3exec_MoveSteppersWithParams(t *testing.T) {
+	arm, mt := connectMemory(t)
+	err := arm.MoveSteppersWithParams(DefaultMoveParams, 500, 500, 500, 500, 500, 500, 0)
+	if err != nil {
+		t.Errorf("Arm should succeed with initial move. Got error: %s", err)
+	}
+	commands := mt.Commands()
+	if !strings.HasSuffix(commands[1], "S25G10H15I20K5") {
+		t.Errorf("Move should send the ARCS defaults. Got %s", commands[1])
+	}
+
+	err = arm.MoveSteppersWithParams(DefaultMoveParams.WithSpeed(0), 500, 500, 500, 500, 500, 500, 0)
+	if err == nil {
+		t.Errorf("Move with a speed of 0 should fail")
+	}
+	if len(mt.Commands()) != len(commands) {
+		t.Errorf("Nothing should be sent for invalid MoveParams. Got %v", mt.Commands())
+	}
+}
+
+func TestAR3simulate_MoveWithParams(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	err := arm.MoveJointRadiansWithParams(SlowMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Errorf("Arm should succeed with radian move. Got error: %s", err)
+	}
+	err = arm.MoveWithParams(FastMoveParams, arm.CurrentPose())
+	if err != nil {
+		t.Errorf("Arm should succeed with move. Got error: %s", err)
+	}
+	err = arm.MoveSteppersWithParams(MoveParams{}, 0, 0, 0, 0, 0, 0, 0)
+	if err == nil {
+		t.Errorf("Move with empty MoveParams should fail")
+	}
+}
@@ -0,0 +1,424 @@
+package ar3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Pickle opcodes used by ARbot.cal files.
+const (
+	pickleMark            = '('
+	pickleStop            = '.'
+	pickleInt             = 'I'
+	pickleBinInt          = 'J'
+	pickleBinInt1         = 'K'
+	pickleBinInt2         = 'M'
+	pickleFloat           = 'F'
+	pickleString          = 'S'
+	pickleBinFloat        = 'G'
+	pickleShortBinString  = 'U'
+	pickleBinString       = 'T'
+	pickleUnicode         = 'V'
+	pickleBinUnicode      = 'X'
+	pickleEmptyList       = ']'
+	pickleAppend          = 'a'
+	pickleAppends         = 'e'
+	pickleList            = 'l'
+	pickleEmptyTuple      = ')'
+	pickleTuple           = 't'
+	pickleGet             = 'g'
+	pickleBinGet          = 'h'
+	pickleLongBinGet      = 'j'
+	picklePut             = 'p'
+	pickleBinPut          = 'q'
+	pickleLongBinPut      = 'r'
+	pickleProto           = 0x80
+	pickleTuple1          = 0x85
+	pickleTuple2          = 0x86
+	pickleTuple3          = 0x87
+	pickleShortBinUnicode = 0x8c
+	pickleBinUnicode8     = 0x8d
+	pickleMemoize         = 0x94
+	pickleFrame           = 0x95
+)
+
+// unpickleStrings decodes a pickled list or tuple of strings. Numbers in the
+// sequence are returned formatted as strings, and Python 2 byte strings are
+// decoded as Latin-1. Only the opcodes needed for such a sequence are
+// understood.
+func unpickleStrings(data []byte) ([]string, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var stack []interface{}
+	var marks []int
+	memo := map[int]interface{}{}
+
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	popMark := func() ([]string, error) {
+		if len(marks) == 0 {
+			return nil, errors.New("pickle mark missing")
+		}
+		mark := marks[len(marks)-1]
+		marks = marks[:len(marks)-1]
+		return stringItems(stack[mark:])
+	}
+	top := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		return stack[len(stack)-1], nil
+	}
+	appendTo := func(items []interface{}) error {
+		s, err := stringItems(items)
+		if err != nil {
+			return err
+		}
+		stack = stack[:len(stack)-len(items)]
+		list, err := top()
+		if err != nil {
+			return err
+		}
+		l, ok := list.(*[]string)
+		if !ok {
+			return errors.New("pickle appends to a value that is not a list")
+		}
+		*l = append(*l, s...)
+		return nil
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("pickle truncated: %w", err)
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+	readN := func(n uint64) ([]byte, error) {
+		if n > uint64(len(data)) {
+			return nil, fmt.Errorf("pickle length %d longer than the file", n)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, fmt.Errorf("pickle truncated: %w", err)
+		}
+		return b, nil
+	}
+	readUint := func(size int) (uint64, error) {
+		b, err := readN(uint64(size))
+		if err != nil {
+			return 0, err
+		}
+		var v uint64
+		for i := size - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		return v, nil
+	}
+	put := func(index int) error {
+		v, err := top()
+		if err != nil {
+			return err
+		}
+		memo[index] = v
+		return nil
+	}
+	get := func(index int) error {
+		v, ok := memo[index]
+		if !ok {
+			return fmt.Errorf("pickle memo %d missing", index)
+		}
+		stack = append(stack, v)
+		return nil
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.New("pickle ends without a STOP")
+		}
+		switch op {
+		case pickleProto:
+			if _, err = r.ReadByte(); err != nil {
+				return nil, errors.New("pickle truncated")
+			}
+		case pickleFrame:
+			_, err = readUint(8)
+		case pickleMark:
+			marks = append(marks, len(stack))
+		case pickleStop:
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			switch v := v.(type) {
+			case *[]string:
+				return *v, nil
+			case []string:
+				return v, nil
+			case string:
+				return []string{v}, nil
+			}
+			return nil, errors.New("pickle is not a list or tuple")
+		case pickleInt, pickleFloat:
+			var line string
+			if line, err = readLine(); err == nil {
+				if line == "00" || line == "01" {
+					// Protocol 0 writes booleans as 00 and 01.
+					line = line[1:]
+				}
+				stack = append(stack, line)
+			}
+		case pickleBinInt:
+			var v uint64
+			if v, err = readUint(4); err == nil {
+				stack = append(stack, strconv.Itoa(int(int32(v))))
+			}
+		case pickleBinInt1, pickleBinInt2:
+			size := 1
+			if op == pickleBinInt2 {
+				size = 2
+			}
+			var v uint64
+			if v, err = readUint(size); err == nil {
+				stack = append(stack, strconv.FormatUint(v, 10))
+			}
+		case pickleBinFloat:
+			var b []byte
+			if b, err = readN(8); err == nil {
+				v := math.Float64frombits(binary.BigEndian.Uint64(b))
+				stack = append(stack, strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		case pickleUnicode:
+			var line string
+			if line, err = readLine(); err == nil {
+				line, err = unescapeRawUnicode(line)
+				stack = append(stack, line)
+			}
+		case pickleString:
+			var line string
+			if line, err = readLine(); err == nil {
+				var b []byte
+				if b, err = unquotePythonString(line); err == nil {
+					stack = append(stack, latin1(b))
+				}
+			}
+		case pickleShortBinString, pickleShortBinUnicode, pickleBinString, pickleBinUnicode, pickleBinUnicode8:
+			size := 4
+			switch op {
+			case pickleShortBinString, pickleShortBinUnicode:
+				size = 1
+			case pickleBinUnicode8:
+				size = 8
+			}
+			var n uint64
+			if n, err = readUint(size); err == nil {
+				var b []byte
+				if b, err = readN(n); err == nil {
+					if op == pickleShortBinString || op == pickleBinString {
+						stack = append(stack, latin1(b))
+					} else {
+						stack = append(stack, string(b))
+					}
+				}
+			}
+		case pickleEmptyList:
+			stack = append(stack, &[]string{})
+		case pickleList:
+			var items []string
+			if items, err = popMark(); err == nil {
+				stack = append(stack[:len(stack)-len(items)], &items)
+			}
+		case pickleAppend:
+			if len(stack) == 0 {
+				return nil, errors.New("pickle stack underflow")
+			}
+			err = appendTo(stack[len(stack)-1:])
+		case pickleAppends:
+			if len(marks) == 0 {
+				return nil, errors.New("pickle mark missing")
+			}
+			mark := marks[len(marks)-1]
+			marks = marks[:len(marks)-1]
+			err = appendTo(stack[mark:])
+		case pickleEmptyTuple:
+			stack = append(stack, []string{})
+		case pickleTuple:
+			var items []string
+			if items, err = popMark(); err == nil {
+				stack = append(stack[:len(stack)-len(items)], items)
+			}
+		case pickleTuple1, pickleTuple2, pickleTuple3:
+			n := int(op-pickleTuple1) + 1
+			if len(stack) < n {
+				return nil, errors.New("pickle stack underflow")
+			}
+			var items []string
+			if items, err = stringItems(stack[len(stack)-n:]); err == nil {
+				stack = append(stack[:len(stack)-n], items)
+			}
+		case picklePut, pickleGet:
+			var line string
+			if line, err = readLine(); err == nil {
+				var index int
+				if index, err = strconv.Atoi(line); err == nil {
+					if op == picklePut {
+						err = put(index)
+					} else {
+						err = get(index)
+					}
+				}
+			}
+		case pickleBinPut, pickleLongBinPut, pickleBinGet, pickleLongBinGet:
+			size := 1
+			if op == pickleLongBinPut || op == pickleLongBinGet {
+				size = 4
+			}
+			var index uint64
+			if index, err = readUint(size); err == nil {
+				if op == pickleBinPut || op == pickleLongBinPut {
+					err = put(int(index))
+				} else {
+					err = get(int(index))
+				}
+			}
+		case pickleMemoize:
+			err = put(len(memo))
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%02x", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// stringItems returns the items of a list or tuple, which must all be
+// strings.
+func stringItems(items []interface{}) ([]string, error) {
+	s := make([]string, len(items))
+	for i, item := range items {
+		v, ok := item.(string)
+		if !ok {
+			return nil, errors.New("pickle list or tuple holds a value that is not a string or number")
+		}
+		s[i] = v
+	}
+	return s, nil
+}
+
+// unescapeRawUnicode decodes the \uXXXX and \UXXXXXXXX escapes Python's
+// raw-unicode-escape codec uses for backslashes and newlines in protocol 0
+// strings.
+func unescapeRawUnicode(s string) (string, error) {
+	if !strings.Contains(s, `\u`) && !strings.Contains(s, `\U`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		size := 0
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'u':
+				size = 4
+			case 'U':
+				size = 8
+			}
+		}
+		if size == 0 || i+2+size > len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		r, err := strconv.ParseUint(s[i+2:i+2+size], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("pickle string has a bad escape %q", s[i:i+2+size])
+		}
+		b.WriteRune(rune(r))
+		i += 1 + size
+	}
+	return b.String(), nil
+}
+
+// latin1 decodes a Python 2 str, which is pickled as its bytes, the way
+// Python 3 unpickles it with encoding="latin1".
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// unquotePythonString decodes the quoted repr of a Python 2 str, which is how
+// protocol 0 pickles it, returning its bytes.
+func unquotePythonString(s string) ([]byte, error) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return nil, fmt.Errorf("pickle string %q is not quoted", s)
+	}
+	s = s[1 : len(s)-1]
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return nil, fmt.Errorf("pickle string %q ends with a backslash", s)
+		}
+		i++
+		switch c := s[i]; c {
+		case '\\', '\'', '"':
+			b = append(b, c)
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("pickle string has a bad escape %q", s[i-1:])
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("pickle string has a bad escape %q", s[i-1:i+3])
+			}
+			b = append(b, byte(v))
+			i += 2
+		default:
+			if c < '0' || c > '7' {
+				// Python keeps the backslash of an unknown escape.
+				b = append(b, '\\', c)
+				continue
+			}
+			// Up to three octal digits.
+			end := i + 1
+			for end < len(s) && end < i+3 && s[end] >= '0' && s[end] <= '7' {
+				end++
+			}
+			v, _ := strconv.ParseUint(s[i:end], 8, 16)
+			b = append(b, byte(v))
+			i = end - 1
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,309 @@
+package ar3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/trilobio/kinematics"
+	"gopkg.in/yaml.v3"
+)
+
+// RobotProfile describes the gearing, limits and geometry of a particular
+// arm. Every conversion between steps and joint angles, and every limit check,
+// uses the profile the arm was connected with, so one process can drive arms
+// with different hardware.
+//
+// Profiles can be written as JSON or YAML using the field names in the json
+// tags, and loaded with LoadProfile.
+type RobotProfile struct {
+	Name string `json:"name"`
+	// StepLimits are the number of steps between the limit switch and the
+	// far end of travel for each joint.
+	StepLimits [6]int `json:"stepLimits"`
+	// RadPerStep are the radians each joint turns per step of its stepper
+	// motor, calculated from the motors and gearing.
+	RadPerStep [6]float64 `json:"radPerStep"`
+	// CalibDirs are true for joints that travel in the positive step
+	// direction away from their limit switch, and false for joints that
+	// travel in the negative direction.
+	CalibDirs [6]bool `json:"calibDirs"`
+	// LimitSwitchDegrees are the angles, in degrees, from each joint's
+	// limit switch to its zero angle. A joint resting on its limit switch
+	// is at the negative of its LimitSwitchDegrees: AR3Profile's J1 switch
+	// is at 170 degrees, so its LimitSwitchDegrees is -170.
+	LimitSwitchDegrees [6]float64 `json:"limitSwitchDegrees"`
+	// DhParameters are the Denavit-Hartenberg parameters of the arm.
+	DhParameters kinematics.DhParameters `json:"dhParameters"`
+
+	// TrackMmPerStep is the distance the arm travels along its linear track
+	// per step of the track's stepper motor. An arm without a track has a
+	// TrackMmPerStep of 0.
+	TrackMmPerStep float64 `json:"trackMmPerStep,omitempty"`
+	// TrackStepLimit is the number of steps between the track's limit
+	// switch and the far end of travel.
+	TrackStepLimit int `json:"trackStepLimit,omitempty"`
+	// TrackCalibDir is true if the track travels in the positive step
+	// direction away from its limit switch, like CalibDirs.
+	TrackCalibDir bool `json:"trackCalibDir,omitempty"`
+	// TrackAxis is the direction, in the arm's base frame, that the arm
+	// moves as the track position increases. It does not need to be
+	// normalized.
+	TrackAxis [3]float64 `json:"trackAxis,omitempty"`
+}
+
+// AR3Profile is the AR3 robotic arm. The step limits are hard-coded in the
+// ARbot.cal file for the stepper motors.
+var AR3Profile = RobotProfile{
+	Name:       "AR3",
+	StepLimits: [6]int{15200, 14600, 7850, 15200, 4575, 14936},
+	RadPerStep: [6]float64{
+		0.0225 * degreesToRadians,
+		0.009 * degreesToRadians,
+		0.018 * degreesToRadians,
+		0.01092214664 * degreesToRadians,
+		0.04723477289 * degreesToRadians,
+		0.02343358396 * degreesToRadians,
+	},
+	CalibDirs:          [6]bool{false, true, false, false, true, true},
+	LimitSwitchDegrees: [6]float64{-170, 42.5, -60, -85, 90, 170},
+	DhParameters:       copyDhParameters(AR3DhParameters),
+}
+
+// AR2Profile is the AR2 robotic arm, which shares its geometry with the AR3
+// but not its gearing. The step limits and angles are the defaults from the
+// AR2 version of ARCS.
+var AR2Profile = RobotProfile{
+	Name:       "AR2",
+	StepLimits: [6]int{15110, 7198, 7984, 14056, 4560, 6320},
+	RadPerStep: [6]float64{
+		340.0 / 15110 * degreesToRadians,
+		129.6 / 7198 * degreesToRadians,
+		142.7 / 7984 * degreesToRadians,
+		329.0 / 14056 * degreesToRadians,
+		208.3 / 4560 * degreesToRadians,
+		296.2 / 6320 * degreesToRadians,
+	},
+	CalibDirs:          [6]bool{false, true, false, false, true, true},
+	LimitSwitchDegrees: [6]float64{-170, 0, 1, -164.5, 104.15, 148.1},
+	DhParameters:       copyDhParameters(AR3DhParameters),
+}
+
+// copyDhParameters returns a copy of dh that shares no slices with it, so
+// profiles built from the same parameters can be edited independently.
+func copyDhParameters(dh kinematics.DhParameters) kinematics.DhParameters {
+	return kinematics.DhParameters{
+		ThetaOffsets: append([]float64(nil), dh.ThetaOffsets...),
+		AlphaValues:  append([]float64(nil), dh.AlphaValues...),
+		AValues:      append([]float64(nil), dh.AValues...),
+		DValues:      append([]float64(nil), dh.DValues...),
+	}
+}
+
+// WithTrack returns a copy of the profile for an arm mounted on a linear track
+// with the given millimeters per step, number of steps of travel and direction
+// of travel in the arm's base frame. The track travels in the positive
+// direction away from its limit switch.
+func (p RobotProfile) WithTrack(mmPerStep float64, stepLimit int, axis [3]float64) RobotProfile {
+	p.TrackMmPerStep = mmPerStep
+	p.TrackStepLimit = stepLimit
+	p.TrackCalibDir = true
+	p.TrackAxis = axis
+	return p
+}
+
+// HasTrack returns true if the profile describes an arm on a linear track.
+func (p RobotProfile) HasTrack() bool {
+	return p.TrackMmPerStep != 0
+}
+
+// BuiltinProfile returns a copy of the built-in profile with the given name
+// ("AR2" or "AR3", case insensitive).
+func BuiltinProfile(name string) (RobotProfile, bool) {
+	var p RobotProfile
+	switch strings.ToUpper(name) {
+	case "AR2":
+		p = AR2Profile
+	case "AR3":
+		p = AR3Profile
+	default:
+		return RobotProfile{}, false
+	}
+	p.DhParameters = copyDhParameters(p.DhParameters)
+	return p, true
+}
+
+// LoadProfile reads a profile from a JSON (.json) or YAML (.yaml or .yml)
+// file.
+func LoadProfile(path string) (RobotProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RobotProfile{}, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseProfileJSON(data)
+	case ".yaml", ".yml":
+		return ParseProfileYAML(data)
+	}
+	return RobotProfile{}, fmt.Errorf("unknown profile format %q", filepath.Ext(path))
+}
+
+// ParseProfileJSON parses and validates a JSON profile.
+func ParseProfileJSON(data []byte) (RobotProfile, error) {
+	var p RobotProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("error parsing profile: %w", err)
+	}
+	return p, p.Validate()
+}
+
+// ParseProfileYAML parses and validates a YAML profile. The YAML uses the same
+// field names as JSON.
+func ParseProfileYAML(data []byte) (RobotProfile, error) {
+	// Going through JSON keeps the json tags as the only field names.
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return RobotProfile{}, fmt.Errorf("error parsing profile: %w", err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return RobotProfile{}, fmt.Errorf("error parsing profile: %w", err)
+	}
+	return ParseProfileJSON(data)
+}
+
+// Validate checks that the profile describes a 6 axis arm that can be moved.
+func (p RobotProfile) Validate() error {
+	for i := 0; i < 6; i++ {
+		if p.StepLimits[i] <= 0 {
+			return fmt.Errorf("J%d step limit must be positive. Got %d", i+1, p.StepLimits[i])
+		}
+		if p.RadPerStep[i] <= 0 || math.IsNaN(p.RadPerStep[i]) || math.IsInf(p.RadPerStep[i], 0) {
+			return fmt.Errorf("J%d radians per step must be positive. Got %g", i+1, p.RadPerStep[i])
+		}
+	}
+	dh := p.DhParameters
+	if len(dh.ThetaOffsets) != 6 || len(dh.AlphaValues) != 6 || len(dh.AValues) != 6 || len(dh.DValues) != 6 {
+		return errors.New("DH parameters must have 6 values each")
+	}
+	if p.HasTrack() {
+		if p.TrackMmPerStep < 0 || math.IsNaN(p.TrackMmPerStep) || math.IsInf(p.TrackMmPerStep, 0) {
+			return fmt.Errorf("track millimeters per step must be positive. Got %g", p.TrackMmPerStep)
+		}
+		if p.TrackStepLimit <= 0 {
+			return fmt.Errorf("track step limit must be positive. Got %d", p.TrackStepLimit)
+		}
+		if p.TrackAxis == [3]float64{} {
+			return errors.New("track axis must not be zero")
+		}
+	}
+	return nil
+}
+
+// stepsToAngles converts number of steps into angles using the steps to angle
+// conversion for each joint. The track is converted to millimeters.
+func (p RobotProfile) stepsToAngles(steps [7]int, deg bool) [7]float64 {
+	var conv float64
+	if deg {
+		conv = degreesToRadians
+	} else {
+		conv = 1
+	}
+	var jointAngles [7]float64
+	for i := 0; i < 6; i++ {
+		jointAngles[i] = p.RadPerStep[i] * float64(steps[i]) / conv
+	}
+	jointAngles[6] = p.TrackMmPerStep * float64(steps[6])
+	return jointAngles
+}
+
+// anglesToSteps converts joint angles to number of stepper steps. The track
+// is converted from millimeters, and is always 0 steps without a track.
+func (p RobotProfile) anglesToSteps(angles [7]float64, deg bool) [7]int {
+	var conv float64
+	if deg {
+		conv = degreesToRadians
+	} else {
+		conv = 1
+	}
+	var jointSteps [7]int
+	for i := 0; i < 6; i++ {
+		jointSteps[i] = int(math.Round(conv * angles[i] / p.RadPerStep[i]))
+	}
+	if p.HasTrack() {
+		jointSteps[6] = int(math.Round(angles[6] / p.TrackMmPerStep))
+	}
+	return jointSteps
+}
+
+// jointsToSteps converts joint angles in radians, and the track position in
+// millimeters, to stepper steps.
+func (p RobotProfile) jointsToSteps(joints [7]float64) ([7]int, error) {
+	if joints[6] != 0 && !p.HasTrack() {
+		return [7]int{}, fmt.Errorf("profile %s has no track. Got track position %g mm", p.Name, joints[6])
+	}
+	return p.anglesToSteps(joints, false), nil
+}
+
+// limitSwitchSteps returns the number of steps each joint's limit switch is
+// offset from its zero angle. The track is zeroed at its limit switch.
+func (p RobotProfile) limitSwitchSteps() [7]int {
+	var angles [7]float64
+	copy(angles[:6], p.LimitSwitchDegrees[:])
+	return p.anglesToSteps(angles, true)
+}
+
+// withLimitSwitchSteps returns a copy of the profile with LimitSwitchDegrees
+// set so that each joint's limit switch is offset from its zero angle by
+// steps. The track is always zeroed at its limit switch, and each offset
+// must be within the joint's travel.
+func (p RobotProfile) withLimitSwitchSteps(steps [7]int) (RobotProfile, error) {
+	if steps[6] != 0 {
+		return p, fmt.Errorf("track is zeroed at its limit switch. Got offset of %d steps", steps[6])
+	}
+	for i := 0; i < 6; i++ {
+		if lower, upper := p.stepRange(i); steps[i] < lower || steps[i] > upper {
+			return p, fmt.Errorf("%s limit switch offset of %d steps is outside its travel of %d to %d steps", jointName(i), steps[i], lower, upper)
+		}
+		p.LimitSwitchDegrees[i] = float64(steps[i]) * p.RadPerStep[i] / degreesToRadians
+	}
+	return p, nil
+}
+
+// stepRange returns the lowest and highest step position of each axis, with
+// the track as the seventh axis.
+func (p RobotProfile) stepRange(axis int) (lowerLimit, upperLimit int) {
+	limit, calibDir := p.TrackStepLimit, p.TrackCalibDir
+	if axis < 6 {
+		limit, calibDir = p.StepLimits[axis], p.CalibDirs[axis]
+	}
+	if !calibDir {
+		return -limit, 0
+	}
+	return 0, limit
+}
+
+// checkStepLimits checks that moving each axis by relative steps from its
+// current position keeps it within its step limit, returning the new step
+// positions.
+func (p RobotProfile) checkStepLimits(from [7]int, relative [7]int) ([7]int, error) {
+	motor := []string{"J1", "J2", "J3", "J4", "J5", "J6", "Track"}
+	var newPositions [7]int
+	for i := 0; i < 7; i++ {
+		newJ := relative[i] + from[i]
+		lowerLimit, upperLimit := p.stepRange(i)
+		if newJ < lowerLimit || newJ > upperLimit {
+			if i == 6 && !p.HasTrack() {
+				return newPositions, fmt.Errorf("profile %s has no track. Got %d track steps", p.Name, newJ)
+			}
+			return newPositions, fmt.Errorf("%s out of range. Must be between %d and %d. Got %d", motor[i], lowerLimit, upperLimit, newJ)
+		}
+		newPositions[i] = newJ
+	}
+	return newPositions, nil
+}
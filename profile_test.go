@@ -0,0 +1,124 @@
+package ar3
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinProfile(t *testing.T) {
+	for _, name := range []string{"AR2", "ar3"} {
+		p, ok := BuiltinProfile(name)
+		if !ok {
+			t.Errorf("%s should be a built-in profile", name)
+		}
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s should be valid. Got error: %s", name, err)
+		}
+	}
+	if _, ok := BuiltinProfile("AR4"); ok {
+		t.Errorf("AR4 should not be a built-in profile")
+	}
+}
+
+func TestRobotProfile_Validate(t *testing.T) {
+	p := AR3Profile
+	p.RadPerStep[4] = 0
+	if err := p.Validate(); err == nil {
+		t.Errorf("Profile with a zero J5 radians per step should not be valid")
+	}
+	p = AR3Profile
+	p.RadPerStep[0] = math.NaN()
+	if err := p.Validate(); err == nil {
+		t.Errorf("Profile with a NaN J1 radians per step should not be valid")
+	}
+	p = AR3Profile.WithTrack(math.NaN(), 1000, [3]float64{1, 0, 0})
+	if err := p.Validate(); err == nil {
+		t.Errorf("Profile with a NaN track millimeters per step should not be valid")
+	}
+	p = AR3Profile
+	p.DhParameters.DValues = p.DhParameters.DValues[:5]
+	if err := p.Validate(); err == nil {
+		t.Errorf("Profile with 5 DH D values should not be valid")
+	}
+}
+
+func TestBuiltinProfile_SharesNoDhParameters(t *testing.T) {
+	ar2, _ := BuiltinProfile("AR2")
+	ar2.DhParameters.DValues[0] = 0
+	if AR2Profile.DhParameters.DValues[0] == 0 || AR3Profile.DhParameters.DValues[0] == 0 {
+		t.Errorf("Editing a built-in profile's DH parameters should not change AR2Profile or AR3Profile")
+	}
+	if &AR2Profile.DhParameters.DValues[0] == &AR3Profile.DhParameters.DValues[0] || &AR3Profile.DhParameters.AValues[0] == &AR3DhParameters.AValues[0] {
+		t.Errorf("AR2Profile, AR3Profile and AR3DhParameters should not share DH parameters")
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	data, err := json.Marshal(AR2Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonPath := filepath.Join(dir, "ar2.json")
+	if err = os.WriteFile(jsonPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadProfile(jsonPath)
+	if err != nil {
+		t.Errorf("Failed to load JSON profile. Got error: %s", err)
+	}
+	if p.Name != "AR2" || p.StepLimits != AR2Profile.StepLimits || p.RadPerStep != AR2Profile.RadPerStep {
+		t.Errorf("JSON profile should match AR2Profile. Got %+v", p)
+	}
+
+	yamlPath := filepath.Join(dir, "swapped.yaml")
+	yamlProfile := `name: AR3 with a swapped J5 gearbox
+stepLimits: [15200, 14600, 7850, 15200, 9150, 14936]
+radPerStep: [0.000392699, 0.000157080, 0.000314159, 0.000190628, 0.000412191, 0.000408991]
+calibDirs: [false, true, false, false, true, true]
+limitSwitchDegrees: [-170, 42.5, -60, -85, 90, 170]
+dhParameters:
+  thetaOffsets: [0, -1.5707963267948966, 0, 0, 0, 3.141592653589793]
+  alphaValues: [-1.5707963267948966, 0, 1.5707963267948966, -1.5707963267948966, 1.5707963267948966, 0]
+  aValues: [64.2, 305, 0, 0, 0, 0]
+  dValues: [169.77, 0, 0, -222.63, 0, -36.25]
+`
+	if err = os.WriteFile(yamlPath, []byte(yamlProfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err = LoadProfile(yamlPath)
+	if err != nil {
+		t.Errorf("Failed to load YAML profile. Got error: %s", err)
+	}
+	if p.StepLimits[4] != 9150 || p.DhParameters.DValues[3] != -222.63 {
+		t.Errorf("YAML profile was not read correctly. Got %+v", p)
+	}
+
+	if _, err = LoadProfile(filepath.Join(dir, "ar3.txt")); err == nil {
+		t.Errorf("Loading a profile with an unknown extension should fail")
+	}
+}
+
+func TestRobotProfile_LimitSwitchSteps(t *testing.T) {
+	// These are the offsets AR3exec used before profiles were configurable.
+	expected := [7]int{-7556, 4722, -3333, -7782, 1905, 7255, 0}
+	if sl := AR3Profile.limitSwitchSteps(); sl != expected {
+		t.Errorf("AR3 limit switch steps should be %v. Got %v", expected, sl)
+	}
+}
+
+func TestAR3simulate_Profile(t *testing.T) {
+	arm := connectCalibrated(AR2Profile)
+	if arm.Profile().Name != "AR2" {
+		t.Errorf("Arm should use the AR2 profile. Got %s", arm.Profile().Name)
+	}
+	// The AR2's J2 travels less than half as many steps as the AR3's.
+	sl := AR2Profile.limitSwitchSteps()
+	err := arm.MoveSteppers(25, 15, 10, 20, 5, 0, 10000-sl[1], 0, 0, 0, 0, 0)
+	if err == nil {
+		t.Errorf("AR2 J2 should not reach 10000 steps")
+	}
+}
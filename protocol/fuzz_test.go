@@ -0,0 +1,65 @@
+//go:build go1.18
+// +build go1.18
+
+package protocol
+
+import (
+	"testing"
+)
+
+// FuzzDecode checks that anything Decode accepts survives a round trip
+// through Encode.
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte("TMTest\n"))
+	f.Add([]byte("MJA0500B1200C00D00E00F00T00S25G10H15I20K5\n"))
+	f.Add([]byte("LLA015200B114600C07850D015200E14575F114936T00S25\n"))
+	f.Add([]byte("RP\n"))
+	f.Add([]byte("ST\n"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c, err := Decode(b)
+		if err != nil {
+			return
+		}
+		again, err := Decode(c.Encode())
+		if err != nil {
+			t.Fatalf("Failed to decode re-encoded %q. Got error: %s", c.Encode(), err)
+		}
+		if again != c {
+			t.Fatalf("Round trip of %+v gave %+v", c, again)
+		}
+	})
+}
+
+// FuzzMoveCommand checks that every move command encodes to something
+// DecodeMove reads back unchanged.
+func FuzzMoveCommand(f *testing.F) {
+	f.Add(500, 200, false, true, 25, 15, 10, 20, 5)
+	f.Fuzz(func(t *testing.T, j1, j6 int, r1, r6 bool, speed, accdur, accspd, dccdur, dccspd int) {
+		c := MoveCommand{Speed: speed, AccDur: accdur, AccSpd: accspd, DccDur: dccdur, DccSpd: dccspd}
+		c.Axes[0] = Axis{Reverse: r1, Steps: j1}
+		c.Axes[5] = Axis{Reverse: r6, Steps: j6}
+		decoded, err := DecodeMove(c.Encode())
+		if err != nil {
+			t.Fatalf("Failed to decode %q. Got error: %s", c.Encode(), err)
+		}
+		if decoded != c {
+			t.Fatalf("Round trip of %+v gave %+v", c, decoded)
+		}
+	})
+}
+
+// FuzzDecodePositionResponse checks that anything DecodePositionResponse
+// accepts survives a round trip through Encode.
+func FuzzDecodePositionResponse(f *testing.F) {
+	f.Add([]byte("A-7556B4722C-3333D0E1905F7255\n"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r, err := DecodePositionResponse(b)
+		if err != nil {
+			return
+		}
+		again, err := DecodePositionResponse(r.Encode())
+		if err != nil || again != r {
+			t.Fatalf("Round trip of %+v gave %+v with error: %v", r, again, err)
+		}
+	})
+}
@@ -0,0 +1,371 @@
+/*
+Package protocol encodes and decodes the serial commands understood by the
+arduino sketch running on the AR3 (and AR2) robotic arm.
+
+Commands are single lines of ASCII, starting with a two letter function code:
+
+ TM  echo:      TM<text>
+ MJ  move:      MJA<dir><steps>B...F<dir><steps>T<dir><steps>S<speed>G<accspd>H<accdur>I<dccdur>K<dccspd>
+ LL  calibrate: LLA<dir><steps>B...F<dir><steps>T<dir><steps>S<speed>
+ RP  request encoder positions, answered with A<steps>B<steps>...F<steps>
+ ST  stop:      ST
+
+Each axis (A through F for J1 through J6, T for the track) is a one digit
+direction bit followed by a step count. The field order was derived from line
+4493 in the ARCS source file under the variable "commandCalc".
+
+Decode is strict about field order, so it can be used to validate, log and
+replay commands that were sent to an arm.
+*/
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Function codes of the commands in this package.
+const (
+	EchoCode            = "TM"
+	MoveCode            = "MJ"
+	CalibrateCode       = "LL"
+	RequestPositionCode = "RP"
+	StopCode            = "ST"
+)
+
+// axisLetters are the characters that prefix each axis in move and calibrate
+// commands, in order from J1 to the track.
+var axisLetters = [7]byte{'A', 'B', 'C', 'D', 'E', 'F', 'T'}
+
+// ErrUnknownCommand is returned by Decode for commands without a known
+// function code.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Command is a single command that can be sent to the AR3.
+type Command interface {
+	// Encode returns the newline terminated bytes sent over serial.
+	Encode() []byte
+}
+
+// Axis is the direction and number of steps for a single stepper motor.
+type Axis struct {
+	// Reverse sets the direction bit to 1.
+	Reverse bool
+	Steps   int
+}
+
+// encode appends the direction bit and steps of the axis.
+func (a Axis) encode(sb *strings.Builder, letter byte) {
+	dir := 0
+	if a.Reverse {
+		dir = 1
+	}
+	fmt.Fprintf(sb, "%c%d%d", letter, dir, a.Steps)
+}
+
+// validate checks that the step count can be read by the arduino.
+func (a Axis) validate(letter byte) error {
+	if a.Steps < 0 {
+		return fmt.Errorf("axis %c has negative steps %d", letter, a.Steps)
+	}
+	return nil
+}
+
+// EchoCommand asks the arm to echo back Text. It is used to check
+// connectivity, and as a barrier: the echo is only answered once every
+// previous command is complete.
+type EchoCommand struct {
+	Text string
+}
+
+// Encode encodes the echo command.
+func (c EchoCommand) Encode() []byte {
+	return []byte(EchoCode + c.Text + "\n")
+}
+
+// Validate checks that the echo text fits on a single line.
+func (c EchoCommand) Validate() error {
+	if strings.ContainsAny(c.Text, "\r\n") {
+		return fmt.Errorf("echo text %q contains a line ending", c.Text)
+	}
+	return nil
+}
+
+// MoveCommand moves each stepper motor a relative number of steps. AccDur,
+// AccSpd, DccDur and DccSpd define the acceleration and deceleration
+// duration and speed (DCC is named DEC on ARCS).
+type MoveCommand struct {
+	Axes   [7]Axis
+	Speed  int
+	AccDur int
+	AccSpd int
+	DccDur int
+	DccSpd int
+}
+
+// Encode encodes the move command.
+func (c MoveCommand) Encode() []byte {
+	var sb strings.Builder
+	sb.WriteString(MoveCode)
+	for i, axis := range c.Axes {
+		axis.encode(&sb, axisLetters[i])
+	}
+	fmt.Fprintf(&sb, "S%dG%dH%dI%dK%d\n", c.Speed, c.AccSpd, c.AccDur, c.DccDur, c.DccSpd)
+	return []byte(sb.String())
+}
+
+// Validate checks that every axis and speed field can be read by the arduino.
+func (c MoveCommand) Validate() error {
+	for i, axis := range c.Axes {
+		if err := axis.validate(axisLetters[i]); err != nil {
+			return err
+		}
+	}
+	speeds := []int{c.Speed, c.AccDur, c.AccSpd, c.DccDur, c.DccSpd}
+	names := []string{"speed", "accdur", "accspd", "dccdur", "dccspd"}
+	for i, speed := range speeds {
+		if speed < 0 {
+			return fmt.Errorf("%s must not be negative. Got %d", names[i], speed)
+		}
+	}
+	return nil
+}
+
+// Responses of the arm to a CalibrateCommand: pass once every homed axis has
+// reached its limit switch, and fail for a command it cannot parse.
+const (
+	CalibratePass = "pass"
+	CalibrateFail = "fail"
+)
+
+// CalibrateCommand drives each axis with a non-zero step count towards its
+// limit switch.
+type CalibrateCommand struct {
+	Axes  [7]Axis
+	Speed int
+}
+
+// Encode encodes the calibrate command.
+func (c CalibrateCommand) Encode() []byte {
+	var sb strings.Builder
+	sb.WriteString(CalibrateCode)
+	for i, axis := range c.Axes {
+		axis.encode(&sb, axisLetters[i])
+	}
+	fmt.Fprintf(&sb, "S%d\n", c.Speed)
+	return []byte(sb.String())
+}
+
+// Validate checks that every axis and the speed can be read by the arduino.
+func (c CalibrateCommand) Validate() error {
+	for i, axis := range c.Axes {
+		if err := axis.validate(axisLetters[i]); err != nil {
+			return err
+		}
+	}
+	if c.Speed < 0 {
+		return fmt.Errorf("speed must not be negative. Got %d", c.Speed)
+	}
+	return nil
+}
+
+// RequestPositionCommand asks the arm for the position of each joint as read
+// by its encoder. The arm answers with a PositionResponse.
+type RequestPositionCommand struct{}
+
+// Encode encodes the request position command.
+func (c RequestPositionCommand) Encode() []byte {
+	return []byte(RequestPositionCode + "\n")
+}
+
+// StopCommand stops every stepper motor where it is, abandoning the move in
+// progress without decelerating. ar3.AR3exec.Stop sends it alongside the
+// command in progress and does not wait for an answer, so the arm may answer
+// it with StopResponse at any time, or not at all.
+type StopCommand struct{}
+
+// StopResponse is the arm's answer to a StopCommand. It can arrive after the
+// next command is sent, so ar3.AR3exec skips it wherever it reads a response.
+const StopResponse = "Stopped"
+
+// Encode encodes the stop command.
+func (c StopCommand) Encode() []byte {
+	return []byte(StopCode + "\n")
+}
+
+// PositionResponse is the arm's answer to a RequestPositionCommand: the
+// encoder position of J1 through J6, converted to steps by the arduino.
+type PositionResponse struct {
+	Steps [6]int
+}
+
+// Encode encodes the position response.
+func (r PositionResponse) Encode() []byte {
+	var sb strings.Builder
+	for i, steps := range r.Steps {
+		fmt.Fprintf(&sb, "%c%d", axisLetters[i], steps)
+	}
+	sb.WriteString("\n")
+	return []byte(sb.String())
+}
+
+// DecodePositionResponse decodes the arm's answer to a
+// RequestPositionCommand.
+func DecodePositionResponse(b []byte) (PositionResponse, error) {
+	var r PositionResponse
+	d, err := newDecoder(b, "")
+	if err != nil {
+		return r, err
+	}
+	for i := range r.Steps {
+		if r.Steps[i], err = d.int(axisLetters[i]); err != nil {
+			return r, err
+		}
+	}
+	return r, d.end()
+}
+
+// Decode decodes a single command. A trailing line ending is optional.
+func Decode(b []byte) (Command, error) {
+	line := strings.TrimRight(string(b), "\r\n")
+	if len(line) < 2 {
+		return nil, ErrUnknownCommand
+	}
+	switch line[:2] {
+	case EchoCode:
+		return DecodeEcho(b)
+	case MoveCode:
+		return DecodeMove(b)
+	case CalibrateCode:
+		return DecodeCalibrate(b)
+	case RequestPositionCode:
+		if line != RequestPositionCode {
+			return nil, fmt.Errorf("unexpected trailing %q", line[2:])
+		}
+		return RequestPositionCommand{}, nil
+	case StopCode:
+		if line != StopCode {
+			return nil, fmt.Errorf("unexpected trailing %q", line[2:])
+		}
+		return StopCommand{}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCommand, line[:2])
+}
+
+// DecodeEcho decodes an echo command.
+func DecodeEcho(b []byte) (EchoCommand, error) {
+	line := strings.TrimRight(string(b), "\r\n")
+	if !strings.HasPrefix(line, EchoCode) {
+		return EchoCommand{}, fmt.Errorf("echo command must start with %s", EchoCode)
+	}
+	c := EchoCommand{Text: line[len(EchoCode):]}
+	return c, c.Validate()
+}
+
+// DecodeMove decodes a move command.
+func DecodeMove(b []byte) (MoveCommand, error) {
+	var c MoveCommand
+	d, err := newDecoder(b, MoveCode)
+	if err != nil {
+		return c, err
+	}
+	for i := range c.Axes {
+		if c.Axes[i], err = d.axis(axisLetters[i]); err != nil {
+			return c, err
+		}
+	}
+	fields := []*int{&c.Speed, &c.AccSpd, &c.AccDur, &c.DccDur, &c.DccSpd}
+	for i, letter := range []byte{'S', 'G', 'H', 'I', 'K'} {
+		if *fields[i], err = d.int(letter); err != nil {
+			return c, err
+		}
+	}
+	return c, d.end()
+}
+
+// DecodeCalibrate decodes a calibrate command.
+func DecodeCalibrate(b []byte) (CalibrateCommand, error) {
+	var c CalibrateCommand
+	d, err := newDecoder(b, CalibrateCode)
+	if err != nil {
+		return c, err
+	}
+	for i := range c.Axes {
+		if c.Axes[i], err = d.axis(axisLetters[i]); err != nil {
+			return c, err
+		}
+	}
+	if c.Speed, err = d.int('S'); err != nil {
+		return c, err
+	}
+	return c, d.end()
+}
+
+// decoder reads lettered fields off a command in order.
+type decoder struct {
+	line string
+	pos  int
+}
+
+// newDecoder starts decoding a command, checking its function code.
+func newDecoder(b []byte, code string) (*decoder, error) {
+	line := strings.TrimRight(string(b), "\r\n")
+	if !strings.HasPrefix(line, code) {
+		return nil, fmt.Errorf("command must start with %s", code)
+	}
+	return &decoder{line: line, pos: len(code)}, nil
+}
+
+// field returns the text between letter and the next letter (or the end of
+// the line), which must be the next field.
+func (d *decoder) field(letter byte) (string, error) {
+	if d.pos >= len(d.line) || d.line[d.pos] != letter {
+		return "", fmt.Errorf("expected field %c at position %d of %q", letter, d.pos, d.line)
+	}
+	start := d.pos + 1
+	end := start
+	for end < len(d.line) && !(d.line[end] >= 'A' && d.line[end] <= 'Z') {
+		end++
+	}
+	d.pos = end
+	return d.line[start:end], nil
+}
+
+// axis reads a direction bit and step count.
+func (d *decoder) axis(letter byte) (Axis, error) {
+	f, err := d.field(letter)
+	if err != nil {
+		return Axis{}, err
+	}
+	if len(f) < 2 || (f[0] != '0' && f[0] != '1') {
+		return Axis{}, fmt.Errorf("axis %c must be a direction bit followed by steps. Got %q", letter, f)
+	}
+	steps, err := strconv.Atoi(f[1:])
+	if err != nil {
+		return Axis{}, fmt.Errorf("axis %c has bad steps: %w", letter, err)
+	}
+	return Axis{Reverse: f[0] == '1', Steps: steps}, nil
+}
+
+// int reads a plain integer field.
+func (d *decoder) int(letter byte) (int, error) {
+	f, err := d.field(letter)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(f)
+	if err != nil {
+		return 0, fmt.Errorf("field %c is not an integer: %w", letter, err)
+	}
+	return v, nil
+}
+
+// end checks that the whole command has been read.
+func (d *decoder) end() error {
+	if d.pos != len(d.line) {
+		return fmt.Errorf("unexpected trailing %q", d.line[d.pos:])
+	}
+	return nil
+}
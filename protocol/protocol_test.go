@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestMoveCommand_Encode(t *testing.T) {
+	c := MoveCommand{
+		Axes:  [7]Axis{{Steps: 500}, {Reverse: true, Steps: 200}, {}, {}, {}, {}, {}},
+		Speed: 25, AccDur: 15, AccSpd: 10, DccDur: 20, DccSpd: 5,
+	}
+	// The speed fields are ordered S, G, H, I, K as speed, accspd, accdur,
+	// dccdur and dccspd. Changing that order changes how the arm moves.
+	expected := "MJA0500B1200C00D00E00F00T00S25G10H15I20K5\n"
+	if string(c.Encode()) != expected {
+		t.Errorf("Expected %q. Got %q", expected, c.Encode())
+	}
+}
+
+func TestCalibrateCommand_Encode(t *testing.T) {
+	c := CalibrateCommand{Axes: [7]Axis{{Steps: 15200}, {Reverse: true, Steps: 14600}}, Speed: 25}
+	expected := "LLA015200B114600C00D00E00F00T00S25\n"
+	if string(c.Encode()) != expected {
+		t.Errorf("Expected %q. Got %q", expected, c.Encode())
+	}
+}
+
+func TestEchoCommand_Encode(t *testing.T) {
+	c := EchoCommand{Text: "Test"}
+	if string(c.Encode()) != "TMTest\n" {
+		t.Errorf("Expected %q. Got %q", "TMTest\n", c.Encode())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	commands := []Command{
+		EchoCommand{Text: "Test"},
+		EchoCommand{},
+		MoveCommand{
+			Axes:  [7]Axis{{Steps: 1}, {Reverse: true, Steps: 2}, {Steps: 3}, {Reverse: true, Steps: 4}, {Steps: 5}, {Steps: 6}, {Reverse: true, Steps: 7}},
+			Speed: 25, AccDur: 15, AccSpd: 10, DccDur: 20, DccSpd: 5,
+		},
+		MoveCommand{},
+		CalibrateCommand{Axes: [7]Axis{{Steps: 15200}, {}, {Reverse: true, Steps: 7850}}, Speed: 50},
+		RequestPositionCommand{},
+		StopCommand{},
+	}
+	for _, c := range commands {
+		decoded, err := Decode(c.Encode())
+		if err != nil {
+			t.Errorf("Failed to decode %q. Got error: %s", c.Encode(), err)
+			continue
+		}
+		if decoded != c {
+			t.Errorf("Round trip of %+v gave %+v", c, decoded)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	bad := []string{
+		"",
+		"XX\n",
+		"TMTe\rst\n",
+		"MJA0500\n",
+		"MJA0500B00C00D00E00F00T00S25H15G10I20K5\n",
+		"MJA2500B00C00D00E00F00T00S25G10H15I20K5\n",
+		"MJA0500B00C00D00E00F00T00S25G10H15I20K5X1\n",
+		"MJA0abcB00C00D00E00F00T00S25G10H15I20K5\n",
+		"LLA015200B00C00D00E00F00T00\n",
+		"RPA1\n",
+		"STOP\n",
+	}
+	for _, b := range bad {
+		if c, err := Decode([]byte(b)); err == nil {
+			t.Errorf("Decode of %q should fail. Got %+v", b, c)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (MoveCommand{Axes: [7]Axis{{Steps: -1}}}).Validate(); err == nil {
+		t.Errorf("Negative steps should not validate")
+	}
+	if err := (MoveCommand{Speed: -1}).Validate(); err == nil {
+		t.Errorf("Negative speed should not validate")
+	}
+	if err := (CalibrateCommand{Speed: 50}).Validate(); err != nil {
+		t.Errorf("Calibrate should validate. Got error: %s", err)
+	}
+	if err := (EchoCommand{Text: "a\nb"}).Validate(); err == nil {
+		t.Errorf("Multi-line echo should not validate")
+	}
+}
+
+func TestPositionResponse(t *testing.T) {
+	r := PositionResponse{Steps: [6]int{-7556, 4722, -3333, 0, 1905, 7255}}
+	expected := "A-7556B4722C-3333D0E1905F7255\n"
+	if string(r.Encode()) != expected {
+		t.Errorf("Expected %q. Got %q", expected, r.Encode())
+	}
+	decoded, err := DecodePositionResponse(r.Encode())
+	if err != nil || decoded != r {
+		t.Errorf("Round trip of %+v gave %+v with error: %v", r, decoded, err)
+	}
+	if _, err = DecodePositionResponse([]byte("A1B2C3D4E5\n")); err == nil {
+		t.Errorf("Response without F should not decode")
+	}
+}
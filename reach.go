@@ -0,0 +1,129 @@
+package ar3
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// maxReachPoints is the most points SampleReach will check, to keep a typo
+// in the step from sampling forever.
+const maxReachPoints = 1 << 22
+
+// CanReach reports whether the arm can put the TCP of tool at pose, on any
+// inverse kinematics branch, within the joint step limits that every move is
+// checked against. The track is not used.
+func (p RobotProfile) CanReach(pose kinematics.Pose, tool Tool) bool {
+	_, err := p.solvePose(tool.flangePose(pose), [7]float64{}, 0)
+	return err == nil
+}
+
+// ReachPoint is a position sampled by SampleReach.
+type ReachPoint struct {
+	Position  kinematics.Position
+	Reachable bool
+}
+
+// ReachMap is a grid of positions sampled by SampleReach.
+type ReachMap []ReachPoint
+
+// SampleReach checks every point of a grid, step millimeters apart, in the
+// box from min to max, reporting whether the TCP of tool can reach each point
+// with the given rotation.
+func (p RobotProfile) SampleReach(min, max kinematics.Position, step float64, rotation kinematics.Quaternion, tool Tool) (ReachMap, error) {
+	if step <= 0 || math.IsInf(step, 0) || math.IsNaN(step) {
+		return nil, fmt.Errorf("grid step must be positive. Got %g", step)
+	}
+	lo, hi := toVec3(min), toVec3(max)
+	var counts [3]int
+	total := 1
+	for i := range counts {
+		if hi[i] < lo[i] {
+			return nil, fmt.Errorf("grid max must not be below min. Got %v and %v", max, min)
+		}
+		counts[i] = int(math.Floor((hi[i]-lo[i])/step+1e-9)) + 1
+		total *= counts[i]
+		if total > maxReachPoints {
+			return nil, fmt.Errorf("grid has more than %d points. Use a bigger step", maxReachPoints)
+		}
+	}
+
+	reach := make(ReachMap, 0, total)
+	for i := 0; i < counts[0]; i++ {
+		for j := 0; j < counts[1]; j++ {
+			for k := 0; k < counts[2]; k++ {
+				position := lo.add(vec3{float64(i), float64(j), float64(k)}.scale(step)).position()
+				pose := kinematics.Pose{Position: position, Rotation: rotation}
+				reach = append(reach, ReachPoint{Position: position, Reachable: p.CanReach(pose, tool)})
+			}
+		}
+	}
+	return reach, nil
+}
+
+// Reachable returns how many of the points are reachable.
+func (m ReachMap) Reachable() int {
+	n := 0
+	for _, point := range m {
+		if point.Reachable {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteCSV writes the map as CSV, with a header row of x, y, z and
+// reachable, and reachable written as 1 or 0.
+func (m ReachMap) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "x,y,z,reachable")
+	for _, point := range m {
+		p := point.Position
+		fmt.Fprintf(bw, "%g,%g,%g,%d\n", p.X, p.Y, p.Z, reachableInt(point.Reachable))
+	}
+	return bw.Flush()
+}
+
+// WritePLY writes the map as an ASCII PLY point cloud, colouring reachable
+// points green and unreachable points red.
+func (m ReachMap) WritePLY(w io.Writer) error {
+	if len(m) == 0 {
+		return errors.New("reach map has no points")
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\nformat ascii 1.0\nelement vertex %d\n", len(m))
+	fmt.Fprint(bw, "property float x\nproperty float y\nproperty float z\n")
+	fmt.Fprint(bw, "property uchar red\nproperty uchar green\nproperty uchar blue\nend_header\n")
+	for _, point := range m {
+		p := point.Position
+		red, green := 255, 0
+		if point.Reachable {
+			red, green = 0, 255
+		}
+		fmt.Fprintf(bw, "%g %g %g %d %d 0\n", p.X, p.Y, p.Z, red, green)
+	}
+	return bw.Flush()
+}
+
+// reachableInt returns 1 for true and 0 for false.
+func reachableInt(reachable bool) int {
+	if reachable {
+		return 1
+	}
+	return 0
+}
+
+// CanReach is RobotProfile.CanReach, for the profile the AR3 was connected
+// with.
+func (ar3 *AR3exec) CanReach(pose kinematics.Pose, tool Tool) bool {
+	return ar3.Profile().CanReach(pose, tool)
+}
+
+// CanReach simulates AR3exec.CanReach().
+func (ar3 *AR3simulate) CanReach(pose kinematics.Pose, tool Tool) bool {
+	return ar3.Profile().CanReach(pose, tool)
+}
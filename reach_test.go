@@ -0,0 +1,73 @@
+package ar3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+func TestCanReach(t *testing.T) {
+	flange := kinematics.ForwardKinematics(linearStart[:6], AR3DhParameters)
+	if !AR3Profile.CanReach(flange, Tool{}) {
+		t.Errorf("Pose of a joint position within limits should be reachable")
+	}
+	if !AR3Profile.CanReach(pipette.tcpPose(flange), pipette) {
+		t.Errorf("TCP pose of a joint position within limits should be reachable")
+	}
+	far := flange
+	far.Position.X += 1000
+	if AR3Profile.CanReach(far, Tool{}) {
+		t.Errorf("Pose a meter further out should not be reachable")
+	}
+}
+
+func TestSampleReach(t *testing.T) {
+	flange := kinematics.ForwardKinematics(linearStart[:6], AR3DhParameters)
+	min := flange.Position
+	max := min
+	max.X += 1000
+	max.Y += 20
+	reach, err := AR3Profile.SampleReach(min, max, 100, flange.Rotation, Tool{})
+	if err != nil {
+		t.Fatalf("Sampling should succeed. Got error: %s", err)
+	}
+	// 11 points along X, 1 along Y (20 mm is less than a step) and 1 along Z.
+	if len(reach) != 11 {
+		t.Fatalf("Expected 11 points. Got %d", len(reach))
+	}
+	if !reach[0].Reachable || reach[10].Reachable {
+		t.Errorf("Expected the first point reachable and the last not. Got %+v", reach)
+	}
+	if n := reach.Reachable(); n == 0 || n == 11 {
+		t.Errorf("Expected some points reachable. Got %d", n)
+	}
+
+	var csv bytes.Buffer
+	if err = reach.WriteCSV(&csv); err != nil {
+		t.Fatalf("CSV should be written. Got error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 12 || lines[0] != "x,y,z,reachable" || !strings.HasSuffix(lines[1], ",1") {
+		t.Errorf("Unexpected CSV:\n%s", csv.String())
+	}
+
+	var ply bytes.Buffer
+	if err = reach.WritePLY(&ply); err != nil {
+		t.Fatalf("PLY should be written. Got error: %s", err)
+	}
+	if !strings.Contains(ply.String(), "element vertex 11\n") || !strings.HasSuffix(ply.String(), " 255 0 0\n") {
+		t.Errorf("Unexpected PLY:\n%s", ply.String())
+	}
+
+	if _, err = AR3Profile.SampleReach(min, max, 0, flange.Rotation, Tool{}); err == nil {
+		t.Errorf("Zero step should be refused")
+	}
+	if _, err = AR3Profile.SampleReach(max, min, 100, flange.Rotation, Tool{}); err == nil {
+		t.Errorf("Max below min should be refused")
+	}
+	if _, err = AR3Profile.SampleReach(min, max, 0.01, flange.Rotation, Tool{}); err == nil {
+		t.Errorf("Too many points should be refused")
+	}
+}
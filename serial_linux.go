@@ -0,0 +1,107 @@
+package ar3
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// serialTransport is a Transport over a linux serial port (or pseudo-terminal)
+// configured with termios.
+type serialTransport struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// OpenSerial opens and configures the serial port at serialConnectionStr for
+// talking to the AR3 (115200 baud, 8 data bits, no parity).
+func OpenSerial(serialConnectionStr string) (Transport, error) {
+	// Set up connection to the serial port
+	f, err := os.OpenFile(serialConnectionStr, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0666)
+	if err != nil {
+		return nil, err
+	}
+	rate := uint32(unix.B115200) // 115200 is the default Baud rate of the AR3 arm
+	cflagToUse := unix.CREAD | unix.CLOCAL | rate
+	// We use rational defaults from https://github.com/tarm/serial/blob/master/serial_linux.go
+	cflagToUse |= unix.CS8
+	// Get Unix file descriptor
+	fd := f.Fd()
+	t := unix.Termios{
+		Iflag:  unix.IGNPAR,
+		Cflag:  cflagToUse,
+		Ispeed: rate,
+		Ospeed: rate,
+	}
+	t.Cc[unix.VMIN] = uint8(1)
+	t.Cc[unix.VTIME] = uint8(10) // Default timeout is 1s
+
+	_, _, errno := unix.Syscall6(
+		unix.SYS_IOCTL,
+		uintptr(fd),
+		uintptr(unix.TCSETS),
+		uintptr(unsafe.Pointer(&t)),
+		0,
+		0,
+		0,
+	)
+	if errno != 0 {
+		f.Close()
+		return nil, errno
+	}
+	return &serialTransport{file: f, reader: bufio.NewReader(f)}, nil
+}
+
+// WriteCommand writes command to the serial port.
+func (s *serialTransport) WriteCommand(command []byte) error {
+	_, err := s.file.Write(command)
+	return err
+}
+
+// ReadLine reads the next non-empty line from the serial port. The AR3 ends
+// its responses with a mix of \n and \r\n, so blank lines are skipped.
+func (s *serialTransport) ReadLine() (string, error) {
+	for {
+		line, err := s.reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if err != nil {
+			return line, err
+		}
+		if line != "" {
+			return line, nil
+		}
+	}
+}
+
+// Flush discards data received but not read. Data written but not yet
+// transmitted is kept, so a stop written from another goroutine still
+// reaches the arm.
+func (s *serialTransport) Flush() error {
+	s.reader.Reset(s.file)
+	const TCFLSH = 0x540B
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		uintptr(s.file.Fd()),
+		uintptr(TCFLSH),
+		uintptr(unix.TCIFLUSH),
+	)
+
+	if errno == 0 {
+		return nil
+	}
+	return errno
+}
+
+// SetReadDeadline sets the deadline for ReadLine on the serial port.
+func (s *serialTransport) SetReadDeadline(t time.Time) error {
+	return s.file.SetReadDeadline(t)
+}
+
+// Close closes the serial port.
+func (s *serialTransport) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,213 @@
+package ar3
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// Singularity is one of the AR3's three kinds of singularity, where the arm
+// loses the ability to move its TCP in some direction and the joints needed
+// to follow a Cartesian path turn without bound.
+type Singularity int
+
+// The AR3's singularities.
+const (
+	// WristSingularity is J5 straight, lining up J4 and J6.
+	WristSingularity Singularity = iota + 1
+	// ElbowSingularity is the elbow fully stretched out or folded back.
+	ElbowSingularity
+	// ShoulderSingularity is the wrist center on J1's axis.
+	ShoulderSingularity
+)
+
+// String returns "wrist", "elbow" or "shoulder".
+func (s Singularity) String() string {
+	switch s {
+	case WristSingularity:
+		return "wrist"
+	case ElbowSingularity:
+		return "elbow"
+	case ShoulderSingularity:
+		return "shoulder"
+	}
+	return fmt.Sprintf("Singularity(%d)", int(s))
+}
+
+// ErrSingularity is returned by Cartesian moves that would come nearer to a
+// singularity than their SingularityPolicy allows.
+type ErrSingularity struct {
+	Singularity Singularity
+	// Waypoint is the first waypoint, counting from 1, that is too near. A
+	// move to a single pose has a single waypoint.
+	Waypoint int
+	// Distance is how near the waypoint is: radians for the wrist and elbow,
+	// millimeters for the shoulder.
+	Distance float64
+}
+
+// Error names the singularity and how near the waypoint is to it.
+func (e *ErrSingularity) Error() string {
+	distance := fmt.Sprintf("%.1f degrees", e.Distance/degreesToRadians)
+	if e.Singularity == ShoulderSingularity {
+		distance = fmt.Sprintf("%.1f mm", e.Distance)
+	}
+	return fmt.Sprintf("waypoint %d is within %s of a %s singularity", e.Waypoint, distance, e.Singularity)
+}
+
+// SingularityAction is what Cartesian moves do near a singularity.
+type SingularityAction int
+
+// Singularity actions.
+const (
+	// SingularityIgnore moves as though there were no singularities.
+	SingularityIgnore SingularityAction = iota
+	// SingularityRefuse fails the move with ErrSingularity before the arm
+	// moves.
+	SingularityRefuse
+	// SingularitySlow slows the move down in proportion to how near each
+	// waypoint is, down to a speed of 1 at the singularity itself.
+	SingularitySlow
+)
+
+// SingularityPolicy sets how near Cartesian moves may come to each
+// singularity, and what they do when they come nearer. The zero value ignores
+// singularities.
+//
+// Singularities are only detected on arms shaped like the AR3 (see
+// AnalyticInverseKinematics).
+type SingularityPolicy struct {
+	Action SingularityAction
+	// WristMargin is how near, in radians, J5 may come to straight.
+	WristMargin float64
+	// ElbowMargin is how near, in radians, the elbow may come to fully
+	// stretched out or folded back.
+	ElbowMargin float64
+	// ShoulderMargin is how near, in millimeters, the wrist center may come
+	// to J1's axis.
+	ShoulderMargin float64
+}
+
+// DefaultSingularityPolicy refuses moves that come within 5 degrees of the
+// wrist or elbow singularity, or 25 mm of the shoulder singularity.
+var DefaultSingularityPolicy = SingularityPolicy{
+	Action:         SingularityRefuse,
+	WristMargin:    5 * degreesToRadians,
+	ElbowMargin:    5 * degreesToRadians,
+	ShoulderMargin: 25,
+}
+
+// Validate checks that the margins are not negative.
+func (policy SingularityPolicy) Validate() error {
+	if policy.Action < SingularityIgnore || policy.Action > SingularitySlow {
+		return fmt.Errorf("unknown singularity action %d", policy.Action)
+	}
+	if policy.WristMargin < 0 || policy.ElbowMargin < 0 || policy.ShoulderMargin < 0 {
+		return fmt.Errorf("singularity margins must not be negative. Got %g, %g and %g",
+			policy.WristMargin, policy.ElbowMargin, policy.ShoulderMargin)
+	}
+	return nil
+}
+
+// SingularityDistances returns how near joint angles in radians are to each
+// of the AR3's singularities: the wrist and elbow in radians, and the
+// shoulder in millimeters. It returns an error for arms not shaped like the
+// AR3.
+func SingularityDistances(joints [6]float64, dh kinematics.DhParameters) (wrist, elbow, shoulder float64, err error) {
+	if err := checkSphericalWrist(dh); err != nil {
+		return 0, 0, 0, err
+	}
+	// The forearm points a quarter turn from J3's x axis (see
+	// AnalyticInverseKinematics), so the elbow is straight when J3's DH
+	// angle is a quarter turn from 0 or pi.
+	forearm := -math.Pi / 2
+	if dh.DValues[3] < 0 {
+		forearm = math.Pi / 2
+	}
+	origins, _, _ := dhFrames(joints, dh)
+	wrist = math.Abs(math.Remainder(joints[4]+dh.ThetaOffsets[4], math.Pi))
+	elbow = math.Abs(math.Remainder(joints[2]+dh.ThetaOffsets[2]+forearm, math.Pi))
+	shoulder = math.Hypot(origins[4][0], origins[4][1])
+	return wrist, elbow, shoulder, nil
+}
+
+// speeds returns, for each waypoint of a path, the fraction of the requested
+// speed to move at, or an ErrSingularity if the policy refuses the path.
+func (policy SingularityPolicy) speeds(path [][6]float64, dh kinematics.DhParameters) ([]float64, error) {
+	speeds := make([]float64, len(path))
+	for i, joints := range path {
+		speeds[i] = 1
+		if policy.Action == SingularityIgnore {
+			continue
+		}
+		wrist, elbow, shoulder, err := SingularityDistances(joints, dh)
+		if err != nil {
+			continue
+		}
+		checks := []struct {
+			singularity      Singularity
+			distance, margin float64
+		}{
+			{WristSingularity, wrist, policy.WristMargin},
+			{ElbowSingularity, elbow, policy.ElbowMargin},
+			{ShoulderSingularity, shoulder, policy.ShoulderMargin},
+		}
+		for _, check := range checks {
+			if check.distance >= check.margin {
+				continue
+			}
+			if policy.Action == SingularityRefuse {
+				return nil, &ErrSingularity{Singularity: check.singularity, Waypoint: i + 1, Distance: check.distance}
+			}
+			speeds[i] = math.Min(speeds[i], check.distance/check.margin)
+		}
+	}
+	return speeds, nil
+}
+
+// slowParams returns params with the speed scaled by fraction, but no slower
+// than 1.
+func slowParams(params MoveParams, fraction float64) MoveParams {
+	if fraction >= 1 {
+		return params
+	}
+	return params.WithSpeed(int(math.Max(1, math.Round(float64(params.Speed)*fraction))))
+}
+
+// SetSingularityPolicy sets how Cartesian moves treat singularities. Without
+// a policy set, they are ignored.
+func (ar3 *AR3exec) SetSingularityPolicy(policy SingularityPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.singularityPolicy = policy
+	return nil
+}
+
+// CurrentSingularityPolicy returns the policy set with SetSingularityPolicy.
+func (ar3 *AR3exec) CurrentSingularityPolicy() SingularityPolicy {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.singularityPolicy
+}
+
+// SetSingularityPolicy simulates AR3exec.SetSingularityPolicy().
+func (ar3 *AR3simulate) SetSingularityPolicy(policy SingularityPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.singularityPolicy = policy
+	return nil
+}
+
+// CurrentSingularityPolicy simulates AR3exec.CurrentSingularityPolicy().
+func (ar3 *AR3simulate) CurrentSingularityPolicy() SingularityPolicy {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.singularityPolicy
+}
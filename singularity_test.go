@@ -0,0 +1,139 @@
+package ar3
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+func TestJacobian(t *testing.T) {
+	joints := [6]float64{0.3, -0.4, 0.5, 0.6, 0.7, 0.8}
+	origins, _, _ := dhFrames(joints, AR3DhParameters)
+	flange := kinematics.ForwardKinematics(joints[:], AR3DhParameters).Position
+	if d := origins[6].sub(toVec3(flange)).norm(); d > 1e-9 {
+		t.Errorf("DH frames should end at the flange. Got %f mm off", d)
+	}
+
+	// The linear rows should match the flange's movement as each joint turns
+	// a little.
+	j := Jacobian(joints, AR3DhParameters)
+	const h = 1e-6
+	for col := 0; col < 6; col++ {
+		turned := joints
+		turned[col] += h
+		moved := toVec3(kinematics.ForwardKinematics(turned[:], AR3DhParameters).Position).sub(toVec3(flange)).scale(1 / h)
+		for row := 0; row < 3; row++ {
+			if math.Abs(moved[row]-j[row][col]) > 1e-3 {
+				t.Errorf("J[%d][%d] should be %f. Got %f", row, col, moved[row], j[row][col])
+			}
+		}
+	}
+}
+
+func TestManipulability(t *testing.T) {
+	home := [6]float64{}
+	if m := Manipulability(home, AR3DhParameters); m > 1e-9 {
+		t.Errorf("Home has J5 straight, so manipulability should be 0. Got %g", m)
+	}
+	if c := ConditionNumber(home, AR3DhParameters); !math.IsInf(c, 1) {
+		t.Errorf("Home should have an infinite condition number. Got %g", c)
+	}
+
+	var joints [6]float64
+	copy(joints[:], linearStart[:6])
+	m, c := Manipulability(joints, AR3DhParameters), ConditionNumber(joints, AR3DhParameters)
+	if m <= 0 || c < 1 || math.IsInf(c, 1) {
+		t.Errorf("Expected a regular pose. Got manipulability %g and condition number %g", m, c)
+	}
+	joints[4] = 0.01
+	if near := Manipulability(joints, AR3DhParameters); near >= m {
+		t.Errorf("Manipulability should drop near the wrist singularity. Got %g from %g", near, m)
+	}
+}
+
+func TestSingularityPolicy_Speeds(t *testing.T) {
+	policy := SingularityPolicy{Action: SingularitySlow, WristMargin: 10 * degreesToRadians}
+	path := [][6]float64{
+		{0, -0.5, -0.8, 0, 20 * degreesToRadians, 0},
+		{0, -0.5, -0.8, 0, 5 * degreesToRadians, 0},
+		{0, -0.5, -0.8, 0, 0, 0},
+	}
+	speeds, err := policy.speeds(path, AR3DhParameters)
+	if err != nil {
+		t.Fatalf("Slowing should not fail. Got error: %s", err)
+	}
+	if math.Abs(speeds[0]-1) > 1e-9 || math.Abs(speeds[1]-0.5) > 1e-9 || speeds[2] != 0 {
+		t.Errorf("Expected speeds of 1, 0.5 and 0. Got %v", speeds)
+	}
+	if p := slowParams(DefaultMoveParams, speeds[2]); p.Speed != 1 {
+		t.Errorf("Speed should not drop below 1. Got %d", p.Speed)
+	}
+
+	policy.Action = SingularityRefuse
+	_, err = policy.speeds(path, AR3DhParameters)
+	var singular *ErrSingularity
+	if !errors.As(err, &singular) || singular.Singularity != WristSingularity || singular.Waypoint != 2 {
+		t.Errorf("Expected a wrist singularity at waypoint 2. Got %v", err)
+	}
+}
+
+func TestAR3simulate_MoveSingular(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians([7]float64{})
+	home := arm.CurrentPose()
+	arm.SetJointRadians(linearStart)
+	before := arm.CurrentStepperPosition()
+	if err := arm.SetSingularityPolicy(DefaultSingularityPolicy); err != nil {
+		t.Fatalf("Policy should be set. Got error: %s", err)
+	}
+
+	err := arm.MoveWithParams(DefaultMoveParams, home)
+	var singular *ErrSingularity
+	if !errors.As(err, &singular) || singular.Singularity != WristSingularity {
+		t.Errorf("Move to home should be refused at the wrist singularity. Got %v", err)
+	}
+	if arm.CurrentStepperPosition() != before {
+		t.Errorf("Refused move should not move the arm")
+	}
+
+	if err = arm.SetSingularityPolicy(SingularityPolicy{WristMargin: -1}); err == nil {
+		t.Errorf("Negative margin should be refused")
+	}
+}
+
+func TestAR3exec_MoveLinearSingular(t *testing.T) {
+	arm, mt := connectMemory(t)
+	arm.SetJointRadians(linearStart)
+	policy := DefaultSingularityPolicy
+	// linearStart has J5 at 46 degrees.
+	policy.WristMargin = 60 * degreesToRadians
+	if err := arm.SetSingularityPolicy(policy); err != nil {
+		t.Fatalf("Policy should be set. Got error: %s", err)
+	}
+	end := arm.CurrentPose()
+	end.Position.Z -= 10
+
+	err := arm.MoveLinear(DefaultMoveParams, end, 2, 5)
+	if err == nil || !strings.Contains(err.Error(), "wrist singularity") {
+		t.Errorf("Path should be refused near the wrist singularity. Got %v", err)
+	}
+	if len(mt.Commands()) != 1 {
+		t.Errorf("Nothing should be sent for a refused path. Got %v", mt.Commands())
+	}
+
+	policy.Action = SingularitySlow
+	if err = arm.SetSingularityPolicy(policy); err != nil {
+		t.Fatalf("Policy should be set. Got error: %s", err)
+	}
+	if err = arm.MoveLinear(DefaultMoveParams, end, 2, 5); err != nil {
+		t.Fatalf("Slowed path should succeed. Got error: %s", err)
+	}
+	for _, command := range mt.Commands()[1:] {
+		if strings.HasPrefix(command, "MJ") && strings.Contains(command, "S25") {
+			t.Errorf("Every segment should be slowed. Got %s", command)
+		}
+	}
+}
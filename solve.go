@@ -0,0 +1,155 @@
+package ar3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/trilobio/kinematics"
+)
+
+// ConfigurationHint restricts which inverse kinematics branches a pose move
+// may choose from. Hints combine with |. The zero value allows every branch,
+// as does setting both hints of a pair, like HintElbowUp|HintElbowDown.
+type ConfigurationHint uint8
+
+// Configuration hints, one for each side of each Configuration field.
+const (
+	HintShoulderFront ConfigurationHint = 1 << iota
+	HintShoulderBack
+	HintElbowUp
+	HintElbowDown
+	HintWristNoFlip
+	HintWristFlip
+)
+
+// allows reports whether the hint allows a configuration.
+func (h ConfigurationHint) allows(c Configuration) bool {
+	// A side is ruled out when only the hint for the other side is set.
+	pair := func(yes, no ConfigurationHint, value bool) bool {
+		if value {
+			return h&no == 0 || h&yes != 0
+		}
+		return h&yes == 0 || h&no != 0
+	}
+	return pair(HintShoulderBack, HintShoulderFront, c.ShoulderBack) &&
+		pair(HintElbowUp, HintElbowDown, c.ElbowUp) &&
+		pair(HintWristFlip, HintWristNoFlip, c.WristFlip)
+}
+
+// errExcludedByHint rules out a branch the configuration hint does not allow.
+var errExcludedByHint = errors.New("excluded by configuration hint")
+
+// BranchError is why a single inverse kinematics branch was ruled out.
+type BranchError struct {
+	Configuration Configuration
+	Err           error
+}
+
+// ErrUnreachable is returned by pose moves when the arm can reach the pose in
+// principle, but every inverse kinematics branch is ruled out by the joint
+// limits or the configuration hint.
+type ErrUnreachable struct {
+	Branches []BranchError
+}
+
+// Error lists each branch and what ruled it out.
+func (e *ErrUnreachable) Error() string {
+	branches := make([]string, len(e.Branches))
+	for i, branch := range e.Branches {
+		branches[i] = fmt.Sprintf("%s: %s", branch.Configuration, branch.Err)
+	}
+	return "no inverse kinematics solution within limits: " + strings.Join(branches, "; ")
+}
+
+// solvePose returns the joint angles that put the end effector at pose, fit
+// the arm's step limits and hint, and are nearest to the current joint angles.
+//
+// Arms shaped like the AR3 are solved analytically. Other arms fall back to
+// kinematics.InverseKinematics, seeded from the current joints, and ignore
+// the hint.
+func (p RobotProfile) solvePose(pose kinematics.Pose, current [7]float64, hint ConfigurationHint) ([6]float64, error) {
+	var joints [6]float64
+	if checkSphericalWrist(p.DhParameters) != nil {
+		tj, err := kinematics.InverseKinematics(pose, p.DhParameters, current[:6])
+		if err != nil {
+			return joints, fmt.Errorf("inverse kinematics failed with error: %s", err)
+		}
+		copy(joints[:], tj)
+		return joints, p.checkJointLimits(joints)
+	}
+
+	solutions, err := AnalyticInverseKinematics(pose, p.DhParameters)
+	if err != nil {
+		return joints, err
+	}
+	var unreachable ErrUnreachable
+	best := math.Inf(1)
+	for _, solution := range solutions {
+		if !hint.allows(solution.Configuration) {
+			unreachable.Branches = append(unreachable.Branches, BranchError{solution.Configuration, errExcludedByHint})
+			continue
+		}
+		candidate := p.nearestTurn(solution.Joints, current)
+		if err := p.checkJointLimits(candidate); err != nil {
+			unreachable.Branches = append(unreachable.Branches, BranchError{solution.Configuration, err})
+			continue
+		}
+		distance := 0.0
+		for i := range candidate {
+			distance += (candidate[i] - current[i]) * (candidate[i] - current[i])
+		}
+		if distance < best {
+			best, joints = distance, candidate
+		}
+	}
+	if math.IsInf(best, 1) {
+		return joints, &unreachable
+	}
+	return joints, nil
+}
+
+// nearestTurn adds or removes a full turn from each joint angle where that
+// brings it closer to the current angle while keeping it within the joint's
+// step limits.
+func (p RobotProfile) nearestTurn(joints [6]float64, current [7]float64) [6]float64 {
+	sl := p.limitSwitchSteps()
+	for i, joint := range joints {
+		for _, turn := range []float64{-2 * math.Pi, 2 * math.Pi} {
+			candidate := joint + turn
+			if math.Abs(candidate-current[i]) >= math.Abs(joints[i]-current[i]) {
+				continue
+			}
+			steps := int(math.Round(candidate/p.RadPerStep[i])) + sl[i]
+			if lower, upper := p.stepRange(i); steps >= lower && steps <= upper {
+				joints[i] = candidate
+			}
+		}
+	}
+	return joints
+}
+
+// checkJointLimits checks that joint angles in radians are within the step
+// limits of J1 through J6.
+func (p RobotProfile) checkJointLimits(joints [6]float64) error {
+	var angles [7]float64
+	copy(angles[:6], joints[:])
+	_, err := p.checkStepLimits(p.limitSwitchSteps(), p.anglesToSteps(angles, false))
+	return err
+}
+
+// MoveWithHint is MoveWithParams, choosing only from the inverse kinematics
+// branches that hint allows.
+func (ar3 *AR3exec) MoveWithHint(params MoveParams, pose kinematics.Pose, hint ConfigurationHint) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		return ar3.moveTrack(ctx, params, pose, ar3.CurrentJointRadians()[6], hint)
+	})
+}
+
+// MoveWithHint simulates AR3exec.MoveWithHint().
+func (ar3 *AR3simulate) MoveWithHint(params MoveParams, pose kinematics.Pose, hint ConfigurationHint) error {
+	return ar3.moveTrack(params, pose, ar3.CurrentJointRadians()[6], hint)
+}
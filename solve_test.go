@@ -0,0 +1,97 @@
+package ar3
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+// twoElbowJoints reach a pose that the AR3 can also reach elbow down, with
+// the shoulder back.
+var twoElbowJoints = []float64{0.6, -0.2, -0.6, 1.2, -0.5, -0.2}
+
+// nearJoints reports whether joints match expected to within a step.
+func nearJoints(joints [7]float64, expected []float64) bool {
+	for i, e := range expected {
+		if math.Abs(joints[i]-e) > 1e-3 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAR3simulate_MoveWithHint(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	pose := kinematics.ForwardKinematics(twoElbowJoints, AR3DhParameters)
+	if err := arm.MoveWithParams(DefaultMoveParams, pose); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	if !nearJoints(arm.CurrentJointRadians(), twoElbowJoints) {
+		t.Errorf("Move from home should pick the nearest solution %v. Got %v", twoElbowJoints, arm.CurrentJointRadians())
+	}
+
+	if err := arm.MoveWithHint(DefaultMoveParams, pose, HintElbowDown); err != nil {
+		t.Fatalf("Elbow down move should succeed. Got error: %s", err)
+	}
+	down := arm.CurrentJointRadians()
+	if math.Abs(down[0]-twoElbowJoints[0]) < 1 {
+		t.Errorf("Elbow down should swing the shoulder round. Got %v", down)
+	}
+	reached := arm.CurrentPose().Position
+	if math.Abs(reached.X-pose.Position.X)+math.Abs(reached.Y-pose.Position.Y)+math.Abs(reached.Z-pose.Position.Z) > 1 {
+		t.Errorf("Elbow down move should still reach %+v. Got %+v", pose.Position, reached)
+	}
+
+	// Without a hint, the nearest solution is now the elbow down one.
+	if err := arm.MoveWithParams(DefaultMoveParams, pose); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	if arm.CurrentJointRadians() != down {
+		t.Errorf("Move should stay elbow down. Got %v", arm.CurrentJointRadians())
+	}
+}
+
+func TestAR3simulate_MoveUnreachable(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	// The AR3's J1 cannot turn all the way round.
+	pose := kinematics.ForwardKinematics([]float64{math.Pi, 0, 0, 0, 0.5, 0}, AR3DhParameters)
+	err := arm.MoveWithParams(DefaultMoveParams, pose)
+	var unreachable *ErrUnreachable
+	if !errors.As(err, &unreachable) {
+		t.Fatalf("Move should fail with ErrUnreachable. Got %v", err)
+	}
+	if len(unreachable.Branches) != 8 {
+		t.Errorf("Every branch should be ruled out. Got %v", unreachable.Branches)
+	}
+	if !strings.Contains(err.Error(), "shoulder front, elbow up, wrist no-flip: J1 out of range") {
+		t.Errorf("Error should name the limit blocking each branch. Got %s", err)
+	}
+
+	err = arm.MoveWithHint(DefaultMoveParams, pose, HintElbowUp)
+	if err == nil || !strings.Contains(err.Error(), "elbow down, wrist no-flip: excluded by configuration hint") {
+		t.Errorf("Error should name the branches the hint ruled out. Got %v", err)
+	}
+}
+
+func TestConfigurationHint(t *testing.T) {
+	elbowUp := Configuration{ElbowUp: true}
+	for _, test := range []struct {
+		hint    ConfigurationHint
+		allowed bool
+	}{
+		{0, true},
+		{HintElbowUp, true},
+		{HintElbowDown, false},
+		{HintElbowUp | HintElbowDown, true},
+		{HintWristNoFlip | HintShoulderFront, true},
+		{HintWristFlip, false},
+		{HintShoulderBack | HintElbowUp, false},
+	} {
+		if test.hint.allows(elbowUp) != test.allowed {
+			t.Errorf("Hint %b should allow %s: %t", test.hint, elbowUp, test.allowed)
+		}
+	}
+}
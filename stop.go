@@ -0,0 +1,83 @@
+package ar3
+
+import (
+	"errors"
+
+	"github.com/trilobio/ar3/protocol"
+)
+
+// ErrStopped is returned by a move, or calibration, that Stop cut short.
+var ErrStopped = errors.New("AR3 stopped")
+
+// Stop stops the AR3 where it is. The move in progress is abandoned and fails
+// with ErrStopped, and every move on the motion queue is flushed. The arm
+// stops without decelerating, so the steppers may have skipped steps: every
+// joint is marked not calibrated, and later moves fail with ErrNotCalibrated
+// until the arm is calibrated again.
+//
+// Stop does not wait for the command loop, so it can be called while another
+// goroutine is blocked on a move. A read waiting on the arm is only
+// interrupted on transports with read deadlines, like the serial port. Stop
+// only writes to serial: the command loop may still be reading it, so serial
+// is cleared by the loop before its next command, and an answer to the stop
+// that arrives later is skipped.
+func (ar3 *AR3exec) Stop() error {
+	ar3.queue.flush()
+	ar3.mu.Lock()
+	ar3.stops++
+	ar3.calibrated = [7]bool{}
+	ar3.stale = true
+	if ar3.abort != nil {
+		close(ar3.abort)
+		ar3.abort = nil
+	}
+	ar3.mu.Unlock()
+
+	return ar3.writeCommand(protocol.StopCommand{}.Encode())
+}
+
+// writeCommand writes a command to serial. Stop writes from outside the
+// command loop, so writes are serialized here.
+func (ar3 *AR3exec) writeCommand(command []byte) error {
+	ar3.writeMu.Lock()
+	defer ar3.writeMu.Unlock()
+	return ar3.serial.WriteCommand(command)
+}
+
+// stopCount returns how many times Stop has been called.
+func (ar3 *AR3exec) stopCount() int {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.stops
+}
+
+// checkStopped returns ErrStopped if Stop has been called since stopCount
+// returned stops.
+func (ar3 *AR3exec) checkStopped(stops int) error {
+	if ar3.stopCount() != stops {
+		return ErrStopped
+	}
+	return nil
+}
+
+// Stop simulates AR3exec.Stop(). A move being made in real time (see
+// SetRealTime) is cut short, leaving the arm at its target.
+func (ar3 *AR3simulate) Stop() error {
+	ar3.queue.flush()
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.stops++
+	ar3.calibrated = [7]bool{}
+	if ar3.abort != nil {
+		close(ar3.abort)
+		ar3.abort = nil
+	}
+	return nil
+}
+
+// stopCount simulates AR3exec.stopCount().
+func (ar3 *AR3simulate) stopCount() int {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.stops
+}
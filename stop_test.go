@@ -0,0 +1,244 @@
+package ar3
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bufferedTransport is a Transport whose read buffer is not guarded, like the
+// bufio.Reader of the serial port, so a Flush racing a ReadLine is caught by
+// the race detector. Commands written are handed to the arm on written, and
+// the arm answers on responses.
+type bufferedTransport struct {
+	written   chan string
+	responses chan string
+	wake      chan struct{}
+	buffered  []string
+	flushes   int32
+}
+
+func newBufferedTransport() *bufferedTransport {
+	return &bufferedTransport{
+		written:   make(chan string, 16),
+		responses: make(chan string, 16),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+func (b *bufferedTransport) WriteCommand(command []byte) error {
+	b.written <- strings.TrimSpace(string(command))
+	return nil
+}
+
+func (b *bufferedTransport) ReadLine() (string, error) {
+	if len(b.buffered) == 0 {
+		select {
+		case line := <-b.responses:
+			b.buffered = append(b.buffered, line)
+		case <-b.wake:
+			return "", os.ErrDeadlineExceeded
+		}
+	}
+	line := b.buffered[0]
+	b.buffered = b.buffered[1:]
+	return line, nil
+}
+
+func (b *bufferedTransport) Flush() error {
+	b.buffered = nil
+	atomic.AddInt32(&b.flushes, 1)
+	return nil
+}
+
+// SetReadDeadline wakes a waiting ReadLine once the deadline has passed.
+func (b *bufferedTransport) SetReadDeadline(t time.Time) error {
+	if t.IsZero() {
+		select {
+		case <-b.wake:
+		default:
+		}
+		return nil
+	}
+	if !t.After(time.Now()) {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *bufferedTransport) Close() error {
+	return nil
+}
+
+func TestAR3exec_Stop(t *testing.T) {
+	arm, st := connectStalled(t)
+	running := arm.MoveJointRadiansAsync(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	queued := arm.MoveJointRadiansAsync(DefaultMoveParams, 0.1, 0, 0, 0, 0, 0, 0)
+	// Wait for the first move to reach the arm, which never finishes it.
+	for len(st.Commands()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := arm.Stop(); err != nil {
+		t.Fatalf("Stop should succeed. Got error: %s", err)
+	}
+	if err := running.Wait(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Errorf("Running move should fail with ErrStopped. Got %v", err)
+	}
+	if err := queued.Wait(context.Background()); err != ErrMotionFlushed {
+		t.Errorf("Queued move should be flushed. Got %v", err)
+	}
+	commands := st.Commands()
+	if last := commands[len(commands)-1]; last != "ST" {
+		t.Errorf("Stop should be sent to the arm. Got %q", last)
+	}
+
+	// The stalled arm never finishes a calibration, so stop allowing
+	// uncalibrated motion instead.
+	arm.AllowUncalibratedMotion(false)
+	err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0.2, 0, 0, 0, 0, 0, 0)
+	if !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Moves after a stop should fail until calibrated. Got %v", err)
+	}
+	if len(st.Commands()) != len(commands) {
+		t.Errorf("Nothing should be sent for a refused move. Got %v", st.Commands()[len(commands):])
+	}
+	if err = arm.Echo(); err != nil {
+		t.Errorf("Arm should still answer echoes. Got error: %s", err)
+	}
+}
+
+func TestAR3exec_StopDuringRead(t *testing.T) {
+	bt := newBufferedTransport()
+	moves, stops := make(chan string, 1), make(chan struct{}, 1)
+	// The arm answers echoes but never finishes a move.
+	go func() {
+		for command := range bt.written {
+			switch {
+			case strings.HasPrefix(command, "TM"):
+				bt.responses <- command[2:]
+			case command == "ST":
+				stops <- struct{}{}
+			default:
+				moves <- command
+			}
+		}
+	}()
+	arm, err := ConnectTransport(bt, [7]bool{}, AR3Profile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	connectFlushes := atomic.LoadInt32(&bt.flushes)
+
+	running := arm.MoveJointRadiansAsync(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0)
+	<-moves
+	if err = arm.Stop(); err != nil {
+		t.Fatalf("Stop should succeed. Got error: %s", err)
+	}
+	<-stops
+	if err = running.Wait(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Errorf("Running move should fail with ErrStopped. Got %v", err)
+	}
+	if flushes := atomic.LoadInt32(&bt.flushes) - connectFlushes; flushes != 0 {
+		t.Errorf("Stop should leave serial to the command loop. Got %d flushes", flushes)
+	}
+	if err = arm.Echo(); err != nil {
+		t.Errorf("Arm should still answer echoes. Got error: %s", err)
+	}
+	if flushes := atomic.LoadInt32(&bt.flushes) - connectFlushes; flushes != 1 {
+		t.Errorf("Serial should be flushed before the next command. Got %d flushes", flushes)
+	}
+}
+
+func TestAR3simulate_Stop(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	mock := arm.(*AR3simulate)
+	mock.SetRealTime(true)
+	slow := DefaultMoveParams.WithSpeed(1)
+	done := make(chan error)
+	go func() {
+		done <- arm.MoveJointRadiansWithParams(slow, 1, 0, 0, 0, 0, 0, 0)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := arm.Stop(); err != nil {
+		t.Fatalf("Stop should succeed. Got error: %s", err)
+	}
+	select {
+	case err := <-done:
+		if err != ErrStopped {
+			t.Errorf("Move should fail with ErrStopped. Got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Stop should cut the move short")
+	}
+	mock.SetRealTime(false)
+
+	if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Moves after a stop should fail until calibrated. Got %v", err)
+	}
+	arm.Calibrate(50, true, true, true, false, true, true, false)
+	if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); !errors.Is(err, ErrNotCalibrated) {
+		t.Errorf("Calibrating some joints should not clear the stop. Got %v", err)
+	}
+	arm.Calibrate(50, true, true, true, true, true, true, false)
+	if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("Moves should be made once calibrated. Got error: %s", err)
+	}
+}
+
+func TestAR3simulate_PauseResume(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians([7]float64{})
+	arm.Pause()
+	first := arm.MoveJointRadiansAsync(DefaultMoveParams, 0.1, 0, 0, 0, 0, 0, 0)
+	second := arm.MoveJointRadiansAsync(DefaultMoveParams, 0.2, 0, 0, 0, 0, 0, 0)
+	time.Sleep(10 * time.Millisecond)
+	if first.Err() != nil || len(arm.QueuedMotions()) != 2 || arm.CurrentJointRadians()[0] != 0 {
+		t.Errorf("Paused queue should hold its moves. Got %d queued", len(arm.QueuedMotions()))
+	}
+
+	arm.Resume()
+	if err := second.Wait(context.Background()); err != nil {
+		t.Errorf("Moves should be made once resumed. Got error: %s", err)
+	}
+	if j1 := arm.CurrentJointRadians()[0]; j1 < 0.19 || j1 > 0.21 {
+		t.Errorf("Both moves should be made in order. Got J1 at %f", j1)
+	}
+
+	arm.Pause()
+	held := arm.MoveJointRadiansAsync(DefaultMoveParams, 0.3, 0, 0, 0, 0, 0, 0)
+	if flushed := arm.FlushQueue(); flushed != 1 || held.Err() != ErrMotionFlushed {
+		t.Errorf("Paused moves should be flushed. Got %d, %v", flushed, held.Err())
+	}
+	arm.Resume()
+}
+
+// TestAR3exec_StopCalibrate checks that calibrating every joint lets the arm
+// move again after a stop.
+func TestAR3exec_StopCalibrate(t *testing.T) {
+	arm, mt := connectMemory(t)
+	if err := arm.Stop(); err != nil {
+		t.Fatalf("Stop should succeed. Got error: %s", err)
+	}
+	if commands := mt.Commands(); !strings.HasPrefix(commands[len(commands)-1], "ST") {
+		t.Errorf("Stop should be sent to the arm. Got %v", commands)
+	}
+	arm.AllowUncalibratedMotion(false)
+	if arm.IsCalibrated() {
+		t.Errorf("Stop should leave the arm not calibrated")
+	}
+	if err := arm.Calibrate(50, true, true, true, true, true, true, false); err != nil {
+		t.Fatalf("Calibrate should succeed. Got error: %s", err)
+	}
+	if err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("Moves should be made once calibrated. Got error: %s", err)
+	}
+}
@@ -0,0 +1,167 @@
+package ar3
+
+import (
+	"math"
+	"time"
+)
+
+// speedMult is the firmware's SpeedMult: the delay in microseconds between
+// steps of the joint moving furthest at a speed of 100.
+const speedMult = 200
+
+// MoveTiming models how the AR3's firmware times a single move command. The
+// firmware steps the axis moving furthest once per cycle, and steps every
+// other axis along with it in proportion, so all the axes start and finish
+// together. Each cycle waits a delay worked out from the move's speed: the
+// delay starts long and shortens while accelerating, holds while cruising,
+// and lengthens again while decelerating.
+//
+// The model follows the firmware's arithmetic for the cruising and
+// accelerating delays. Its deceleration is a straight ramp from the cruising
+// delay up to the deceleration delay, which is what the firmware aims for.
+type MoveTiming struct {
+	// Steps is how many steps each axis moves, ignoring direction.
+	Steps [7]int
+	// Duration is how long the move takes.
+	Duration time.Duration
+
+	cycles   int        // steps of the axis moving furthest
+	share    float64    // fraction of each cycle's delay spent stepping
+	delays   []float64  // delay of each cycle in microseconds
+	starts   []float64  // time each cycle starts in microseconds
+	fraction [7]float64 // steps of each axis per cycle
+}
+
+// PlanMoveTiming models a move of each axis by relative steps with params,
+// returning an error if params are not valid (see MoveParams.Validate).
+func PlanMoveTiming(params MoveParams, relative [7]int) (MoveTiming, error) {
+	var m MoveTiming
+	if err := params.Validate(); err != nil {
+		return m, err
+	}
+	active, total := 0, 0
+	for i, steps := range relative {
+		m.Steps[i] = abs(steps)
+		if m.Steps[i] > m.cycles {
+			m.cycles = m.Steps[i]
+		}
+		if m.Steps[i] > 0 {
+			active++
+			total += m.Steps[i]
+		}
+	}
+	if m.cycles == 0 {
+		return m, nil
+	}
+	for i, steps := range m.Steps {
+		m.fraction[i] = float64(steps) / float64(m.cycles)
+	}
+	// The firmware divides each delay between the active axes, and each axis
+	// waits its part only on cycles it steps.
+	m.share = float64(total) / float64(m.cycles*active)
+
+	n := float64(m.cycles)
+	speed := float64(params.Speed) / 100
+	regular := math.Floor(speedMult / speed)
+	rampDelay := func(spd int) float64 {
+		if spd == 0 {
+			return regular
+		}
+		return (speedMult + speedMult/(float64(spd)/100)) / speed
+	}
+	accSteps := n * float64(params.AccDur) / 100
+	dccStart := n - n*float64(params.DccDur)/100
+	accDelay, accInc := rampDelay(params.AccSpd), 0.0
+	if accSteps > 0 {
+		accInc = (regular - accDelay) / accSteps
+	}
+	dccDelay, dccInc := regular, 0.0
+	if dccSteps := n - dccStart; dccSteps > 0 {
+		dccInc = (rampDelay(params.DccSpd) - regular) / dccSteps
+	}
+
+	m.delays = make([]float64, m.cycles)
+	m.starts = make([]float64, m.cycles)
+	elapsed := 0.0
+	for cycle := 1; cycle <= m.cycles; cycle++ {
+		delay := regular
+		switch c := float64(cycle); {
+		case c <= accSteps:
+			delay = accDelay
+			accDelay += accInc
+		case c >= dccStart:
+			delay = dccDelay
+			dccDelay += dccInc
+		}
+		m.starts[cycle-1] = elapsed
+		m.delays[cycle-1] = delay * m.share
+		elapsed += delay * m.share
+	}
+	m.Duration = time.Duration(elapsed * float64(time.Microsecond))
+	return m, nil
+}
+
+// Velocity returns the speed of each axis, in steps per second, at time t
+// into the move. It is 0 before the move starts and after it finishes.
+func (m MoveTiming) Velocity(t time.Duration) [7]float64 {
+	var v [7]float64
+	if t < 0 || t >= m.Duration || m.cycles == 0 {
+		return v
+	}
+	us := float64(t) / float64(time.Microsecond)
+	// The cycle running at t is the last to start at or before it.
+	lo, hi := 0, m.cycles-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if m.starts[mid] <= us {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	cyclesPerSecond := 1e6 / m.delays[lo]
+	for i := range v {
+		v[i] = m.fraction[i] * cyclesPerSecond
+	}
+	return v
+}
+
+// EstimateMoveDuration predicts how long the AR3 takes to move each axis by
+// relative steps with params. See MoveTiming for the model.
+func EstimateMoveDuration(params MoveParams, relative [7]int) (time.Duration, error) {
+	m, err := PlanMoveTiming(params, relative)
+	return m.Duration, err
+}
+
+// planJointMove models a move from the stepper position from to joint angles
+// in radians.
+func (p RobotProfile) planJointMove(params MoveParams, from [7]int, joints [7]float64) (MoveTiming, error) {
+	if err := params.Validate(); err != nil {
+		return MoveTiming{}, err
+	}
+	steps, err := p.jointsToSteps(joints)
+	if err != nil {
+		return MoveTiming{}, err
+	}
+	sl := p.limitSwitchSteps()
+	var relative [7]int
+	for i := range relative {
+		relative[i] = steps[i] + sl[i] - from[i]
+	}
+	if _, err := p.checkStepLimits(from, relative); err != nil {
+		return MoveTiming{}, err
+	}
+	return PlanMoveTiming(params, relative)
+}
+
+// PlanJointMove models how MoveJointRadiansWithParams would move the arm from
+// where it is to joint angles in radians (and the track in millimeters): how
+// long it would take, and how fast each axis would turn on the way.
+func (ar3 *AR3exec) PlanJointMove(params MoveParams, joints [7]float64) (MoveTiming, error) {
+	return ar3.Profile().planJointMove(params, ar3.CurrentStepperPosition(), joints)
+}
+
+// PlanJointMove simulates AR3exec.PlanJointMove().
+func (ar3 *AR3simulate) PlanJointMove(params MoveParams, joints [7]float64) (MoveTiming, error) {
+	return ar3.Profile().planJointMove(params, ar3.CurrentStepperPosition(), joints)
+}
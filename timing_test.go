@@ -0,0 +1,107 @@
+package ar3
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateMoveDuration(t *testing.T) {
+	estimate := func(params MoveParams, relative [7]int) time.Duration {
+		d, err := EstimateMoveDuration(params, relative)
+		if err != nil {
+			t.Fatalf("Move should be estimated. Got error: %s", err)
+		}
+		return d
+	}
+	flat := MoveParams{Speed: 100}
+	// At full speed the firmware waits 200 microseconds a step.
+	if d := estimate(flat, [7]int{1000}); d != 200*time.Millisecond {
+		t.Errorf("Expected 200ms. Got %s", d)
+	}
+	if d := estimate(flat.WithSpeed(50), [7]int{-1000}); d != 400*time.Millisecond {
+		t.Errorf("Half speed should take twice as long. Got %s", d)
+	}
+	// Axes stepping together share each cycle's delay.
+	if d := estimate(flat, [7]int{1000, 1000}); d != 200*time.Millisecond {
+		t.Errorf("Two axes moving together should take 200ms. Got %s", d)
+	}
+	if d := estimate(flat, [7]int{1000, 500}); d != 150*time.Millisecond {
+		t.Errorf("An axis moving half as far should take a quarter off. Got %s", d)
+	}
+	if d := estimate(flat, [7]int{}); d != 0 {
+		t.Errorf("No move should take no time. Got %s", d)
+	}
+
+	ramped := estimate(DefaultMoveParams.WithSpeed(100), [7]int{1000})
+	if ramped <= 200*time.Millisecond {
+		t.Errorf("Accelerating and decelerating should take longer. Got %s", ramped)
+	}
+}
+
+func TestEstimateMoveDuration_InvalidParams(t *testing.T) {
+	for _, params := range []MoveParams{{}, {Speed: 101}, {Speed: 50, AccDur: -1}} {
+		if d, err := EstimateMoveDuration(params, [7]int{1000}); err == nil {
+			t.Errorf("%+v should be refused. Got %s", params, d)
+		}
+		if _, err := PlanMoveTiming(params, [7]int{}); err == nil {
+			t.Errorf("%+v should be refused even for no move", params)
+		}
+	}
+}
+
+func TestMoveTiming_Velocity(t *testing.T) {
+	params := MoveParams{Speed: 25, AccDur: 10, AccSpd: 50, DccDur: 10, DccSpd: 50}
+	m, err := PlanMoveTiming(params, [7]int{2000, -1000})
+	if err != nil {
+		t.Fatalf("Move should be planned. Got error: %s", err)
+	}
+	start, middle, end := m.Velocity(0), m.Velocity(m.Duration/2), m.Velocity(m.Duration-time.Microsecond)
+
+	// Cruising at speed 25, the firmware waits 800 microseconds a cycle,
+	// three quarters of which is spent stepping the two axes.
+	if math.Abs(middle[0]-1e6/600) > 1e-6 || math.Abs(middle[1]-1e6/1200) > 1e-6 {
+		t.Errorf("Expected 1667 and 833 steps per second cruising. Got %v", middle)
+	}
+	if start[0] >= middle[0] || end[0] >= middle[0] {
+		t.Errorf("Expected slower at the ends. Got %f, %f and %f", start[0], middle[0], end[0])
+	}
+	if v := m.Velocity(m.Duration); v != ([7]float64{}) {
+		t.Errorf("Expected no velocity after the move. Got %v", v)
+	}
+}
+
+func TestAR3simulate_SimulatedTime(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	mock := arm.(*AR3simulate)
+	params := MoveParams{Speed: 100}
+	sl := AR3Profile.limitSwitchSteps()
+
+	timing, err := arm.PlanJointMove(params, [7]float64{0, 0, 0, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatalf("Move should be planned. Got error: %s", err)
+	}
+	if err = arm.MoveJointRadiansWithParams(params, 0, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	if err = arm.Wait(10); err != nil {
+		t.Fatalf("Wait should succeed. Got error: %s", err)
+	}
+	if want := timing.Duration + 10*time.Millisecond; mock.SimulatedTime() != want {
+		t.Errorf("Expected %s of simulated time. Got %s", want, mock.SimulatedTime())
+	}
+
+	mock.SetRealTime(true)
+	start := time.Now()
+	pos := arm.CurrentStepperPosition()
+	if err = arm.MoveSteppersWithParams(params, pos[0]-sl[0]+100, pos[1]-sl[1], pos[2]-sl[2], pos[3]-sl[3], pos[4]-sl[4], pos[5]-sl[5], 0); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("100 steps at full speed should take 20ms in real time. Took %s", elapsed)
+	}
+
+	if _, err = arm.PlanJointMove(params, [7]float64{10}); err == nil {
+		t.Errorf("Move out of range should not be planned")
+	}
+}
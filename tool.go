@@ -0,0 +1,185 @@
+package ar3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/trilobio/kinematics"
+	"gopkg.in/yaml.v3"
+)
+
+// Tool is something mounted on the arm's flange, like a gripper or pipette.
+// Once an arm has a tool set, CurrentPose and every Cartesian move work with
+// the tool center point (TCP) instead of the flange.
+//
+// Tools can be written as JSON or YAML using the field names in the json
+// tags, and loaded with LoadTools. The zero Tool is the bare flange.
+type Tool struct {
+	Name string `json:"name"`
+	// Offset is the pose of the TCP in the flange's frame, in millimeters.
+	// The flange's z axis points out of the arm, so a pipette 120 mm long has
+	// an offset of Z: 120. A zero rotation is treated as no rotation.
+	Offset kinematics.Pose `json:"offset"`
+	// Mass is the mass of the tool in kilograms, or 0 if it is not known.
+	Mass float64 `json:"mass,omitempty"`
+	// Radius is the radius in millimeters of the capsule around the line
+	// from the flange to the TCP, used for collision checking (see
+	// CollisionModel). A tool with no radius is not checked.
+	Radius float64 `json:"radius,omitempty"`
+}
+
+// FlangeTool is the bare flange, with the TCP on the flange itself.
+var FlangeTool = Tool{Name: "flange", Offset: kinematics.Pose{Rotation: kinematics.Quaternion{W: 1}}}
+
+// Validate checks that the tool's offset and mass can be used.
+func (t Tool) Validate() error {
+	p, q := t.Offset.Position, t.Offset.Rotation
+	for _, v := range []float64{p.X, p.Y, p.Z, q.W, q.X, q.Y, q.Z, t.Mass, t.Radius} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("tool %q has a value that is not a number", t.Name)
+		}
+	}
+	if t.Mass < 0 {
+		return fmt.Errorf("tool %q mass must not be negative. Got %g", t.Name, t.Mass)
+	}
+	if t.Radius < 0 {
+		return fmt.Errorf("tool %q radius must not be negative. Got %g", t.Name, t.Radius)
+	}
+	return nil
+}
+
+// isFlange reports whether the TCP is on the flange.
+func (t Tool) isFlange() bool {
+	q := t.Offset.Rotation
+	return t.Offset.Position == (kinematics.Position{}) &&
+		(q == (kinematics.Quaternion{}) || q == (kinematics.Quaternion{W: 1}))
+}
+
+// offset returns the pose of the TCP in the flange's frame.
+func (t Tool) offset() kinematics.Pose {
+	offset := t.Offset
+	if offset.Rotation == (kinematics.Quaternion{}) {
+		offset.Rotation.W = 1
+	}
+	return offset
+}
+
+// tcpPose returns the pose of the TCP when the flange is at flange.
+func (t Tool) tcpPose(flange kinematics.Pose) kinematics.Pose {
+	if t.isFlange() {
+		return flange
+	}
+	return composePoses(flange, t.offset())
+}
+
+// flangePose returns the pose of the flange that puts the TCP at tcp.
+func (t Tool) flangePose(tcp kinematics.Pose) kinematics.Pose {
+	if t.isFlange() {
+		return tcp
+	}
+	return composePoses(tcp, invertPose(t.offset()))
+}
+
+// FindTool returns the tool with the given name, case insensitive. "flange"
+// finds FlangeTool when tools has no tool of that name.
+func FindTool(tools []Tool, name string) (Tool, bool) {
+	for _, tool := range tools {
+		if strings.EqualFold(tool.Name, name) {
+			return tool, true
+		}
+	}
+	if strings.EqualFold(name, FlangeTool.Name) {
+		return FlangeTool, true
+	}
+	return Tool{}, false
+}
+
+// LoadTools reads a list of tools from a JSON (.json) or YAML (.yaml or .yml)
+// file.
+func LoadTools(path string) ([]Tool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseToolsJSON(data)
+	case ".yaml", ".yml":
+		return ParseToolsYAML(data)
+	}
+	return nil, fmt.Errorf("unknown tools format %q", filepath.Ext(path))
+}
+
+// ParseToolsJSON parses and validates a JSON list of tools.
+func ParseToolsJSON(data []byte) ([]Tool, error) {
+	var tools []Tool
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return nil, fmt.Errorf("error parsing tools: %w", err)
+	}
+	for _, tool := range tools {
+		if tool.Name == "" {
+			return nil, errors.New("every tool needs a name")
+		}
+		if err := tool.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return tools, nil
+}
+
+// ParseToolsYAML parses and validates a YAML list of tools. The YAML uses the
+// same field names as JSON.
+func ParseToolsYAML(data []byte) ([]Tool, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("error parsing tools: %w", err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tools: %w", err)
+	}
+	return ParseToolsJSON(data)
+}
+
+// SetTool sets the tool mounted on the flange. CurrentPose and Cartesian moves
+// made after SetTool work with its TCP.
+func (ar3 *AR3exec) SetTool(tool Tool) error {
+	if err := tool.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.tool = tool
+	return nil
+}
+
+// CurrentTool returns the tool set with SetTool, or the zero Tool (the bare
+// flange) if none has been set.
+func (ar3 *AR3exec) CurrentTool() Tool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.tool
+}
+
+// SetTool simulates AR3exec.SetTool().
+func (ar3 *AR3simulate) SetTool(tool Tool) error {
+	if err := tool.Validate(); err != nil {
+		return err
+	}
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	ar3.tool = tool
+	return nil
+}
+
+// CurrentTool simulates AR3exec.CurrentTool().
+func (ar3 *AR3simulate) CurrentTool() Tool {
+	ar3.mu.Lock()
+	defer ar3.mu.Unlock()
+	return ar3.tool
+}
@@ -0,0 +1,101 @@
+package ar3
+
+import (
+	"math"
+	"testing"
+
+	"github.com/trilobio/kinematics"
+)
+
+// pipette is 120 mm long, mounted off center and turned a quarter turn about
+// the flange's z axis.
+var pipette = Tool{
+	Name: "pipette",
+	Offset: kinematics.Pose{
+		Position: kinematics.Position{X: 10, Z: 120},
+		Rotation: kinematics.Quaternion{W: math.Cos(math.Pi / 4), Z: math.Sin(math.Pi / 4)},
+	},
+	Mass: 0.2,
+}
+
+func TestTool_FlangePose(t *testing.T) {
+	flange := kinematics.ForwardKinematics(linearStart[:6], AR3DhParameters)
+	tcp := pipette.tcpPose(flange)
+	rot := rotationFromQuaternion(flange.Rotation)
+	// The TCP is 120 mm along the flange's z axis and 10 mm along its x axis.
+	want := kinematics.Position{
+		X: flange.Position.X + 10*rot[0][0] + 120*rot[0][2],
+		Y: flange.Position.Y + 10*rot[1][0] + 120*rot[1][2],
+		Z: flange.Position.Z + 10*rot[2][0] + 120*rot[2][2],
+	}
+	if !samePose(kinematics.Pose{Position: want, Rotation: tcp.Rotation}, tcp) {
+		t.Errorf("Expected the TCP at %+v. Got %+v", want, tcp.Position)
+	}
+	if !samePose(pipette.flangePose(tcp), flange) {
+		t.Errorf("flangePose should undo tcpPose. Got %+v", pipette.flangePose(tcp))
+	}
+	if (Tool{}).tcpPose(flange) != flange || FlangeTool.flangePose(flange) != flange {
+		t.Errorf("The bare flange should not change the pose")
+	}
+}
+
+func TestAR3simulate_SetTool(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	arm.SetJointRadians(linearStart)
+	flange := arm.CurrentPose()
+
+	if err := arm.SetTool(pipette); err != nil {
+		t.Fatalf("SetTool should succeed. Got error: %s", err)
+	}
+	if arm.CurrentTool().Name != "pipette" {
+		t.Errorf("Expected the pipette. Got %+v", arm.CurrentTool())
+	}
+	tcp := arm.CurrentPose()
+	if !samePose(tcp, pipette.tcpPose(flange)) {
+		t.Errorf("CurrentPose should be the TCP. Got %+v", tcp)
+	}
+
+	target := tcp
+	target.Position.Z -= 30
+	if err := arm.MoveWithParams(DefaultMoveParams, target); err != nil {
+		t.Fatalf("Move should succeed. Got error: %s", err)
+	}
+	got := arm.CurrentPose()
+	if d := toVec3(got.Position).sub(toVec3(target.Position)).norm(); d > 1 {
+		t.Errorf("Move should put the TCP at the target. Got %f mm off", d)
+	}
+
+	if err := arm.SetTool(Tool{Name: "anvil", Mass: -1}); err == nil {
+		t.Errorf("Negative mass should be refused")
+	}
+}
+
+func TestParseToolsYAML(t *testing.T) {
+	tools, err := ParseToolsYAML([]byte(`
+- name: gripper
+  offset:
+    position: {z: 80}
+    rotation: {w: 1}
+  mass: 0.5
+- name: pipette
+  offset:
+    position: {z: 120}
+`))
+	if err != nil {
+		t.Fatalf("Tools should parse. Got error: %s", err)
+	}
+	tool, ok := FindTool(tools, "Gripper")
+	if !ok || tool.Offset.Position.Z != 80 || tool.Mass != 0.5 {
+		t.Errorf("Expected the gripper. Got %+v", tool)
+	}
+	if tool, ok = FindTool(tools, "flange"); !ok || tool != FlangeTool {
+		t.Errorf("flange should always be found. Got %+v", tool)
+	}
+	if _, ok = FindTool(tools, "spatula"); ok {
+		t.Errorf("Unknown tool should not be found")
+	}
+
+	if _, err = ParseToolsJSON([]byte(`[{"offset": {}}]`)); err == nil {
+		t.Errorf("Tool without a name should be refused")
+	}
+}
@@ -0,0 +1,74 @@
+package ar3
+
+import (
+	"context"
+	"math"
+
+	"github.com/trilobio/kinematics"
+)
+
+// TrackPose is the pose of the end effector of an arm mounted on a linear
+// track. Pose is in the track's frame, which is the arm's base frame when the
+// arm is at the track's limit switch, and Track is the position of the arm
+// along the track in millimeters.
+type TrackPose struct {
+	Pose  kinematics.Pose
+	Track float64
+}
+
+// trackOffset returns the offset of the arm's base frame from the track's
+// frame with the arm at the track position in millimeters.
+func (p RobotProfile) trackOffset(track float64) kinematics.Position {
+	a := p.TrackAxis
+	norm := math.Sqrt(a[0]*a[0] + a[1]*a[1] + a[2]*a[2])
+	if norm == 0 {
+		return kinematics.Position{}
+	}
+	scale := track / norm
+	return kinematics.Position{X: a[0] * scale, Y: a[1] * scale, Z: a[2] * scale}
+}
+
+// toTrackFrame converts a pose in the arm's base frame to the track's frame.
+func (p RobotProfile) toTrackFrame(pose kinematics.Pose, track float64) TrackPose {
+	offset := p.trackOffset(track)
+	pose.Position.X += offset.X
+	pose.Position.Y += offset.Y
+	pose.Position.Z += offset.Z
+	return TrackPose{Pose: pose, Track: track}
+}
+
+// fromTrackFrame converts a pose in the track's frame to the arm's base frame.
+func (p RobotProfile) fromTrackFrame(pose TrackPose) kinematics.Pose {
+	offset := p.trackOffset(pose.Track)
+	base := pose.Pose
+	base.Position.X -= offset.X
+	base.Position.Y -= offset.Y
+	base.Position.Z -= offset.Z
+	return base
+}
+
+// CurrentTrackPose returns the current pose of the end effector in the
+// track's frame, along with the arm's position on the track.
+func (ar3 *AR3exec) CurrentTrackPose() TrackPose {
+	return ar3.Profile().toTrackFrame(ar3.CurrentPose(), ar3.CurrentJointRadians()[6])
+}
+
+// MoveTrackPose moves the arm along its track to pose.Track, while moving the
+// end effector to pose.Pose in the track's frame. The track and joints move
+// together in a single move.
+func (ar3 *AR3exec) MoveTrackPose(params MoveParams, pose TrackPose) error {
+	ctx := context.Background()
+	return ar3.do(ctx, func() error {
+		return ar3.moveTrack(ctx, params, ar3.Profile().fromTrackFrame(pose), pose.Track, 0)
+	})
+}
+
+// CurrentTrackPose simulates AR3exec.CurrentTrackPose().
+func (ar3 *AR3simulate) CurrentTrackPose() TrackPose {
+	return ar3.Profile().toTrackFrame(ar3.CurrentPose(), ar3.CurrentJointRadians()[6])
+}
+
+// MoveTrackPose simulates AR3exec.MoveTrackPose().
+func (ar3 *AR3simulate) MoveTrackPose(params MoveParams, pose TrackPose) error {
+	return ar3.moveTrack(params, ar3.Profile().fromTrackFrame(pose), pose.Track, 0)
+}
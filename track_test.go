@@ -0,0 +1,94 @@
+package ar3
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// trackProfile is an AR3 on a 1 meter track along its X axis.
+var trackProfile = AR3Profile.WithTrack(0.1, 10000, [3]float64{1, 0, 0})
+
+func TestAR3exec_MoveTrack(t *testing.T) {
+	mt := NewMemoryTransport(EchoResponder)
+	arm, err := ConnectTransport(mt, [7]bool{}, trackProfile)
+	if err != nil {
+		t.Fatalf("Failed to connect. Got error: %s", err)
+	}
+	arm.AllowUncalibratedMotion(true)
+	err = arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 250)
+	if err != nil {
+		t.Errorf("Arm should succeed with a track move. Got error: %s", err)
+	}
+	commands := mt.Commands()
+	if !strings.Contains(commands[1], "T02500S") {
+		t.Errorf("Move should send 2500 track steps. Got %s", commands[1])
+	}
+	if track := arm.CurrentJointRadians()[6]; math.Abs(track-250) > 1e-9 {
+		t.Errorf("Track should be at 250 mm. Got %f", track)
+	}
+
+	err = arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 1500)
+	if err == nil || !strings.Contains(err.Error(), "Track out of range") {
+		t.Errorf("Arm should fail to move past the end of the track. Got %v", err)
+	}
+	if len(mt.Commands()) != len(commands) {
+		t.Errorf("Nothing should be sent for a rejected track move. Got %v", mt.Commands())
+	}
+
+	err = arm.Calibrate(50, false, false, false, false, false, false, true)
+	if err != nil {
+		t.Errorf("Calibrate should succeed. Got error: %s", err)
+	}
+	commands = mt.Commands()
+	if calibrate := commands[len(commands)-1]; calibrate != "LLA00B00C00D00E00F00T110000S50" {
+		t.Errorf("Calibrate should home the track. Got %s", calibrate)
+	}
+	if arm.CurrentStepperPosition()[6] != 0 {
+		t.Errorf("Track should be zeroed by calibration. Got %v", arm.CurrentStepperPosition())
+	}
+}
+
+func TestAR3simulate_NoTrack(t *testing.T) {
+	arm := connectCalibrated(AR3Profile)
+	err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 5)
+	if err == nil {
+		t.Errorf("Arm without a track should not move the track")
+	}
+	err = arm.MoveSteppersWithParams(DefaultMoveParams, 0, 0, 0, 0, 0, 0, 50)
+	if err == nil {
+		t.Errorf("Arm without a track should not step the track")
+	}
+}
+
+func TestAR3simulate_MoveTrackPose(t *testing.T) {
+	arm := connectCalibrated(trackProfile)
+	err := arm.MoveJointRadiansWithParams(DefaultMoveParams, 0, 0, math.Pi/4, 0, -math.Pi/4, 0, 100)
+	if err != nil {
+		t.Fatalf("Arm should succeed with a track move. Got error: %s", err)
+	}
+	start := arm.CurrentTrackPose()
+	if math.Abs(start.Track-100) > 1e-9 {
+		t.Errorf("Track should be at 100 mm. Got %f", start.Track)
+	}
+	base := arm.CurrentPose()
+	if math.Abs(start.Pose.Position.X-base.Position.X-100) > 1e-9 {
+		t.Errorf("Track frame should be offset 100 mm along X. Got %+v and %+v", start.Pose, base)
+	}
+
+	// Slide along the track, keeping the end effector still.
+	target := start
+	target.Track = 130
+	err = arm.MoveTrackPose(DefaultMoveParams, target)
+	if err != nil {
+		t.Fatalf("Arm should succeed with a track pose move. Got error: %s", err)
+	}
+	end := arm.CurrentTrackPose()
+	if math.Abs(end.Track-130) > 1e-9 {
+		t.Errorf("Track should be at 130 mm. Got %f", end.Track)
+	}
+	p, q := end.Pose.Position, target.Pose.Position
+	if math.Abs(p.X-q.X) > 1 || math.Abs(p.Y-q.Y) > 1 || math.Abs(p.Z-q.Z) > 1 {
+		t.Errorf("End effector should stay at %+v. Got %+v", q, p)
+	}
+}
@@ -0,0 +1,134 @@
+package ar3
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/trilobio/ar3/protocol"
+)
+
+// Transport carries commands to, and responses from, the arduino controlling
+// the AR3. AR3exec performs all of its I/O through a Transport, so anything
+// that speaks the AR3 serial protocol (a serial port, a pseudo-terminal, or an
+// in-memory fake) can stand in for the robot.
+//
+// Transports that also have a SetReadDeadline(time.Time) error method, like
+// the one returned by OpenSerial, let ArmContext methods interrupt a read that
+// is waiting on the arm.
+type Transport interface {
+	// WriteCommand sends a single newline terminated command to the arm.
+	WriteCommand(command []byte) error
+	// ReadLine returns the next non-empty response line from the arm, with
+	// the trailing carriage returns and newlines removed.
+	ReadLine() (string, error)
+	// Flush discards data received but not read. Data written but not yet
+	// transmitted must still be sent.
+	Flush() error
+	// Close closes the underlying connection.
+	Close() error
+}
+
+// ErrNoResponse is returned by MemoryTransport.ReadLine when there are no
+// response lines waiting to be read.
+var ErrNoResponse = errors.New("no response from transport")
+
+// ErrTransportClosed is returned when writing to or reading from a closed
+// MemoryTransport, or sending a command to a closed AR3exec.
+var ErrTransportClosed = errors.New("transport closed")
+
+// MemoryTransport is an in-memory Transport, useful for driving AR3exec in
+// tests without a robot. Every command written is recorded, and the Respond
+// function (if set) returns the response lines the arm would send back for
+// that command.
+type MemoryTransport struct {
+	Respond func(command string) []string
+
+	mu       sync.Mutex
+	commands []string
+	pending  []string
+	closed   bool
+}
+
+// NewMemoryTransport creates a MemoryTransport that answers each command with
+// the lines returned by respond.
+func NewMemoryTransport(respond func(command string) []string) *MemoryTransport {
+	return &MemoryTransport{Respond: respond}
+}
+
+// WriteCommand records the command and queues up its response lines.
+func (m *MemoryTransport) WriteCommand(command []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrTransportClosed
+	}
+	c := strings.TrimRight(string(command), "\r\n")
+	m.commands = append(m.commands, c)
+	if m.Respond != nil {
+		for _, line := range m.Respond(c) {
+			line = strings.TrimRight(line, "\r\n")
+			if line != "" {
+				m.pending = append(m.pending, line)
+			}
+		}
+	}
+	return nil
+}
+
+// ReadLine returns the oldest unread response line.
+func (m *MemoryTransport) ReadLine() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", ErrTransportClosed
+	}
+	if len(m.pending) == 0 {
+		return "", ErrNoResponse
+	}
+	line := m.pending[0]
+	m.pending = m.pending[1:]
+	return line, nil
+}
+
+// Flush discards any unread response lines.
+func (m *MemoryTransport) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = nil
+	return nil
+}
+
+// Close closes the MemoryTransport. Further reads and writes fail.
+func (m *MemoryTransport) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// Commands returns every command written to the MemoryTransport so far, with
+// line endings removed.
+func (m *MemoryTransport) Commands() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	commands := make([]string, len(m.commands))
+	copy(commands, m.commands)
+	return commands
+}
+
+// EchoResponder is a MemoryTransport responder that behaves like an idle AR3:
+// echo commands are answered with their payload, calibrations with "pass",
+// stops with "Stopped" and every other command with a single "Done" line.
+func EchoResponder(command string) []string {
+	if strings.HasPrefix(command, "TM") {
+		return []string{command[2:]}
+	}
+	if strings.HasPrefix(command, protocol.CalibrateCode) {
+		return []string{protocol.CalibratePass}
+	}
+	if command == protocol.StopCode {
+		return []string{protocol.StopResponse}
+	}
+	return []string{"Done"}
+}
@@ -0,0 +1,41 @@
+package ar3
+
+import (
+	"testing"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	mt := NewMemoryTransport(func(command string) []string {
+		return []string{"first\r\n", "", "second"}
+	})
+	err := mt.WriteCommand([]byte("TMTest\n"))
+	if err != nil {
+		t.Errorf("Write should succeed. Got error: %s", err)
+	}
+	for _, expected := range []string{"first", "second"} {
+		line, err := mt.ReadLine()
+		if err != nil || line != expected {
+			t.Errorf("Expected line %s. Got %s with error: %v", expected, line, err)
+		}
+	}
+	_, err = mt.ReadLine()
+	if err != ErrNoResponse {
+		t.Errorf("Reading past the responses should fail with ErrNoResponse. Got %v", err)
+	}
+	if commands := mt.Commands(); len(commands) != 1 || commands[0] != "TMTest" {
+		t.Errorf("Commands should be [TMTest]. Got %v", commands)
+	}
+}
+
+func TestMemoryTransportFlushClose(t *testing.T) {
+	mt := NewMemoryTransport(EchoResponder)
+	_ = mt.WriteCommand([]byte("TMTest\n"))
+	_ = mt.Flush()
+	if _, err := mt.ReadLine(); err != ErrNoResponse {
+		t.Errorf("Flush should discard unread responses. Got %v", err)
+	}
+	_ = mt.Close()
+	if err := mt.WriteCommand([]byte("TMTest\n")); err != ErrTransportClosed {
+		t.Errorf("Writing to a closed transport should fail. Got %v", err)
+	}
+}